@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A bundle is a zip of cached plugin archives, for carrying to machines with no internet. It holds bundle.json, which
+// describes what's in it, and plugins/<scheduler>.zip for each plugin.
+type bundleManifest struct {
+	CreatedAt time.Time    `json:"createdAt"`
+	Plugins   []cacheEntry `json:"plugins"`
+}
+
+const bundleManifestName = "bundle.json"
+
+// Writes every cached plugin in schedulers to a bundle at bundlePath. They should already have been refreshed.
+func exportBundle(bundlePath, cachePath string, schedulers []schedulerEntry) error {
+	manifest := bundleManifest{CreatedAt: time.Now().UTC()}
+	for _, scheduler := range schedulers {
+		entry, ok := readCacheEntry(cachePath, scheduler.Name)
+		if !ok {
+			return fmt.Errorf("%s isn't in the plugin cache", scheduler.Name)
+		}
+		manifest.Plugins = append(manifest.Plugins, entry)
+	}
+
+	// Write somewhere temporary first so a failed export doesn't leave half a bundle where a good one is expected.
+	bundleFile, err := os.CreateTemp(filepath.Dir(bundlePath), filepath.Base(bundlePath)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(bundleFile.Name())
+	defer bundleFile.Close()
+
+	writer := zip.NewWriter(bundleFile)
+
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestWriter, err := writer.Create(bundleManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := manifestWriter.Write(manifestContent); err != nil {
+		return err
+	}
+
+	for _, entry := range manifest.Plugins {
+		// The archives are already compressed, so they're stored as-is.
+		archiveWriter, err := writer.CreateHeader(&zip.FileHeader{Name: "plugins/" + entry.Scheduler + ".zip", Method: zip.Store, Modified: entry.DownloadedAt})
+		if err != nil {
+			return err
+		}
+		archive, err := os.Open(cachedArchivePath(cachePath, entry.Scheduler))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(archiveWriter, archive)
+		archive.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := bundleFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(bundleFile.Name(), bundlePath)
+}
+
+// Copies every plugin in the bundle at bundlePath into the cache, checking each against the bundle's manifest.
+// Returns what was imported.
+func importBundle(bundlePath, cachePath string) ([]cacheEntry, error) {
+	reader, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	manifestFile, err := reader.Open(bundleManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a plugin bundle: %w", bundlePath, err)
+	}
+	var manifest bundleManifest
+	err = json.NewDecoder(manifestFile).Decode(&manifest)
+	manifestFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", bundlePath, bundleManifestName, err)
+	}
+
+	if err := os.MkdirAll(pluginCacheFolder(cachePath), 0755); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range manifest.Plugins {
+		if !schedulerNamePattern.MatchString(entry.Scheduler) {
+			return nil, fmt.Errorf("%s: \"%s\" isn't a valid scheduler name", bundlePath, entry.Scheduler)
+		}
+		if err := importBundledArchive(reader, entry, cachePath); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", bundlePath, entry.Scheduler, err)
+		}
+	}
+	return manifest.Plugins, nil
+}
+
+func importBundledArchive(reader *zip.ReadCloser, entry cacheEntry, cachePath string) error {
+	archive, err := reader.Open("plugins/" + entry.Scheduler + ".zip")
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	archivePath := cachedArchivePath(cachePath, entry.Scheduler)
+	tmpFile, err := os.CreateTemp(filepath.Dir(archivePath), filepath.Base(archivePath)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = io.Copy(tmpFile, archive)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	archiveSHA256, err := fileSHA256(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+	if archiveSHA256 != entry.SHA256 {
+		return errors.New("the archive doesn't match the bundle's checksum; the bundle may be damaged")
+	}
+
+	if err := os.Rename(tmpFile.Name(), archivePath); err != nil {
+		return err
+	}
+	return writeCacheEntry(cachePath, entry)
+}
+
+// Used in place of a real connection when offline, so anything that tries to reach the network fails loudly instead.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("not connecting to %s while offline", request.URL.Host)
+}
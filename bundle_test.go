@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Puts an archive in the cache for each scheduler, as if it had been downloaded, and returns the cache's path.
+func fillCache(t *testing.T, archives map[string]string) string {
+	t.Helper()
+	cachePath := t.TempDir()
+	os.MkdirAll(pluginCacheFolder(cachePath), 0755)
+	for name, archive := range archives {
+		archivePath := cachedArchivePath(cachePath, name)
+		if err := os.WriteFile(archivePath, []byte(archive), 0644); err != nil {
+			t.Fatal(err)
+		}
+		archiveSHA256, err := fileSHA256(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := cacheEntry{Scheduler: name, URL: "https://example.com/" + name + ".zip", ETag: `"v1"`, SHA256: archiveSHA256,
+			Size: int64(len(archive)), DownloadedAt: time.Now().UTC().Truncate(time.Second)}
+		if err := writeCacheEntry(cachePath, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cachePath
+}
+
+// Copies the bundle at bundlePath, letting change alter each file's content on the way, and returns the copy's path.
+func rewriteBundle(t *testing.T, bundlePath string, change func(name string, content []byte) []byte) string {
+	t.Helper()
+	reader, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	rewrittenPath := filepath.Join(t.TempDir(), "rewritten.zip")
+	rewritten, err := os.Create(rewrittenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rewritten.Close()
+	writer := zip.NewWriter(rewritten)
+	for _, file := range reader.File {
+		opened, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(opened)
+		opened.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter, err := writer.Create(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter.Write(change(file.Name, content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return rewrittenPath
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	archives := map[string]string{"slurm": "PK slurm", "pbs": "PK pbs"}
+	cachePath := fillCache(t, archives)
+	bundlePath := filepath.Join(t.TempDir(), "plugins-bundle.zip")
+
+	if err := exportBundle(bundlePath, cachePath, []schedulerEntry{{Name: "slurm"}, {Name: "pbs"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	otherCachePath := t.TempDir()
+	imported, err := importBundle(bundlePath, otherCachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Errorf("imported %d plugins, want 2", len(imported))
+	}
+	for name, archive := range archives {
+		exported, _ := readCacheEntry(cachePath, name)
+		entry, ok := readCacheEntry(otherCachePath, name)
+		if !ok {
+			t.Errorf("%s isn't in the cache it was imported to", name)
+			continue
+		}
+		if entry != exported {
+			t.Errorf("%s's entry = %+v, want %+v", name, entry, exported)
+		}
+		if content, _ := os.ReadFile(cachedArchivePath(otherCachePath, name)); string(content) != archive {
+			t.Errorf("%s's archive = %q, want %q", name, content, archive)
+		}
+	}
+}
+
+func TestExportBundleNotCached(t *testing.T) {
+	cachePath := fillCache(t, map[string]string{"slurm": "PK slurm"})
+	bundlePath := filepath.Join(t.TempDir(), "plugins-bundle.zip")
+
+	err := exportBundle(bundlePath, cachePath, []schedulerEntry{{Name: "slurm"}, {Name: "pbs"}})
+	if err == nil || !strings.Contains(err.Error(), "pbs isn't in the plugin cache") {
+		t.Fatalf("exportBundle = %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(bundlePath)); len(entries) != 0 {
+		t.Errorf("%d files were left behind", len(entries))
+	}
+}
+
+func TestImportBundleRejected(t *testing.T) {
+	cachePath := fillCache(t, map[string]string{"slurm": "PK slurm"})
+	bundlePath := filepath.Join(t.TempDir(), "plugins-bundle.zip")
+	if err := exportBundle(bundlePath, cachePath, []schedulerEntry{{Name: "slurm"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(name string, content []byte) []byte
+		error  string
+	}{
+		{"damaged archive", func(name string, content []byte) []byte {
+			if name == "plugins/slurm.zip" {
+				return []byte("PK slurn")
+			}
+			return content
+		}, "doesn't match the bundle's checksum"},
+		{"unsafe scheduler name", func(name string, content []byte) []byte {
+			return []byte(strings.ReplaceAll(string(content), `"scheduler": "slurm"`, `"scheduler": "../slurm"`))
+		}, `"../slurm" isn't a valid scheduler name`},
+		{"manifest isn't JSON", func(name string, content []byte) []byte {
+			if name == bundleManifestName {
+				return []byte("not JSON")
+			}
+			return content
+		}, "bundle.json"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			otherCachePath := t.TempDir()
+			_, err := importBundle(rewriteBundle(t, bundlePath, test.change), otherCachePath)
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Fatalf("importBundle = %v, want an error saying %q", err, test.error)
+			}
+			if _, ok := readCacheEntry(otherCachePath, "slurm"); ok {
+				t.Error("the plugin was imported anyway")
+			}
+			entries, _ := os.ReadDir(pluginCacheFolder(otherCachePath))
+			for _, entry := range entries {
+				t.Errorf("%s was left in the cache", entry.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Downloaded plugin archives are kept in cachePath/plugins as <scheduler>.zip, with what we know about each in
+// <scheduler>.json. Refreshing one sends its ETag and Last-Modified back so the server can say it hasn't changed.
+type cacheEntry struct {
+	Scheduler    string    `json:"scheduler"`
+	URL          string    `json:"url"`
+	Ref          string    `json:"ref,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+	CheckedAt    time.Time `json:"checkedAt"`
+}
+
+const pluginCacheFolderName = "plugins"
+
+// Where the cache lives when cachePath isn't set.
+func defaultCachePath() string {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "integration-scripts-profiler-cache")
+	}
+	return filepath.Join(userCacheDir, "integration-scripts-profiler")
+}
+
+func pluginCacheFolder(cachePath string) string {
+	return filepath.Join(cachePath, pluginCacheFolderName)
+}
+
+func cachedArchivePath(cachePath, schedulerName string) string {
+	return filepath.Join(pluginCacheFolder(cachePath), schedulerName+".zip")
+}
+
+func cacheEntryPath(cachePath, schedulerName string) string {
+	return filepath.Join(pluginCacheFolder(cachePath), schedulerName+".json")
+}
+
+// Returns the cache entry for a scheduler if there is one and its archive is still intact.
+func readCacheEntry(cachePath, schedulerName string) (cacheEntry, bool) {
+	content, err := os.ReadFile(cacheEntryPath(cachePath, schedulerName))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return cacheEntry{}, false
+	}
+
+	archiveSHA256, err := fileSHA256(cachedArchivePath(cachePath, schedulerName))
+	if err != nil || archiveSHA256 != entry.SHA256 {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func writeCacheEntry(cachePath string, entry cacheEntry) error {
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cacheEntryPath(cachePath, entry.Scheduler), append(content, '\n'), 0644)
+}
+
+// Prints what's in the cache for "cache status".
+func showCacheStatus(cachePath string) error {
+	folder := pluginCacheFolder(cachePath)
+	fmt.Print("Plugin cache: ", folder, "\n")
+
+	entryPaths, err := filepath.Glob(filepath.Join(folder, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(entryPaths)
+
+	if len(entryPaths) == 0 {
+		fmt.Print("The cache is empty.\n")
+		return nil
+	}
+
+	var totalSize int64
+	for _, entryPath := range entryPaths {
+		schedulerName := strings.TrimSuffix(filepath.Base(entryPath), ".json")
+		entry, ok := readCacheEntry(cachePath, schedulerName)
+		if !ok {
+			fmt.Printf("%-15s damaged; it will be downloaded again\n", schedulerName)
+			continue
+		}
+		totalSize += entry.Size
+
+		version := entry.Ref
+		if version == "" {
+			version = "-"
+		}
+		fmt.Printf("%-15s %-10s %10s  downloaded %s, checked %s\n", entry.Scheduler, version, formatBytes(entry.Size),
+			entry.DownloadedAt.Local().Format(time.DateTime), entry.CheckedAt.Local().Format(time.DateTime))
+	}
+	fmt.Print("Total: ", formatBytes(totalSize), "\n")
+	return nil
+}
+
+// Deletes every cached archive for "cache clear". Only the plugins folder is removed, since cachePath could be
+// somewhere shared.
+func clearCache(cachePath string) error {
+	folder := pluginCacheFolder(cachePath)
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		fmt.Print("The cache is already empty.\n")
+		return nil
+	}
+	if err := os.RemoveAll(folder); err != nil {
+		return err
+	}
+	fmt.Print("Cleared the plugin cache in ", folder, "\n")
+	return nil
+}
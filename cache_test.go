@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Serves one plugin archive with an ETag, answering 304 when it's sent back, and counts what it's asked.
+type pluginServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	archive     string
+	etag        string
+	downloads   int
+	revalidated int
+}
+
+func newPluginServer(t *testing.T, archive, etag string) *pluginServer {
+	server := &pluginServer{archive: archive, etag: etag}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		if r.Header.Get("If-None-Match") == server.etag {
+			server.revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		server.downloads++
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("ETag", server.etag)
+		w.Write([]byte(server.archive))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Changes what the server has, as if the plugin had been updated upstream.
+func (server *pluginServer) update(archive, etag string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.archive, server.etag = archive, etag
+}
+
+func (server *pluginServer) counts() (downloads, revalidated int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.downloads, server.revalidated
+}
+
+func TestCachePlugin(t *testing.T) {
+	previousOffline := offline
+	t.Cleanup(func() { offline = previousOffline })
+	offline = false
+
+	server := newPluginServer(t, "PK first", `"v1"`)
+	scheduler := schedulerEntry{Name: "slurm", URL: server.URL, Ref: "main"}
+	cachePath := t.TempDir()
+	archive := func() string {
+		content, _ := os.ReadFile(cachedArchivePath(cachePath, "slurm"))
+		return string(content)
+	}
+
+	// The first time, it's downloaded.
+	first, fromCache, err := cachePlugin(context.Background(), scheduler, cachePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromCache || first.ETag != `"v1"` || archive() != "PK first" {
+		t.Fatalf("fromCache = %v, ETag = %q, archive = %q", fromCache, first.ETag, archive())
+	}
+
+	// Then the server says it hasn't changed, so the cached zip is kept and only CheckedAt moves on.
+	second, fromCache, err := cachePlugin(context.Background(), scheduler, cachePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloads, revalidated := server.counts(); downloads != 1 || revalidated != 1 {
+		t.Errorf("%d downloads and %d revalidations, want 1 of each", downloads, revalidated)
+	}
+	if !fromCache || archive() != "PK first" || second.SHA256 != first.SHA256 || !second.DownloadedAt.Equal(first.DownloadedAt) {
+		t.Errorf("fromCache = %v, archive = %q; want the cached zip kept", fromCache, archive())
+	}
+	if !second.CheckedAt.After(first.CheckedAt) {
+		t.Error("CheckedAt wasn't updated")
+	}
+	if entry, ok := readCacheEntry(cachePath, "slurm"); !ok || !entry.CheckedAt.Equal(second.CheckedAt) {
+		t.Errorf("the cache entry wasn't saved: %+v, %v", entry, ok)
+	}
+
+	// Once it's changed upstream, the new one replaces it.
+	server.update("PK second", `"v2"`)
+	third, fromCache, err := cachePlugin(context.Background(), scheduler, cachePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromCache || third.ETag != `"v2"` || third.SHA256 == first.SHA256 || archive() != "PK second" {
+		t.Errorf("fromCache = %v, ETag = %q, archive = %q; want the new one", fromCache, third.ETag, archive())
+	}
+
+	// A damaged archive isn't revalidated, since a 304 would keep it.
+	os.WriteFile(cachedArchivePath(cachePath, "slurm"), []byte("PK sec"), 0644)
+	if _, fromCache, err := cachePlugin(context.Background(), scheduler, cachePath, nil); err != nil || fromCache || archive() != "PK second" {
+		t.Errorf("fromCache = %v, archive = %q, %v; want it downloaded again", fromCache, archive(), err)
+	}
+
+	// A different ref is a different archive.
+	scheduler.Ref = "v2.0"
+	if _, fromCache, err := cachePlugin(context.Background(), scheduler, cachePath, nil); err != nil || fromCache {
+		t.Errorf("fromCache = %v, %v; want it downloaded for the new ref", fromCache, err)
+	}
+	if downloads, revalidated := server.counts(); downloads != 4 || revalidated != 1 {
+		t.Errorf("%d downloads and %d revalidations, want 4 and 1", downloads, revalidated)
+	}
+}
+
+func TestCachePluginWithoutAsking(t *testing.T) {
+	previousOffline := offline
+	t.Cleanup(func() { offline = previousOffline })
+
+	server := newPluginServer(t, "PK", `"v1"`)
+	cachePath := t.TempDir()
+	commit := strings.Repeat("a", 40)
+
+	offline = true
+	if _, _, err := cachePlugin(context.Background(), schedulerEntry{Name: "slurm", URL: server.URL}, cachePath, nil); err == nil || !strings.Contains(err.Error(), "isn't in the plugin cache") {
+		t.Errorf("cachePlugin offline with nothing cached = %v", err)
+	}
+
+	offline = false
+	for _, scheduler := range []schedulerEntry{{Name: "slurm", URL: server.URL}, {Name: "pbs", URL: server.URL, Ref: commit}} {
+		if _, _, err := cachePlugin(context.Background(), scheduler, cachePath, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Offline, or pinned to a commit, the cached archive is used without asking the server.
+	offline = true
+	if _, fromCache, err := cachePlugin(context.Background(), schedulerEntry{Name: "slurm", URL: server.URL}, cachePath, nil); err != nil || !fromCache {
+		t.Errorf("offline: fromCache = %v, %v", fromCache, err)
+	}
+	offline = false
+	if _, fromCache, err := cachePlugin(context.Background(), schedulerEntry{Name: "pbs", URL: server.URL, Ref: commit}, cachePath, nil); err != nil || !fromCache {
+		t.Errorf("pinned to a commit: fromCache = %v, %v", fromCache, err)
+	}
+	if downloads, revalidated := server.counts(); downloads != 2 || revalidated != 0 {
+		t.Errorf("%d downloads and %d revalidations, want 2 and none", downloads, revalidated)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	cachePath := t.TempDir()
+	files := []string{"plugins/slurm.zip", "plugins/slurm.json", "someone-else's.txt"}
+	for _, name := range files {
+		path := filepath.Join(cachePath, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := captureStdout(t, func() {
+		if err := clearCache(cachePath); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(output, "Cleared the plugin cache") {
+		t.Errorf("output = %q", output)
+	}
+	if _, err := os.Stat(pluginCacheFolder(cachePath)); !os.IsNotExist(err) {
+		t.Error("the plugins folder is still there")
+	}
+	if _, err := os.Stat(filepath.Join(cachePath, "someone-else's.txt")); err != nil {
+		t.Error("something outside the plugins folder was deleted")
+	}
+
+	output = captureStdout(t, func() {
+		if err := clearCache(cachePath); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(output, "already empty") {
+		t.Errorf("output = %q", output)
+	}
+}
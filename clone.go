@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Set by clonePlugins. Plugins that only have a GitHub repository are cloned rather than downloaded as a zip.
+var clonePlugins bool
+
+// Where to clone the plugin from, or "" if it's downloaded as a zip instead.
+func (entry schedulerEntry) cloneURL() string {
+	if entry.Clone != "" {
+		return entry.Clone
+	}
+	if clonePlugins && entry.URL == "" && entry.Repository != "" {
+		return "https://github.com/" + entry.Repository + ".git"
+	}
+	return ""
+}
+
+// Where the plugin comes from, whichever way it's fetched.
+func (entry schedulerEntry) source() string {
+	if cloneURL := entry.cloneURL(); cloneURL != "" {
+		return cloneURL
+	}
+	return entry.archiveURL()
+}
+
+// Shallow clones the scheduler's plugin at its ref and packs the checkout into archivePath, laid out like the zips
+// GitHub makes: everything inside the archive folder, with the commit as the zip's comment. That way the cache,
+// bundles and extraction treat both the same. The hash the remote gave for the ref is returned as the ETag, and if it
+// matches cached's, errNotModified is returned without cloning anything.
+func clonePlugin(ctx context.Context, scheduler schedulerEntry, archivePath string, cached downloadValidators) (downloadValidators, error) {
+	cloneURL := scheduler.cloneURL()
+
+	var auth transport.AuthMethod
+	if scheduler.CloneTokenSource != "" {
+		token, err := resolveSecret(scheduler.CloneTokenSource, cloneURL)
+		if err != nil {
+			return downloadValidators{}, &permanentError{fmt.Errorf("couldn't get the token to clone with: %w", err)}
+		}
+		// GitHub and GitLab both accept any username alongside a token.
+		auth = &githttp.BasicAuth{Username: "oauth2", Password: token.Reveal()}
+	}
+
+	ref := scheduler.Ref
+	if ref == "" {
+		ref = "main"
+	}
+
+	// Ask the remote what the ref points at first, so an unchanged plugin doesn't get cloned again.
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{cloneURL}})
+	remoteRefs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return downloadValidators{}, redactError(fmt.Errorf("couldn't list %s: %w", cloneURL, err))
+	}
+
+	cloneOptions := &git.CloneOptions{URL: cloneURL, Auth: auth, Depth: 1, SingleBranch: true, Tags: git.NoTags}
+	remoteHash, checkoutCommit := "", false
+	for _, remoteRef := range remoteRefs {
+		if remoteRef.Name() == plumbing.NewBranchReferenceName(ref) || remoteRef.Name() == plumbing.NewTagReferenceName(ref) {
+			remoteHash = remoteRef.Hash().String()
+			cloneOptions.ReferenceName = remoteRef.Name()
+			break
+		}
+	}
+
+	if remoteHash == "" {
+		if !commitSHAPattern.MatchString(ref) {
+			return downloadValidators{}, &permanentError{fmt.Errorf("%s has no branch or tag named %s", cloneURL, ref)}
+		}
+		// Servers won't usually give a shallow clone of an arbitrary commit, so this needs the whole history.
+		remoteHash, checkoutCommit = ref, true
+		cloneOptions.Depth = 0
+		cloneOptions.SingleBranch = false
+	}
+
+	if remoteHash == cached.ETag {
+		return cached, errNotModified
+	}
+
+	cloneFolder, err := os.MkdirTemp("", "isp-clone-")
+	if err != nil {
+		return downloadValidators{}, err
+	}
+	defer os.RemoveAll(cloneFolder)
+
+	repo, err := git.PlainCloneContext(ctx, cloneFolder, false, cloneOptions)
+	if err != nil {
+		return downloadValidators{}, redactError(fmt.Errorf("couldn't clone %s: %w", cloneURL, err))
+	}
+
+	// Cloning sets ReferenceName to HEAD when it's not given, so that can't be checked here.
+	if checkoutCommit {
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return downloadValidators{}, err
+		}
+		if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(ref)}); err != nil {
+			return downloadValidators{}, &permanentError{fmt.Errorf("couldn't check out %s: %w", ref, err)}
+		}
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return downloadValidators{}, err
+	}
+
+	if err := zipCheckout(cloneFolder, scheduler.ArchiveFolder, head.Hash().String(), archivePath); err != nil {
+		return downloadValidators{}, err
+	}
+	return downloadValidators{ETag: remoteHash}, nil
+}
+
+// Zips everything in cloneFolder but .git into archivePath, inside topFolder.
+func zipCheckout(cloneFolder, topFolder, commit, archivePath string) error {
+	archiveFile, err := os.CreateTemp(filepath.Dir(archivePath), filepath.Base(archivePath)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archiveFile.Name())
+	defer archiveFile.Close()
+
+	writer := zip.NewWriter(archiveFile)
+	if err := writer.SetComment(commit); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(cloneFolder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(cloneFolder, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(topFolder, relativePath))
+
+		if entry.IsDir() {
+			_, err := writer.Create(name + "/")
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return errors.New(relativePath + " isn't a regular file; symlinks and the like aren't supported in plugins")
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+
+		fileWriter, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(fileWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := archiveFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(archiveFile.Name(), archivePath)
+}
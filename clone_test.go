@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A bare repo with two commits on main, the first tagged v1, and the two commits' hashes.
+func pluginRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+	workPath, barePath := t.TempDir(), filepath.Join(t.TempDir(), "plugin.git")
+	gitRun := func(args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", workPath, "-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	gitRun("init", "-q", "-b", "main")
+	os.MkdirAll(filepath.Join(workPath, "scripts"), 0755)
+	os.WriteFile(filepath.Join(workPath, "README.md"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(workPath, "scripts", "submit.m"), []byte("% submit"), 0644)
+	gitRun("add", "-A")
+	gitRun("commit", "-q", "-m", "First")
+	gitRun("tag", "v1")
+	first := gitRun("rev-parse", "HEAD")
+
+	os.WriteFile(filepath.Join(workPath, "README.md"), []byte("v2"), 0644)
+	gitRun("commit", "-q", "-am", "Second")
+	second := gitRun("rev-parse", "HEAD")
+
+	gitRun("clone", "-q", "--bare", workPath, barePath)
+	return barePath, first, second
+}
+
+func TestClonePlugin(t *testing.T) {
+	barePath, first, second := pluginRepo(t)
+	cloneURL := "file://" + filepath.ToSlash(barePath)
+
+	tests := []struct {
+		name       string
+		ref        string
+		cached     string // The ETag from last time.
+		wantErr    string
+		wantETag   string
+		wantCommit string // What the archive was made from, or "" if it's left as it was.
+		wantREADME string
+	}{
+		{"main", "", "", "", second, second, "v2"},
+		{"main unchanged", "main", second, "not modified", second, "", ""},
+		{"main changed since", "main", first, "", second, second, "v2"},
+		{"tag", "v1", "", "", first, first, "v1"},
+		{"tag unchanged", "v1", first, "not modified", first, "", ""},
+		{"commit", first, "", "", first, first, "v1"},
+		{"commit unchanged", first, first, "not modified", first, "", ""},
+		{"no such ref", "nope", "", "has no branch or tag named nope", "", "", ""},
+	}
+	for _, test := range tests {
+		archivePath := filepath.Join(t.TempDir(), "plugin.zip")
+		os.WriteFile(archivePath, []byte("last time's"), 0644)
+		scheduler := schedulerEntry{Name: "slurm", Clone: cloneURL, Ref: test.ref, ArchiveFolder: "matlab-parallel-slurm-plugin-main"}
+
+		validators, err := clonePlugin(context.Background(), scheduler, archivePath, downloadValidators{ETag: test.cached})
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: clonePlugin failed: %v", test.name, err)
+			continue
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s: clonePlugin = %v, want an error saying %q", test.name, err, test.wantErr)
+			continue
+		}
+		if test.wantErr == "not modified" && !errors.Is(err, errNotModified) {
+			t.Errorf("%s: clonePlugin = %v, want errNotModified", test.name, err)
+		}
+		var permanent *permanentError
+		if test.name == "no such ref" && !errors.As(err, &permanent) {
+			t.Errorf("%s: a missing ref would be tried again: %v", test.name, err)
+		}
+		if validators.ETag != test.wantETag {
+			t.Errorf("%s: the ETag is %q, want %q", test.name, validators.ETag, test.wantETag)
+		}
+
+		if test.wantCommit == "" {
+			if content, _ := os.ReadFile(archivePath); string(content) != "last time's" {
+				t.Errorf("%s: the archive was replaced", test.name)
+			}
+			continue
+		}
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			t.Errorf("%s: the archive can't be read: %v", test.name, err)
+			continue
+		}
+		var names []string
+		for _, file := range reader.File {
+			names = append(names, file.Name)
+		}
+		slices.Sort(names)
+		wantNames := []string{"matlab-parallel-slurm-plugin-main/", "matlab-parallel-slurm-plugin-main/README.md", "matlab-parallel-slurm-plugin-main/scripts/", "matlab-parallel-slurm-plugin-main/scripts/submit.m"}
+		if reader.Comment != test.wantCommit || !slices.Equal(names, wantNames) {
+			t.Errorf("%s: the archive is from %q and has %q", test.name, reader.Comment, names)
+		}
+		if readme, err := reader.Open("matlab-parallel-slurm-plugin-main/README.md"); err == nil {
+			content := make([]byte, 8)
+			n, _ := readme.Read(content)
+			if string(content[:n]) != test.wantREADME {
+				t.Errorf("%s: README.md is %q, want %q", test.name, content[:n], test.wantREADME)
+			}
+			readme.Close()
+		}
+		reader.Close()
+		checkNoPartFiles(t, archivePath)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+type commandHelp struct {
+	name    string
+	summary string
+}
+
+var commands = []commandHelp{
+	{"create", "Make a new engagement, or add to an existing contact's. This is what runs without a command."},
+	{"add-cluster", "Add clusters to an existing engagement, numbered after the ones it already has."},
+	{"list", "List the existing engagements with their clusters, schedulers and releases."},
+	{"update", "Regenerate every cluster in an existing engagement for the release set by releaseNumber."},
+	{"push", "Commit an organization's local repo and push it to GitLab, creating the project if needed."},
+	{"doctor", "Check your settings, Git repo and plugins, and list anything that would stop an engagement being made."},
+	{"config show", "Show your settings and where each came from."},
+	{"cache status", "Show what's in the plugin cache."},
+	{"cache clear", "Delete the plugin cache."},
+	{"plugins prefetch", "Get every plugin in the scheduler catalogue into the cache."},
+	{"bundle export", "<bundle.zip>: Write every plugin to a bundle for machines without internet."},
+	{"bundle import", "<bundle.zip>: Copy a bundle's plugins into the cache."},
+}
+
+// Commands whose name is two words, such as "config show".
+var commandGroups = []string{"config", "cache", "plugins", "bundle"}
+
+func printUsage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprint(output, "Usage: integration-scripts-profiler [command] [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(output, "  %-17s %s\n", command.name, command.summary)
+	}
+	fmt.Fprint(output, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// Runs the commands that only deal with settings and plugins, rather than an engagement.
+func runToolCommand(ctx context.Context, command, bundlePath string, userSettings *settings, settingOrigins map[string]settingEntry) {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	switch command {
+	case "config show":
+		fmt.Print("\n")
+		showSettings(os.Stdout, userSettings, settingOrigins)
+	case "bundle export":
+		offline = userSettings.Offline
+		clonePlugins = userSettings.ClonePlugins
+		if err := configureHTTPClient(userSettings.CABundle); err != nil {
+			fail(failureSettings, "\nError loading your CA bundle: ", err)
+		}
+
+		// Make sure everything's current first. This is just a regular download into the cache.
+		cancellable.Store(true)
+		failures := downloadPlugins(ctx, schedulerCatalogue, userSettings.ScriptsPath, userSettings.CachePath, userSettings.DownloadWorkers)
+		cancellable.Store(false)
+		if ctx.Err() != nil || failures > 0 {
+			fail(failurePlugins, "\nEvery plugin is needed for the bundle. Exiting.")
+		}
+
+		if err := exportBundle(bundlePath, userSettings.CachePath, schedulerCatalogue); err != nil {
+			fail(failurePlugins, "\nError exporting the bundle: ", err)
+		}
+		logger.Info("bundle exported", "path", bundlePath, "plugins", len(schedulerCatalogue))
+		fmt.Print("\nExported ", len(schedulerCatalogue), " plugins to ", bundlePath, ". Run \"bundle import ", filepath.Base(bundlePath), "\" where they're needed, then use -offline.\n")
+	case "plugins prefetch":
+		// Gets every plugin in the catalogue, rather than just the ones an engagement uses, such as before going offline.
+		offline = userSettings.Offline
+		clonePlugins = userSettings.ClonePlugins
+		if err := configureHTTPClient(userSettings.CABundle); err != nil {
+			fail(failureSettings, "\nError loading your CA bundle: ", err)
+		}
+
+		cancellable.Store(true)
+		failures := downloadPlugins(ctx, schedulerCatalogue, userSettings.ScriptsPath, userSettings.CachePath, userSettings.DownloadWorkers)
+		cancellable.Store(false)
+		fmt.Print("\n")
+		if ctx.Err() != nil || failures > 0 {
+			exitRun(1)
+		}
+	case "bundle import":
+		imported, err := importBundle(bundlePath, userSettings.CachePath)
+		if err != nil {
+			fail(failurePlugins, "\nError importing the bundle: ", err)
+		}
+		fmt.Print("\nImported into ", pluginCacheFolder(userSettings.CachePath), ":\n")
+		for _, entry := range imported {
+			if _, ok := findScheduler(entry.Scheduler); !ok {
+				fmt.Print(redText(entry.Scheduler, " (not in your scheduler catalogue; add it to schedulers.yaml to use it)\n"))
+				logger.Warn("imported plugin isn't in the scheduler catalogue", "scheduler", entry.Scheduler, "path", bundlePath)
+				continue
+			}
+			fmt.Print(entry.Scheduler, "\n")
+		}
+	case "cache status", "cache clear":
+		fmt.Print("\n")
+		var err error
+		if command == "cache status" {
+			err = showCacheStatus(userSettings.CachePath)
+		} else {
+			err = clearCache(userSettings.CachePath)
+		}
+		if err != nil {
+			fail(failurePlugins, "\nError with the plugin cache: ", err)
+		}
+	}
+}
+
+// The original flow: ask about the organization, contact and clusters, then make and submit the engagement.
+func runCreate(ctx context.Context, rl *readline.Instance, spec *engagementSpec) {
+	if !offerResume(rl, spec, "create") {
+		return
+	}
+	if useWizard() && !runWizard(rl, spec, "create") {
+		return
+	}
+	if !promptOrganization(rl, spec, false) {
+		return
+	}
+	if submitToRemoteRepo && !checkRemoteProject(rl, spec) {
+		return
+	}
+	if gitRepoPath != "" && !promptContact(rl, spec, false) {
+		return
+	}
+	if !promptCaseNumber(rl, spec) {
+		return
+	}
+
+	clusters, ok := promptClusters(rl, spec, spec.Clusters, 1, nil)
+	if !ok {
+		return
+	}
+
+	// Now that we know which schedulers are being used, get only their plugins.
+	fetchEngagementPlugins(ctx, clusters)
+	probeClusters(ctx, clusters)
+	generateEngagement(clusters, true)
+	if submitToRemoteRepo {
+		submitEngagement()
+	}
+	finishRun()
+}
+
+// Adds clusters to an existing contact's engagement. The docs it already has are left alone.
+func runAddCluster(ctx context.Context, rl *readline.Instance, spec *engagementSpec) {
+	if !offerResume(rl, spec, "add-cluster") {
+		return
+	}
+	if gitRepoPath != "" && useWizard() && !runWizard(rl, spec, "add-cluster") {
+		return
+	}
+	record := openEngagement(rl, spec, "add-cluster")
+	if record == nil {
+		return
+	}
+
+	var takenNames []string
+	for _, cluster := range record.Clusters {
+		takenNames = append(takenNames, cluster.Name)
+	}
+	clusters, ok := promptClusters(rl, spec, spec.Clusters, len(record.Clusters)+1, takenNames)
+	if !ok {
+		return
+	}
+
+	fetchEngagementPlugins(ctx, clusters)
+	probeClusters(ctx, clusters)
+	generateEngagement(clusters, false)
+	if submitToRemoteRepo {
+		submitEngagement()
+	}
+	finishRun()
+}
+
+// Regenerates every cluster an engagement has a record of, such as for a new release.
+func runUpdate(ctx context.Context, rl *readline.Instance, spec *engagementSpec) {
+	if releaseNumber == "" {
+		fail(failureSettings, "\nSet releaseNumber to the release to update to, such as with -releaseNumber R2024b.")
+	}
+
+	if !offerResume(rl, spec, "update") {
+		return
+	}
+	record := openEngagement(rl, spec, "update")
+	if record == nil {
+		return
+	}
+	if len(record.Clusters) == 0 {
+		fail(failureInput, "\n", filepath.Join(organizationPath, organizationContact, engagementRecordName), " doesn't have any clusters to update.")
+	}
+
+	// -cluster, or the spec's clusters, can change a recorded cluster's answers, such as its MATLAB root for the new
+	// release. A recorded root that's for another release is asked for again.
+	clusters := slices.Clone(record.Clusters)
+	for _, given := range spec.Clusters {
+		index := slices.IndexFunc(clusters, func(cluster clusterSpec) bool { return strings.EqualFold(cluster.Name, given.Name) })
+		if index == -1 {
+			fail(failureInput, "\n", filepath.Join(organizationPath, organizationContact, engagementRecordName), " has no cluster named \"", given.Name, "\" to update.")
+		}
+		clusters[index].override(given)
+	}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if matlabRootWarning(cluster.MatlabRoot) == "" {
+			continue
+		}
+		fmt.Print("\n", cluster.Name, "'s MATLAB root was ", cluster.MatlabRoot, ". Enter the one for ", releaseNumber, ", such as ", matlabRootForRelease(cluster.MatlabRoot, releaseNumber), ".\n")
+		cluster.MatlabRoot = ""
+	}
+
+	// The rest of the recorded answers are checked the same way the spec's are, so they shouldn't need asking for.
+	clusters, ok := promptClusters(rl, spec, clusters, 1, nil)
+	if !ok {
+		return
+	}
+
+	fetchEngagementPlugins(ctx, clusters)
+	probeClusters(ctx, clusters)
+	generateEngagement(clusters, true)
+	if submitToRemoteRepo {
+		submitEngagement()
+	}
+	finishRun()
+}
+
+// Asks for an existing organization and contact, and returns the contact's engagement record. Returns nil if the user
+// interrupted.
+func openEngagement(rl *readline.Instance, spec *engagementSpec, command string) *engagementSpec {
+	if gitRepoPath == "" {
+		fail(failureSettings, "\n", command, " needs gitRepoPath set to where your engagements are.")
+	}
+
+	if !promptOrganization(rl, spec, true) {
+		return nil
+	}
+	if submitToRemoteRepo && !checkRemoteProject(rl, spec) {
+		return nil
+	}
+	if !promptContact(rl, spec, true) {
+		return nil
+	}
+
+	organizationContactPath := filepath.Join(organizationPath, organizationContact)
+	record, err := readEngagementRecord(organizationContactPath)
+	if err != nil {
+		fail(failureInput, "\nError reading the engagement record: ", err)
+	}
+	if record == nil {
+		// Engagements made before records were written can still be added to, though update won't know their clusters.
+		record = &engagementSpec{}
+		if command == "update" {
+			fail(failureInput, "\n", organizationContactPath, " has no ", engagementRecordName, ", so its clusters aren't known. Recreate it with create instead.")
+		}
+	}
+
+	// Keep the record's answers unless they've been given again.
+	if organizationAbbreviation == "" && record.Abbreviation != nil {
+		organizationAbbreviation = *record.Abbreviation
+	}
+	if spec.CaseNumber != nil {
+		caseNumber = *spec.CaseNumber
+	} else if record.CaseNumber != nil {
+		caseNumber = *record.CaseNumber
+	}
+	return record
+}
+
+// Commits and pushes an organization's local repo.
+func runPush(rl *readline.Instance, spec *engagementSpec) {
+	if !submitToRemoteRepo {
+		fail(failureSettings, "\nThere's nothing to push to while offline.")
+	}
+	if gitRepoPath == "" {
+		fail(failureSettings, "\npush needs gitRepoPath set to where your engagements are.")
+	}
+
+	if !promptOrganization(rl, spec, true) {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(organizationPath, ".git")); err != nil {
+		fail(failureGit, "\n", organizationPath, " isn't a Git repo yet. Make an engagement in it with create first.")
+	}
+	if !checkRemoteProject(rl, spec) {
+		return
+	}
+
+	submitEngagement()
+	finishRun()
+}
+
+// Prints every engagement in gitRepoPath, with each contact's clusters and the releases it has scripts for.
+func listEngagements() {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	if gitRepoPath == "" {
+		fail(failureSettings, "\nlist needs gitRepoPath set to where your engagements are.")
+	}
+
+	customerEngagementsPath := filepath.Join(gitRepoPath, "Customer-Engagements")
+	organizations := visibleFolders(customerEngagementsPath)
+	if len(organizations) == 0 {
+		fmt.Print("\nThere are no engagements in ", customerEngagementsPath, "\n")
+		return
+	}
+
+	fmt.Print("\n")
+	for _, organization := range organizations {
+		fmt.Print(organization, "\n")
+		organizationFolder := filepath.Join(customerEngagementsPath, organization)
+		for _, contact := range visibleFolders(organizationFolder) {
+			contactPath := filepath.Join(organizationFolder, contact)
+
+			var releases []string
+			for _, scheduler := range visibleFolders(filepath.Join(contactPath, "scripts")) {
+				for _, release := range visibleFolders(filepath.Join(contactPath, "scripts", scheduler)) {
+					if !slices.Contains(releases, release) {
+						releases = append(releases, release)
+					}
+				}
+			}
+			slices.Sort(releases)
+
+			fmt.Print("  ", contact)
+			if len(releases) > 0 {
+				fmt.Print(" (", strings.Join(releases, ", "), ")")
+			}
+			fmt.Print("\n")
+
+			record, err := readEngagementRecord(contactPath)
+			switch {
+			case err != nil:
+				fmt.Print(redText("    Error reading ", engagementRecordName, ": ", err, "\n"))
+				logger.Warn("engagement record couldn't be read", "org", organization, "contact", contact, "path", contactPath, "error", err)
+			case record == nil:
+				fmt.Print("    No ", engagementRecordName, ", so its clusters aren't known.\n")
+			default:
+				for _, cluster := range record.Clusters {
+					fmt.Print("    ", cluster.Name, ": ", cluster.Scheduler, "\n")
+				}
+			}
+		}
+	}
+}
+
+// The folders in path, leaving out hidden ones like .git. A missing path just has none.
+func visibleFolders(path string) []string {
+	var folders []string
+	entries, _ := os.ReadDir(path)
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			folders = append(folders, entry.Name())
+		}
+	}
+	return folders
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+func TestUpdateUsesEngagementRemote(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	workingDir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(workingDir) })
+
+	gitRepo := t.TempDir()
+	writeSettingsFile(t, filepath.Join(configDir, "integration-scripts-profiler"), `gitRepoPath = `+gitRepo+`
+gitRepoAPIURL = https://gitlab.com/api/v4/projects/
+gitGroupID = 1
+submitToRemoteRepo = false
+downloadScriptsOnLaunch = false
+remote.internal.gitRepoAPIURL = https://git.example.org/api/v4/projects/
+remote.internal.gitGroupID = 42
+`)
+	userSettings := settings{}
+	origins, err := loadLayeredSettings(&userSettings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := []any{activeSettings, gitRepoPath, gitRepoAPIURL, gitGroupID, organizationSelected, organizationContact, organizationPath}
+	t.Cleanup(func() {
+		activeSettings, gitRepoPath, gitRepoAPIURL, gitGroupID = saved[0].(settings), saved[1].(string), saved[2].(string), saved[3].(int)
+		organizationSelected, organizationContact, organizationPath = saved[4].(string), saved[5].(string), saved[6].(string)
+	})
+
+	// create, with the engagement spec choosing the internal remote.
+	setupSession(&engagementSpec{Remote: "internal"}, &userSettings, origins, true)
+	organizationSelected, organizationContact = "Acme-Labs", "jane-doe"
+	contactPath := filepath.Join(gitRepo, "Customer-Engagements", "Acme-Labs", "jane-doe")
+	if err := os.MkdirAll(contactPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateEngagementRecord(contactPath, []clusterSpec{{Name: "Hopper", Scheduler: "slurm"}}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := readEngagementRecord(contactPath)
+	if err != nil || record.Remote != "internal" {
+		t.Fatalf("the record's remote is %+v, %v; want internal", record, err)
+	}
+
+	// update, without saying which remote.
+	setupSession(&engagementSpec{}, &userSettings, origins, true)
+	if gitRepoAPIURL != "https://gitlab.com/api/v4/projects/" {
+		t.Fatalf("gitRepoAPIURL = %q before the engagement was opened", gitRepoAPIURL)
+	}
+	rl, err := readline.NewEx(&readline.Config{Stdin: io.NopCloser(strings.NewReader("")), Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Not closed: nothing's read from it, and readline's Close races with its reader starting up when nothing has been.
+	var opened *engagementSpec
+	captureStdout(t, func() {
+		opened = openEngagement(rl, &engagementSpec{Organization: "Acme-Labs", Contact: "jane-doe"}, "update")
+	})
+	if opened == nil || len(opened.Clusters) != 1 {
+		t.Fatalf("openEngagement = %+v", opened)
+	}
+	if activeSettings.Remote != "internal" || gitRepoAPIURL != "https://git.example.org/api/v4/projects/" || gitGroupID != 42 {
+		t.Errorf("update used remote %q, %s and group %d; want the internal remote's", activeSettings.Remote, gitRepoAPIURL, gitGroupID)
+	}
+
+	// Writing the record again keeps it.
+	if err := updateEngagementRecord(contactPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := readEngagementRecord(contactPath); record.Remote != "internal" {
+		t.Errorf("the rewritten record's remote is %q", record.Remote)
+	}
+}
+
+func TestEngagementRemote(t *testing.T) {
+	tests := []struct {
+		current  string
+		chosenBy string
+		recorded string
+		want     string
+		error    string
+	}{
+		{"", "", "", "", ""},
+		{"", "", "internal", "internal", ""},
+		{"public", "", "internal", "internal", ""},
+		{"internal", "-remote", "internal", "internal", ""},
+		{"public", "-remote", "", "public", ""},
+		{"public", "-remote", "internal", "", `made with the remote profile "internal", but -remote chose the remote profile "public". Use -remote internal`},
+		{"", "the engagement spec", "internal", "", "but the engagement spec chose no remote profile"},
+	}
+	for _, test := range tests {
+		got, err := engagementRemote(test.current, test.chosenBy, test.recorded)
+		if test.error == "" {
+			if err != nil || got != test.want {
+				t.Errorf("engagementRemote(%q, %q, %q) = %q, %v; want %q", test.current, test.chosenBy, test.recorded, got, err, test.want)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("engagementRemote(%q, %q, %q) = %q, %v; want an error saying %q", test.current, test.chosenBy, test.recorded, got, err, test.error)
+		}
+	}
+}
+
+func TestRecordedEngagementRemote(t *testing.T) {
+	organizationPath := t.TempDir()
+	writeRecord := func(contact, remote string) {
+		contactPath := filepath.Join(organizationPath, contact)
+		os.MkdirAll(contactPath, 0755)
+		if err := writeEngagementRecord(contactPath, &engagementSpec{Contact: contact, Remote: remote}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Contacts without a record, or without a remote in it, don't count.
+	os.Mkdir(filepath.Join(organizationPath, "no-record"), 0755)
+	writeRecord("older", "")
+	writeRecord("jane-doe", "internal")
+	if got, err := recordedEngagementRemote(organizationPath); err != nil || got != "internal" {
+		t.Errorf("recordedEngagementRemote = %q, %v; want internal", got, err)
+	}
+
+	writeRecord("john-doe", "public")
+	if _, err := recordedEngagementRemote(organizationPath); err == nil || !strings.Contains(err.Error(), "different remote profiles") {
+		t.Errorf("recordedEngagementRemote with two remotes = %v", err)
+	}
+}
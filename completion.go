@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	"github.com/xanzy/go-gitlab"
+)
+
+// Completes engagement and contact names on Tab. Matching ignores case and is fuzzy, so "acl" finds "Acme-Labs". A
+// single match replaces what's been typed. Several are listed best first, with their hints.
+//
+// readline can only add to the line from Do, so a completion that changes what's been typed, such as its case, is
+// made by OnChange once readline's finished with the Tab. The list is printed then too.
+type FolderCompleter struct {
+	Folders []completionCandidate
+
+	// Gets the rest of the candidates the first time Tab is pressed, so that hints and GitLab projects are only looked
+	// up if they're wanted.
+	More func() []completionCandidate
+
+	rl       *readline.Instance
+	moreOnce sync.Once
+
+	// Shows the list of candidates after a Tab. Without it, they're printed above the prompt.
+	list func(candidates string)
+
+	// What the last Tab should replace the line with and list, for OnChange.
+	replacement string
+	listed      []completionCandidate
+}
+
+// A name to complete and what's shown next to it when there's a choice.
+type completionCandidate struct {
+	Name string
+	Hint string
+}
+
+// How many candidates are listed at once.
+const maxListedCandidates = 10
+
+func newFolderCompleter(rl *readline.Instance, candidates func() []completionCandidate) *FolderCompleter {
+	return &FolderCompleter{More: candidates, rl: rl}
+}
+
+// Completes names in rl with candidates from now on.
+func useFolderCompleter(rl *readline.Instance, candidates func() []completionCandidate) {
+	completer := newFolderCompleter(rl, candidates)
+	rl.Config.AutoComplete = completer
+	rl.Config.Listener = completer
+}
+
+// Stops completing in rl.
+func stopCompleting(rl *readline.Instance) {
+	rl.Config.AutoComplete = nil
+	rl.Config.Listener = nil
+}
+
+func (f *FolderCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	f.moreOnce.Do(func() {
+		if f.More != nil {
+			f.Folders = append(f.Folders, f.More()...)
+		}
+	})
+	f.replacement, f.listed = "", nil
+
+	typed := string(line[:pos]) // Ensure we're only considering the part of the line up to the cursor.
+	matches := rankCandidates(typed, f.Folders)
+	if len(matches) == 0 {
+		return nil, 0
+	}
+
+	// What's typed becomes the only match or, when there are several, is filled out as far as the names it starts
+	// agree, in their case.
+	completion := matches[0].Name
+	if len(matches) > 1 {
+		f.listed = matches
+		completion = ""
+		var startingWith []completionCandidate
+		for _, match := range matches {
+			if strings.HasPrefix(strings.ToLower(match.Name), strings.ToLower(typed)) {
+				startingWith = append(startingWith, match)
+			}
+		}
+		if len(startingWith) > 0 {
+			if prefix := commonPrefix(startingWith); len(prefix) >= len(typed) {
+				completion = prefix
+			}
+		}
+	}
+
+	switch {
+	case completion == "" || completion == typed:
+		return nil, 0
+	case strings.HasPrefix(completion, typed):
+		return [][]rune{[]rune(completion[len(typed):])}, len([]rune(typed))
+	default:
+		f.replacement = completion
+		return nil, 0
+	}
+}
+
+// Called by readline after every key. After a Tab, it lists the matches Do found and replaces the line if the
+// completion has to change what was typed.
+func (f *FolderCompleter) OnChange(line []rune, pos int, key rune) (newLine []rune, newPos int, ok bool) {
+	if key != readline.CharTab {
+		return nil, 0, false
+	}
+	replacement, listed := f.replacement, f.listed
+	f.replacement, f.listed = "", nil
+
+	if len(listed) > 0 && f.list != nil {
+		f.list(candidateList(listed))
+	} else if len(listed) > 0 && f.rl != nil {
+		// Written through readline so the prompt is drawn again underneath.
+		fmt.Fprint(f.rl.Stdout(), candidateList(listed))
+	}
+	if replacement == "" {
+		return nil, 0, false
+	}
+	return []rune(replacement), len([]rune(replacement)), true
+}
+
+// The candidates as they're listed, with their hints.
+func candidateList(candidates []completionCandidate) string {
+	faintText := color.New(color.Faint).SprintFunc()
+	width := 0
+	for _, candidate := range candidates[:min(len(candidates), maxListedCandidates)] {
+		width = max(width, len(candidate.Name))
+	}
+	var list strings.Builder
+	for _, candidate := range candidates[:min(len(candidates), maxListedCandidates)] {
+		fmt.Fprintf(&list, "  %-*s  %s\n", width, candidate.Name, faintText(candidate.Hint))
+	}
+	if len(candidates) > maxListedCandidates {
+		fmt.Fprintf(&list, "  %s\n", faintText("and ", len(candidates)-maxListedCandidates, " more"))
+	}
+	return list.String()
+}
+
+// The candidates typed matches, best first.
+func rankCandidates(typed string, candidates []completionCandidate) []completionCandidate {
+	type scored struct {
+		candidate completionCandidate
+		score     int
+	}
+	var matches []scored
+	for _, candidate := range candidates {
+		if score := fuzzyScore(typed, candidate.Name); score > 0 && !slices.ContainsFunc(matches, func(m scored) bool { return strings.EqualFold(m.candidate.Name, candidate.Name) }) {
+			matches = append(matches, scored{candidate, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return strings.ToLower(matches[i].candidate.Name) < strings.ToLower(matches[j].candidate.Name)
+	})
+
+	ranked := make([]completionCandidate, len(matches))
+	for i, match := range matches {
+		ranked[i] = match.candidate
+	}
+	return ranked
+}
+
+// How well typed matches name, ignoring case and treating spaces as dashes like the folder names do. Higher is
+// better and 0 is no match. Being the whole name beats being the start of it, which beats being somewhere in it, which
+// beats just having its letters in the same order.
+func fuzzyScore(typed, name string) int {
+	typed = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(typed), " ", "-"))
+	name = strings.ToLower(name)
+
+	switch {
+	case typed == "":
+		return 1
+	case name == typed:
+		return 4000
+	case strings.HasPrefix(name, typed):
+		return 3000 - len(name)
+	case strings.Contains(name, typed):
+		return 2000 - 10*strings.Index(name, typed) - len(name)
+	}
+
+	// The letters in order, preferring them closer together.
+	position, gaps := 0, 0
+	for i, r := range typed {
+		index := strings.IndexRune(name[position:], r)
+		if index < 0 {
+			return 0
+		}
+		if i > 0 {
+			gaps += index
+		}
+		position += index + len(string(r))
+	}
+	return max(1000-10*gaps-len(name), 1)
+}
+
+// The start all the candidates share, ignoring case, as the first one has it.
+func commonPrefix(candidates []completionCandidate) string {
+	prefix := []rune(candidates[0].Name)
+	for _, candidate := range candidates[1:] {
+		name := []rune(candidate.Name)
+		length := 0
+		for length < len(prefix) && length < len(name) && strings.EqualFold(string(prefix[length]), string(name[length])) {
+			length++
+		}
+		prefix = prefix[:length]
+	}
+	return string(prefix)
+}
+
+// What's known about an engagement, or all of an organization's, for the hints.
+type engagementSummary struct {
+	contacts    int
+	clusters    int
+	schedulers  []string
+	release     string
+	releaseTime time.Time
+}
+
+// Adds the contact at contactPath to the summary, from its engagement record and the releases it has scripts for.
+func (summary *engagementSummary) add(contactPath string) {
+	summary.contacts++
+	if record, err := readEngagementRecord(contactPath); err == nil && record != nil {
+		summary.clusters += len(record.Clusters)
+		for _, cluster := range record.Clusters {
+			if !slices.Contains(summary.schedulers, cluster.Scheduler) {
+				summary.schedulers = append(summary.schedulers, cluster.Scheduler)
+			}
+		}
+	}
+
+	for _, scheduler := range visibleFolders(filepath.Join(contactPath, "scripts")) {
+		for _, release := range visibleFolders(filepath.Join(contactPath, "scripts", scheduler)) {
+			info, err := os.Stat(filepath.Join(contactPath, "scripts", scheduler, release))
+			if err == nil && info.ModTime().After(summary.releaseTime) {
+				summary.release = release
+				summary.releaseTime = info.ModTime()
+			}
+		}
+	}
+}
+
+func (summary engagementSummary) hint(includeContacts bool) string {
+	var parts []string
+	if includeContacts {
+		parts = append(parts, plural(summary.contacts, "contact"))
+	}
+	clusters := plural(summary.clusters, "cluster")
+	if len(summary.schedulers) > 0 {
+		clusters += " (" + strings.Join(summary.schedulers, ", ") + ")"
+	}
+	parts = append(parts, clusters)
+	if summary.release != "" {
+		parts = append(parts, "last modified "+summary.release)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprint(count, " ", noun)
+	}
+	return fmt.Sprint(count, " ", noun, "s")
+}
+
+// The organizations in gitRepoPath, with how many contacts and clusters each has.
+func organizationCandidates() []completionCandidate {
+	// Otherwise it'd list whatever's in the current directory.
+	if gitRepoPath == "" {
+		return nil
+	}
+
+	var candidates []completionCandidate
+	customerEngagementsPath := filepath.Join(gitRepoPath, "Customer-Engagements")
+	for _, organization := range visibleFolders(customerEngagementsPath) {
+		var summary engagementSummary
+		for _, contact := range visibleFolders(filepath.Join(customerEngagementsPath, organization)) {
+			summary.add(filepath.Join(customerEngagementsPath, organization, contact))
+		}
+		candidates = append(candidates, completionCandidate{Name: organization, Hint: summary.hint(true)})
+	}
+	return candidates
+}
+
+// The contacts in organizationFolder, with their clusters.
+func contactCandidates(organizationFolder string) []completionCandidate {
+	var candidates []completionCandidate
+	for _, contact := range visibleFolders(organizationFolder) {
+		var summary engagementSummary
+		summary.add(filepath.Join(organizationFolder, contact))
+		candidates = append(candidates, completionCandidate{Name: contact, Hint: summary.hint(false)})
+	}
+	return candidates
+}
+
+// The projects in your GitLab group that aren't in gitRepoPath, when submitting to GitLab. Any problem getting them
+// just means there aren't any, since it's only for completion.
+func remoteOrganizationCandidates() []completionCandidate {
+	if !submitToRemoteRepo || offline || accessToken == "" || gitGroupID == 0 {
+		return nil
+	}
+
+	git, err := gitlab.NewClient(accessToken.Reveal(), gitlab.WithBaseURL(gitLabAPIBaseURL(gitRepoAPIURL)), gitlab.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil
+	}
+
+	localOrganizations := visibleFolders(filepath.Join(gitRepoPath, "Customer-Engagements"))
+	var candidates []completionCandidate
+	options := &gitlab.ListGroupProjectsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}, Simple: gitlab.Ptr(true)}
+	for {
+		projects, response, err := git.Groups.ListGroupProjects(gitGroupID, options)
+		if err != nil {
+			logger.Warn("GitLab projects couldn't be listed for completion", "group", gitGroupID, "error", redactError(err))
+			return candidates
+		}
+		for _, project := range projects {
+			if !slices.ContainsFunc(localOrganizations, func(local string) bool { return strings.EqualFold(local, project.Name) }) {
+				candidates = append(candidates, completionCandidate{Name: project.Name, Hint: "on GitLab, not in gitRepoPath yet"})
+			}
+		}
+		if response.NextPage == 0 {
+			return candidates
+		}
+		options.Page = response.NextPage
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	// Each is a better match for what's typed than the next, and the last isn't one at all.
+	tests := []struct {
+		typed string
+		names []string
+	}{
+		{"acme-labs", []string{"Acme-Labs", "Acme-Labs-West", "Old-Acme-Labs", "Acme-Robotics-Labs", "Globex"}},
+		{"ACME", []string{"acme", "Acme-Labs", "Acme-Robotics", "Big-Acme", "Zeta-Camel", "Globex"}},
+		{"acme labs", []string{"Acme-Labs", "Acme-Labs-West", "Acme-Robotics-Labs", "Globex"}},
+		{"aclb", []string{"Acme-Labs", "Acme-Robotics-Labs", "Zeta-Camel"}},
+		{"zc", []string{"Zeta-Camel", "Zeta-Industries-Camel", "Acme-Labs"}},
+	}
+	for _, test := range tests {
+		for i := 1; i < len(test.names); i++ {
+			better, worse := fuzzyScore(test.typed, test.names[i-1]), fuzzyScore(test.typed, test.names[i])
+			if better <= worse {
+				t.Errorf("fuzzyScore(%q): %s scored %d, not more than %s's %d", test.typed, test.names[i-1], better, test.names[i], worse)
+			}
+		}
+		if last := test.names[len(test.names)-1]; fuzzyScore(test.typed, last) != 0 {
+			t.Errorf("fuzzyScore(%q, %q) = %d, want no match", test.typed, last, fuzzyScore(test.typed, last))
+		}
+	}
+
+	if fuzzyScore("", "Acme-Labs") != 1 {
+		t.Error("nothing typed doesn't match everything")
+	}
+	if fuzzyScore("ACME-labs", "Acme-Labs") != fuzzyScore("acme-labs", "acme-labs") {
+		t.Error("fuzzyScore doesn't ignore case")
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	candidates := []completionCandidate{{Name: "Zeta-Camel"}, {Name: "Acme-Robotics"}, {Name: "Acme-Labs"}, {Name: "Globex"}, {Name: "acme-labs"}}
+	var names []string
+	for _, candidate := range rankCandidates("acme", candidates) {
+		names = append(names, candidate.Name)
+	}
+	if want := []string{"Acme-Labs", "Acme-Robotics", "Zeta-Camel"}; !slices.Equal(names, want) {
+		t.Errorf("rankCandidates = %v, want %v", names, want)
+	}
+}
+
+func TestFolderCompleter(t *testing.T) {
+	folders := []completionCandidate{{Name: "Acme-Labs"}, {Name: "Acme-Robotics"}, {Name: "Zeta-Camel"}, {Name: "Globex"}}
+	tests := []struct {
+		typed       string
+		added       string // What Do has readline add to the line.
+		replacement string // What OnChange replaces the line with.
+		listed      int
+	}{
+		{"Glo", "bex", "", 0},
+		{"Acme-R", "obotics", "", 0},
+		{"Acme", "-", "", 3},
+		{"globex", "", "Globex", 0},
+		{"acme", "", "Acme-", 3},
+		{"ROBO", "", "Acme-Robotics", 0},
+		{"zc", "", "Zeta-Camel", 0},
+		{"Globex", "", "", 0},
+		{"Acme-", "", "", 2},
+		{"Initech", "", "", 0},
+	}
+	for _, test := range tests {
+		completer := newFolderCompleter(nil, func() []completionCandidate { return folders })
+		newLine, length := completer.Do([]rune(test.typed), len(test.typed))
+
+		added := ""
+		if len(newLine) == 1 {
+			added = string(newLine[0])
+			if length != len(test.typed) {
+				t.Errorf("Do(%q) shares %d letters with the line, want %d", test.typed, length, len(test.typed))
+			}
+		} else if len(newLine) > 1 {
+			t.Errorf("Do(%q) gave readline %d candidates to choose from", test.typed, len(newLine))
+		}
+		if added != test.added {
+			t.Errorf("Do(%q) adds %q, want %q", test.typed, added, test.added)
+		}
+		if len(completer.listed) != test.listed {
+			t.Errorf("Do(%q) lists %d names, want %d", test.typed, len(completer.listed), test.listed)
+		}
+
+		line, pos, ok := completer.OnChange([]rune(test.typed+added), len(test.typed+added), readline.CharTab)
+		if ok != (test.replacement != "") || string(line) != test.replacement || pos != len(test.replacement) {
+			t.Errorf("after Do(%q), OnChange = %q, %d, %v; want %q", test.typed, string(line), pos, ok, test.replacement)
+		}
+		if completer.replacement != "" || completer.listed != nil {
+			t.Errorf("after Do(%q), OnChange left a completion for the next Tab", test.typed)
+		}
+	}
+
+	// Only a Tab makes a completion.
+	completer := newFolderCompleter(nil, func() []completionCandidate { return folders })
+	completer.Do([]rune("zc"), 2)
+	if _, _, ok := completer.OnChange([]rune("zcx"), 3, 'x'); ok {
+		t.Error("OnChange replaced the line after a key other than Tab")
+	}
+}
+
+func TestOrganizationCandidates(t *testing.T) {
+	previousPath := gitRepoPath
+	t.Cleanup(func() { gitRepoPath = previousPath })
+
+	// With no repo path, the current directory's Customer-Engagements isn't listed.
+	workingDirectory, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(workingDirectory) })
+	current := t.TempDir()
+	os.MkdirAll(filepath.Join(current, "Customer-Engagements", "Stray-Org"), 0755)
+	os.Chdir(current)
+	gitRepoPath = ""
+	if candidates := organizationCandidates(); candidates != nil {
+		t.Errorf("organizationCandidates with no repo path = %v", candidates)
+	}
+
+	gitRepoPath = t.TempDir()
+	os.MkdirAll(filepath.Join(gitRepoPath, "Customer-Engagements", "Acme-Labs", "jane-doe"), 0755)
+	if candidates := organizationCandidates(); len(candidates) != 1 || candidates[0].Name != "Acme-Labs" {
+		t.Errorf("organizationCandidates = %v", candidates)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// The token scope needed to create projects and push to them.
+const requiredTokenScope = "api"
+
+// Checks for everything that would stop an engagement from being made, and lists every problem found at once. The
+// spec's schedulers are checked if it has any clusters, otherwise every scheduler in the catalogue is.
+func runDoctor(spec *engagementSpec) {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	var problems []string
+	problem := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	schedulers := schedulerCatalogue
+	if len(spec.Clusters) > 0 {
+		schedulers = nil
+		for _, cluster := range spec.Clusters {
+			name, err := parseScheduler(cluster.Scheduler)
+			if err != nil {
+				problem("%s's scheduler isn't in the catalogue. %v", cluster.Name, err)
+				continue
+			}
+			scheduler, _ := findScheduler(name)
+			if !slices.ContainsFunc(schedulers, func(s schedulerEntry) bool { return s.Name == scheduler.Name }) {
+				schedulers = append(schedulers, scheduler)
+			}
+		}
+	}
+
+	// setupSession forgets a gitRepoPath that doesn't exist, so use the setting itself.
+	switch {
+	case activeSettings.GitRepoPath == "":
+		problem("gitRepoPath isn't set, so there's nowhere to make engagements.")
+	case gitRepoPath == "":
+		problem("gitRepoPath (%s) doesn't exist.", activeSettings.GitRepoPath)
+	default:
+		// The plugins only need to be there already if they won't be downloaded.
+		problems = append(problems, missingEngagementFiles(schedulers, !downloadScriptsOnLanuch, true)...)
+	}
+
+	for _, folder := range []struct{ setting, path string }{{"scriptsPath", scriptsPath}, {"cachePath", activeSettings.CachePath}} {
+		if err := checkWritable(folder.path); err != nil {
+			problem("%s (%s) isn't writable: %v", folder.setting, folder.path, err)
+		}
+	}
+
+	if gitUsername == "" || gitEmailAddress == "" {
+		problem("gitUsername and gitEmailAddress need to be set for commits to be made.")
+	}
+
+	// Without a connection, every plugin has to be in the cache already.
+	if offline && downloadScriptsOnLanuch {
+		for _, scheduler := range schedulers {
+			if _, ok := readCacheEntry(activeSettings.CachePath, scheduler.Name); !ok {
+				problem("%s isn't in the plugin cache, and it can't be downloaded while offline.", scheduler.Name)
+			}
+		}
+	}
+
+	if submitToRemoteRepo && !offline {
+		problems = append(problems, gitLabProblems()...)
+	}
+
+	if len(problems) == 0 {
+		fmt.Print("\nNo problems found.\n")
+		return
+	}
+	fmt.Print(redText("\nFound ", len(problems), " problem(s):\n"))
+	for _, p := range problems {
+		fmt.Print(redText("- ", p, "\n"))
+		logger.Warn("doctor found a problem", "problem", p)
+	}
+	exitRun(1)
+}
+
+// Run before generating, so that a missing file is found before anything is copied rather than halfway through. A dry
+// run just warns about them.
+func checkBeforeGenerating(clusters []clusterSpec, includeEngagementFiles bool) {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	// A dry run doesn't download anything, so its plugins may not be there yet.
+	problems := missingEngagementFiles(clusterSchedulers(clusters), !dryRun || !downloadScriptsOnLanuch, includeEngagementFiles)
+
+	// Commits are made when the local repo is created and when submitting.
+	_, err := os.Stat(filepath.Join(organizationPath, ".git"))
+	if (os.IsNotExist(err) || submitToRemoteRepo) && (gitUsername == "" || gitEmailAddress == "") {
+		problems = append(problems, "gitUsername and gitEmailAddress need to be set for commits to be made.")
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+
+	if dryRun {
+		fmt.Print(redText("\nThis run would fail. Found ", len(problems), " problem(s):\n"))
+	} else {
+		fmt.Print(redText("\nNothing has been changed, as these need fixing first:\n"))
+	}
+	for _, p := range problems {
+		fmt.Print(redText("- ", p, "\n"))
+		logger.Error("prerequisite missing", "org", organizationSelected, "contact", organizationContact, "problem", p, "dryRun", dryRun)
+		reportFailure(failurePrerequisites, p)
+	}
+	if !dryRun {
+		exitRun(1)
+	}
+}
+
+// Lists every file and folder the copy tasks would read for the schedulers that isn't there. The extracted plugins
+// are only checked with includePlugins, and the docs every engagement gets with includeEngagementFiles.
+func missingEngagementFiles(schedulers []schedulerEntry, includePlugins, includeEngagementFiles bool) []string {
+	var problems []string
+
+	if releaseNumber == "" {
+		problems = append(problems, "releaseNumber isn't set, so there's no Gold folder to use.")
+	}
+
+	missing := func(path, what string) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if relativePath, err := filepath.Rel(gitRepoPath, path); err == nil && filepath.IsLocal(relativePath) {
+			problems = append(problems, fmt.Sprintf("%s is missing from gitRepoPath%s.", filepath.ToSlash(relativePath), what))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s is missing%s.", path, what))
+		}
+	}
+
+	if includeEngagementFiles {
+		for _, task := range engagementCopyTasks("", "") {
+			missing(filepath.Join(gitRepoPath, task.sourceFile), "")
+		}
+	}
+
+	for _, scheduler := range schedulers {
+		pluginFolder := filepath.Join(scriptsPath, scheduler.ArchiveFolder)
+		for _, task := range clusterCopyTasks(scheduler, "", "") {
+			switch {
+			case task.sourceFile == pluginFolder:
+				if includePlugins {
+					missing(task.sourceFile, fmt.Sprintf(" (%s's plugin; it isn't downloaded when downloadScriptsOnLaunch is false)", scheduler.Name))
+				}
+			case releaseNumber == "" && strings.HasPrefix(task.sourceFile, filepath.Join(gitRepoPath, "Gold")):
+				// Already reported.
+			default:
+				missing(task.sourceFile, fmt.Sprintf(" (needed by %s)", scheduler.Name))
+			}
+		}
+	}
+	return problems
+}
+
+// Checks that GitLab can be reached with your token and that the token can create projects and push to them.
+func gitLabProblems() []string {
+	if gitRepoAPIURL == "" {
+		return []string{"gitRepoAPIURL isn't set, so there's nowhere to submit to."}
+	}
+
+	if activeSettings.AccessTokenSource != "" {
+		token, err := resolveSecret(activeSettings.AccessTokenSource, gitRepoAPIURL)
+		if err != nil {
+			return []string{fmt.Sprintf("Your access token couldn't be got from %s: %v", accessTokenSourceOrigin.location(), redactError(err))}
+		}
+		accessToken = token
+	}
+	if accessToken == "" {
+		return []string{"accessToken or accessTokenSource needs to be set to submit to GitLab."}
+	}
+
+	// gitRepoAPIURL ends in projects/, and the rest of the API is next to that.
+	apiURL := gitLabAPIBaseURL(gitRepoAPIURL)
+	response, err := gitLabGet(apiURL + "personal_access_tokens/self")
+	if err != nil {
+		return []string{fmt.Sprintf("GitLab couldn't be reached at %s: %v", apiURL, err)}
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return []string{"GitLab rejected your access token. It may be wrong, expired or revoked."}
+	case http.StatusNotFound:
+		// GitLab before 15.5 can't describe a token. Make sure it's GitLab at all, at least.
+		versionResponse, err := gitLabGet(apiURL + "version")
+		if err != nil {
+			return []string{fmt.Sprintf("GitLab couldn't be reached at %s: %v", apiURL, err)}
+		}
+		versionResponse.Body.Close()
+		if versionResponse.StatusCode != http.StatusOK {
+			return []string{fmt.Sprintf("%s doesn't look like GitLab's API. It answered %s.", apiURL, versionResponse.Status)}
+		}
+		return nil
+	default:
+		return []string{fmt.Sprintf("GitLab answered %s when checking your access token.", response.Status)}
+	}
+
+	var token struct {
+		Scopes    []string `json:"scopes"`
+		Active    bool     `json:"active"`
+		ExpiresAt string   `json:"expires_at"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return []string{fmt.Sprintf("GitLab's description of your access token couldn't be read: %v", err)}
+	}
+
+	var problems []string
+	if !token.Active {
+		problems = append(problems, "Your access token isn't active.")
+	}
+	if !slices.Contains(token.Scopes, requiredTokenScope) {
+		problems = append(problems, fmt.Sprintf("Your access token has the scopes %s, but it needs %s to create projects and push.", strings.Join(token.Scopes, ", "), requiredTokenScope))
+	}
+	if expiresAt, err := time.Parse(time.DateOnly, token.ExpiresAt); err == nil && time.Until(expiresAt) < 7*24*time.Hour {
+		problems = append(problems, fmt.Sprintf("Your access token expires on %s. Make a new one soon.", token.ExpiresAt))
+	}
+	return problems
+}
+
+func gitLabGet(url string) (*http.Response, error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("PRIVATE-TOKEN", accessToken.Reveal())
+
+	response, err := httpClient.Do(request)
+	return response, redactError(err)
+}
+
+// Makes sure files can be created in path, creating it if needed.
+func checkWritable(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(path, ".isp-doctor-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
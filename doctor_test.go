@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Puts back what gitLabProblems and checkBeforeGenerating read.
+func saveDoctorGlobals(t *testing.T) {
+	t.Helper()
+	savedSettings, savedAPIURL, savedToken := activeSettings, gitRepoAPIURL, accessToken
+	savedRepoPath, savedScriptsPath, savedRelease, savedDryRun, savedDownload := gitRepoPath, scriptsPath, releaseNumber, dryRun, downloadScriptsOnLanuch
+	savedUsername, savedEmail, savedSubmit, savedOrganizationPath, savedFailures := gitUsername, gitEmailAddress, submitToRemoteRepo, organizationPath, report.Failures
+	t.Cleanup(func() {
+		activeSettings, gitRepoAPIURL, accessToken = savedSettings, savedAPIURL, savedToken
+		gitRepoPath, scriptsPath, releaseNumber, dryRun, downloadScriptsOnLanuch = savedRepoPath, savedScriptsPath, savedRelease, savedDryRun, savedDownload
+		gitUsername, gitEmailAddress, submitToRemoteRepo, organizationPath, report.Failures = savedUsername, savedEmail, savedSubmit, savedOrganizationPath, savedFailures
+	})
+}
+
+func TestGitLabProblems(t *testing.T) {
+	saveDoctorGlobals(t)
+	later := time.Now().AddDate(1, 0, 0).Format(time.DateOnly)
+	soon := time.Now().AddDate(0, 0, 2).Format(time.DateOnly)
+
+	tests := []struct {
+		name      string
+		tokenBody string
+		status    int
+		version   int // What /version answers, for GitLab before 15.5.
+		want      []string
+	}{
+		{"api scope", `{"scopes":["api"],"active":true,"expires_at":"` + later + `"}`, http.StatusOK, 0, nil},
+		{"never expires", `{"scopes":["read_user","api"],"active":true,"expires_at":null}`, http.StatusOK, 0, nil},
+		{"read_api only", `{"scopes":["read_api","read_repository"],"active":true,"expires_at":"` + later + `"}`, http.StatusOK, 0, []string{"has the scopes read_api, read_repository, but it needs api"}},
+		{"revoked", `{"scopes":["api"],"active":false}`, http.StatusOK, 0, []string{"isn't active"}},
+		{"expiring", `{"scopes":["api"],"active":true,"expires_at":"` + soon + `"}`, http.StatusOK, 0, []string{"expires on " + soon}},
+		{"everything wrong", `{"scopes":["read_api"],"active":false,"expires_at":"` + soon + `"}`, http.StatusOK, 0, []string{"isn't active", "needs api", "expires on"}},
+		{"unreadable", `{"scopes":`, http.StatusOK, 0, []string{"couldn't be read"}},
+		{"rejected", `{"message":"401 Unauthorized"}`, http.StatusUnauthorized, 0, []string{"rejected your access token"}},
+		{"old GitLab", "", http.StatusNotFound, http.StatusOK, nil},
+		{"not GitLab", "", http.StatusNotFound, http.StatusNotFound, []string{"doesn't look like GitLab's API. It answered 404 Not Found"}},
+		{"server error", "", http.StatusInternalServerError, 0, []string{"GitLab answered 500 Internal Server Error"}},
+	}
+	for _, test := range tests {
+		var tokensSent []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokensSent = append(tokensSent, r.Header.Get("PRIVATE-TOKEN"))
+			switch r.URL.Path {
+			case "/api/v4/personal_access_tokens/self":
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.tokenBody))
+			case "/api/v4/version":
+				w.WriteHeader(test.version)
+			default:
+				t.Errorf("%s: unexpected request for %s", test.name, r.URL.Path)
+				w.WriteHeader(http.StatusTeapot)
+			}
+		}))
+		activeSettings.AccessTokenSource = ""
+		gitRepoAPIURL, accessToken = server.URL+"/api/v4/projects/", "glpat-test"
+
+		problems := gitLabProblems()
+		server.Close()
+
+		if len(problems) != len(test.want) {
+			t.Errorf("%s: gitLabProblems = %q, want %d problem(s)", test.name, problems, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("%s: problem %d is %q, want it to say %q", test.name, i+1, problems[i], want)
+			}
+		}
+		for _, sent := range tokensSent {
+			if sent != "glpat-test" {
+				t.Errorf("%s: the token sent was %q", test.name, sent)
+			}
+		}
+	}
+}
+
+func TestGitLabProblemsWithoutAToken(t *testing.T) {
+	saveDoctorGlobals(t)
+
+	gitRepoAPIURL, accessToken, activeSettings.AccessTokenSource = "", "glpat-test", ""
+	if problems := gitLabProblems(); len(problems) != 1 || !strings.Contains(problems[0], "gitRepoAPIURL isn't set") {
+		t.Errorf("without gitRepoAPIURL, gitLabProblems = %q", problems)
+	}
+
+	// Nothing's asked of GitLab when there's no token to ask with.
+	gitRepoAPIURL, accessToken = "http://127.0.0.1:1/api/v4/projects/", ""
+	if problems := gitLabProblems(); len(problems) != 1 || !strings.Contains(problems[0], "accessToken or accessTokenSource needs to be set") {
+		t.Errorf("without a token, gitLabProblems = %q", problems)
+	}
+
+	t.Setenv("ISP_TEST_TOKEN", "")
+	activeSettings.AccessTokenSource = "env:ISP_TEST_TOKEN"
+	if problems := gitLabProblems(); len(problems) != 1 || !strings.Contains(problems[0], "ISP_TEST_TOKEN is empty or not set") {
+		t.Errorf("with an empty accessTokenSource, gitLabProblems = %q", problems)
+	}
+}
+
+func TestCheckBeforeGenerating(t *testing.T) {
+	saveDoctorGlobals(t)
+	slurm, _ := findScheduler("slurm")
+
+	// A gitRepoPath with everything a Slurm cluster and its engagement need.
+	makeRepo := func() {
+		gitRepoPath, scriptsPath = t.TempDir(), t.TempDir()
+		for _, task := range append(engagementCopyTasks("", ""), clusterCopyTasks(slurm, "", "")...) {
+			path := task.sourceFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(gitRepoPath, path)
+			}
+			if task.isDirectory {
+				os.MkdirAll(path, 0755)
+			} else {
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, nil, 0644)
+			}
+		}
+	}
+
+	tests := []struct {
+		name           string
+		change         func()
+		engagementDocs bool
+		want           []string
+	}{
+		{"everything there", func() {}, true, nil},
+		{
+			"missing Gold file",
+			func() { os.Remove(filepath.Join(gitRepoPath, "Gold", "R2024a", "slurm", "postConstructFcn.m")) },
+			true,
+			[]string{"Gold/R2024a/slurm/postConstructFcn.m is missing from gitRepoPath (needed by slurm)."},
+		},
+		{
+			"missing engagement docs",
+			func() { os.RemoveAll(filepath.Join(gitRepoPath, "Utilities", "pub")) },
+			true,
+			[]string{"Utilities/pub is missing from gitRepoPath."},
+		},
+		{
+			// add-cluster doesn't copy the docs again.
+			"docs not needed",
+			func() { os.RemoveAll(filepath.Join(gitRepoPath, "Utilities", "pub")) },
+			false,
+			nil,
+		},
+		{
+			"no release",
+			func() { releaseNumber = "" },
+			true,
+			[]string{"releaseNumber isn't set"},
+		},
+		{
+			"no identity for a new repo",
+			func() { gitUsername = "" },
+			true,
+			[]string{"gitUsername and gitEmailAddress need to be set"},
+		},
+		{
+			// Nothing's committed to an existing repo unless it's submitted.
+			"no identity for an existing repo",
+			func() {
+				gitEmailAddress = ""
+				os.MkdirAll(filepath.Join(organizationPath, ".git"), 0755)
+			},
+			true,
+			nil,
+		},
+		{
+			"no identity when submitting",
+			func() {
+				gitEmailAddress, submitToRemoteRepo = "", true
+				os.MkdirAll(filepath.Join(organizationPath, ".git"), 0755)
+			},
+			true,
+			[]string{"gitUsername and gitEmailAddress need to be set"},
+		},
+	}
+	for _, test := range tests {
+		releaseNumber, dryRun, downloadScriptsOnLanuch = "R2024a", true, false
+		gitUsername, gitEmailAddress, submitToRemoteRepo, report.Failures = "Jane Doe", "jane@example.com", false, nil
+		makeRepo()
+		organizationPath = filepath.Join(t.TempDir(), "Acme-Labs")
+		test.change()
+
+		output := captureStdout(t, func() {
+			checkBeforeGenerating([]clusterSpec{{Name: "Hopper", Scheduler: "slurm"}, {Name: "Turing", Scheduler: "slurm"}}, test.engagementDocs)
+		})
+
+		if len(report.Failures) != len(test.want) {
+			t.Errorf("%s: checkBeforeGenerating found %+v, want %d problem(s)", test.name, report.Failures, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if report.Failures[i].Category != failurePrerequisites || !strings.Contains(report.Failures[i].Message, want) {
+				t.Errorf("%s: problem %d is %+v, want it to say %q", test.name, i+1, report.Failures[i], want)
+			}
+		}
+		if (output != "") != (len(test.want) > 0) || (len(test.want) > 0 && !strings.Contains(output, "This run would fail.")) {
+			t.Errorf("%s: printed %q", test.name, output)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Called as a download progresses. total is -1 when the server doesn't say how big the file is.
+type progressFunc func(written, total int64)
+
+// Counts bytes as they're written and reports them.
+type progressWriter struct {
+	written  int64
+	total    int64
+	progress progressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if w.progress != nil {
+		w.progress(w.written, w.total)
+	}
+	return len(p), nil
+}
+
+// Used for everything we fetch over HTTP, so the proxy and CA settings apply everywhere. See configureHTTPClient.
+var httpClient = http.DefaultClient
+
+// How long any single part of a request can take. Downloads themselves aren't limited as a whole since the archives
+// can be large, but one that stalls for readTimeout is given up on.
+const (
+	connectTimeout  = 30 * time.Second
+	responseTimeout = 60 * time.Second
+)
+
+// How long a download can go without any data, and how long to wait before the first retry. The wait doubles each
+// time. They're only changed by tests.
+var (
+	readTimeout          = 60 * time.Second
+	downloadRetryBackoff = 2 * time.Second
+)
+
+const downloadAttempts = 4
+
+// Sets up httpClient with timeouts, the proxy from HTTPS_PROXY/HTTP_PROXY/NO_PROXY, and optionally extra trusted CAs
+// for TLS-intercepting proxies. caBundlePath is a PEM file of certificates to trust alongside the system's. When
+// offline, every request fails without connecting.
+func configureHTTPClient(caBundlePath string) error {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: responseTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	if caBundlePath != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool() // Windows before Go 1.18 and some minimal containers have no system pool.
+		}
+		pem, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			return err
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caBundlePath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	httpClient = &http.Client{Transport: transport}
+	if offline {
+		httpClient = &http.Client{Transport: offlineTransport{}}
+	}
+
+	// Git pushes and fetches over HTTPS go through the same proxy and trust the same CAs.
+	gitclient.InstallProtocol("https", githttp.NewClient(httpClient))
+	gitclient.InstallProtocol("http", githttp.NewClient(httpClient))
+	return nil
+}
+
+var (
+	errDownloadStalled = errors.New("download stalled")
+	errNotModified     = errors.New("not modified")
+)
+
+// What a server gave us to tell whether a file has changed since we downloaded it.
+type downloadValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// A download failure that trying again won't fix, such as a 404 or an HTML page where an archive should be.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Downloads url to filePath, retrying with backoff on network errors, 5xx and 429 responses. The file is written to a
+// temporary file beside filePath and only renamed into place once it's complete, so a failed download never leaves a
+// partial archive behind. If cached has anything in it, the request is conditional and errNotModified is returned
+// when the server says the file hasn't changed. Returns the new file's validators.
+func downloadFile(ctx context.Context, url string, filePath string, cached downloadValidators, progress progressFunc) (downloadValidators, error) {
+	var validators downloadValidators
+	var err error
+	backoff := downloadRetryBackoff
+
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		validators, err = downloadFileOnce(ctx, url, filePath, cached, progress)
+		if err == nil || err == errNotModified || ctx.Err() != nil {
+			return validators, err
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == downloadAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return validators, ctx.Err()
+		}
+		backoff *= 2
+	}
+
+	return validators, err
+}
+
+func downloadFileOnce(ctx context.Context, url string, filePath string, cached downloadValidators, progress progressFunc) (downloadValidators, error) {
+	// Cancelled if the body stops arriving for readTimeout, as well as when ctx is.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return downloadValidators{}, &permanentError{err}
+	}
+	if cached.ETag != "" {
+		request.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		request.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return downloadValidators{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified {
+		return cached, errNotModified
+	}
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%s returned %s", url, response.Status)
+		if response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests {
+			return downloadValidators{}, err
+		}
+		return downloadValidators{}, &permanentError{err}
+	}
+
+	// Error pages, login pages from proxies and the like are HTML or text. Anything else we'll let unzipFile judge.
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xhtml+xml" {
+		return downloadValidators{}, &permanentError{fmt.Errorf("%s returned %s instead of an archive", url, mediaType)}
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.part")
+	if err != nil {
+		return downloadValidators{}, err
+	}
+	defer os.Remove(file.Name()) // Does nothing once it's been renamed.
+
+	stallTimer := time.AfterFunc(readTimeout, func() { cancel(errDownloadStalled) })
+	defer stallTimer.Stop()
+
+	counter := &progressWriter{total: response.ContentLength, progress: func(written, total int64) {
+		stallTimer.Reset(readTimeout)
+		if progress != nil {
+			progress(written, total)
+		}
+	}}
+	written, err := io.Copy(file, io.TeeReader(response.Body, counter))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if context.Cause(ctx) == errDownloadStalled {
+			return downloadValidators{}, fmt.Errorf("%s stopped sending data for %s", url, readTimeout)
+		}
+		return downloadValidators{}, err
+	}
+
+	if response.ContentLength >= 0 && written != response.ContentLength {
+		return downloadValidators{}, fmt.Errorf("%s ended after %d of %d bytes", url, written, response.ContentLength)
+	}
+
+	validators := downloadValidators{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	return validators, os.Rename(file.Name(), filePath)
+}
+
+// Tracks every archive being downloaded so progress can be shown on one line.
+type downloadProgress struct {
+	mutex   sync.Mutex
+	order   []string
+	written map[string]int64
+	total   map[string]int64
+	done    map[string]string
+}
+
+func newDownloadProgress(names []string) *downloadProgress {
+	return &downloadProgress{
+		order:   names,
+		written: map[string]int64{},
+		total:   map[string]int64{},
+		done:    map[string]string{},
+	}
+}
+
+func (p *downloadProgress) update(name string, written, total int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.written[name] = written
+	p.total[name] = total
+}
+
+func (p *downloadProgress) finish(name, status string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.done[name] = status
+}
+
+// Something like "slurm 45% (1.2 MB) | pbs done | lsf waiting".
+func (p *downloadProgress) String() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var parts []string
+	for _, name := range p.order {
+		written, started := p.written[name]
+		switch {
+		case p.done[name] != "":
+			parts = append(parts, name+" "+p.done[name])
+		case !started:
+			parts = append(parts, name+" waiting")
+		case p.total[name] > 0:
+			parts = append(parts, fmt.Sprintf("%s %d%% (%s)", name, written*100/p.total[name], formatBytes(written)))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s", name, formatBytes(written)))
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+func formatBytes(bytes int64) string {
+	switch {
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// The outcome of acquiring one scheduler's plugin.
+type pluginResult struct {
+	scheduler schedulerEntry
+	lock      pluginLock
+	fromCache bool // The cached archive was still current.
+	err       error
+}
+
+// Acquires plugins for the given schedulers with at most workers at a time, showing progress as it goes. A failure
+// doesn't stop the others. Cancelling ctx stops everything still in progress. Results are in the same order as
+// schedulers.
+func acquirePlugins(ctx context.Context, schedulers []schedulerEntry, scriptsPath, cachePath string, workers int) []pluginResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var names []string
+	for _, scheduler := range schedulers {
+		names = append(names, scheduler.Name)
+	}
+	progress := newDownloadProgress(names)
+
+	results := make([]pluginResult, len(schedulers))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				scheduler := schedulers[i]
+				lock, fromCache, err := acquirePlugin(ctx, scheduler, scriptsPath, cachePath, func(written, total int64) {
+					progress.update(scheduler.Name, written, total)
+				})
+				results[i] = pluginResult{scheduler: scheduler, lock: lock, fromCache: fromCache, err: err}
+
+				switch {
+				case err != nil:
+					progress.finish(scheduler.Name, "failed")
+				case offline:
+					progress.finish(scheduler.Name, "cached")
+				case fromCache:
+					progress.finish(scheduler.Name, "unchanged")
+				default:
+					progress.finish(scheduler.Name, "done")
+				}
+			}
+		}()
+	}
+
+	// Redraw the progress line until everything's finished.
+	stopDrawing := make(chan struct{})
+	drawingStopped := make(chan struct{})
+	go func() {
+		defer close(drawingStopped)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Print("\r\033[K", progress)
+			case <-stopDrawing:
+				fmt.Print("\r\033[K", progress)
+				return
+			}
+		}
+	}()
+
+	for i := range schedulers {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i] = pluginResult{scheduler: schedulers[i], err: ctx.Err()}
+			progress.finish(schedulers[i].Name, "cancelled")
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	close(stopDrawing)
+	<-drawingStopped
+	return results
+}
+
+// Acquires plugins for schedulers and reports how it went. Successes are recorded in acquiredPlugins. Returns how
+// many failed.
+func downloadPlugins(ctx context.Context, schedulers []schedulerEntry, scriptsPath, cachePath string, workers int) int {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	if offline {
+		fmt.Print("\nExtracting integration scripts from the plugin cache.\n")
+	} else {
+		fmt.Print("\nBeginning download of integration scripts. Please wait.\n")
+	}
+
+	results := acquirePlugins(ctx, schedulers, scriptsPath, cachePath, workers)
+	if ctx.Err() != nil {
+		return len(results)
+	}
+
+	failures := 0
+	unchanged := 0
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Print(redText("\nFailed to get the ", result.scheduler.Label, " integration scripts: ", result.err))
+			reportFailure(failurePlugins, "Failed to get the ", result.scheduler.Label, " integration scripts: ", result.err)
+			logger.Error("plugin couldn't be got", "scheduler", result.scheduler.Name, "error", redactError(result.err))
+			failures++
+			continue
+		}
+		if result.fromCache {
+			unchanged++
+		}
+		logger.Info("plugin ready", "scheduler", result.scheduler.Name, "source", result.lock.Source, "ref", result.lock.Ref, "revision", result.lock.Revision, "sha256", result.lock.SHA256, "fromCache", result.fromCache, "offline", offline)
+		acquiredPlugins[result.scheduler.Name] = result.lock
+	}
+
+	if failures == 0 && offline {
+		fmt.Print("\nIntegration scripts extracted from the plugin cache successfully!")
+	} else if failures == 0 {
+		fmt.Print("\nLatest integration scripts downloaded and extracted successfully!")
+	} else {
+		fmt.Print(redText("\n", len(results)-failures, " of ", len(results), " integration scripts downloaded and extracted."))
+	}
+	if unchanged > 0 && !offline {
+		fmt.Print("\n", unchanged, " were unchanged since last time and reused from ", pluginCacheFolder(cachePath))
+	}
+	return failures
+}
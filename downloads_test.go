@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// One response from fakeServer. An empty contentType means application/zip.
+type fakeResponse struct {
+	status      int
+	contentType string
+	body        string
+}
+
+// Serves responses in order, repeating the last one, and records when each request came in along with its headers.
+type fakeServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	responses []fakeResponse
+	requests  []*http.Request
+	times     []time.Time
+}
+
+func newFakeServer(t *testing.T, responses ...fakeResponse) *fakeServer {
+	server := &fakeServer{responses: responses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		response := server.responses[min(len(server.requests), len(server.responses)-1)]
+		server.requests = append(server.requests, r)
+		server.times = append(server.times, time.Now())
+		server.mutex.Unlock()
+
+		if response.contentType == "" {
+			response.contentType = "application/zip"
+		}
+		w.Header().Set("Content-Type", response.contentType)
+		w.Header().Set("ETag", `"v2"`)
+		w.WriteHeader(response.status)
+		w.Write([]byte(response.body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Makes retries and stalls quick for the rest of the test.
+func useQuickTimeouts(t *testing.T) {
+	previousBackoff, previousTimeout := downloadRetryBackoff, readTimeout
+	t.Cleanup(func() { downloadRetryBackoff, readTimeout = previousBackoff, previousTimeout })
+	downloadRetryBackoff, readTimeout = 10*time.Millisecond, 100*time.Millisecond
+}
+
+// Returns a path for a download in a folder that already has last time's archive in it.
+func downloadPath(t *testing.T) string {
+	filePath := filepath.Join(t.TempDir(), "plugin.zip")
+	if err := os.WriteFile(filePath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// Fails if a .part file was left beside filePath.
+func checkNoPartFiles(t *testing.T, filePath string) {
+	t.Helper()
+	parts, _ := filepath.Glob(filepath.Join(filepath.Dir(filePath), "*.part"))
+	if len(parts) > 0 {
+		t.Errorf("%v were left behind", parts)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	useQuickTimeouts(t)
+	ok := fakeResponse{status: http.StatusOK, body: "PK new"}
+
+	tests := []struct {
+		name      string
+		responses []fakeResponse
+		attempts  int
+		error     string
+	}{
+		{"first time", []fakeResponse{ok}, 1, ""},
+		{"5xx then fine", []fakeResponse{{status: http.StatusServiceUnavailable}, {status: http.StatusBadGateway}, ok}, 3, ""},
+		{"429 then fine", []fakeResponse{{status: http.StatusTooManyRequests}, ok}, 2, ""},
+		{"5xx every time", []fakeResponse{{status: http.StatusInternalServerError}}, downloadAttempts, "returned 500 Internal Server Error"},
+		{"404", []fakeResponse{{status: http.StatusNotFound}, ok}, 1, "returned 404 Not Found"},
+		{"403", []fakeResponse{{status: http.StatusForbidden}, ok}, 1, "returned 403 Forbidden"},
+		{"a login page", []fakeResponse{{status: http.StatusOK, contentType: "text/html; charset=utf-8", body: "<html>Sign in</html>"}, ok}, 1, "returned text/html instead of an archive"},
+		{"JSON", []fakeResponse{{status: http.StatusOK, contentType: "application/json", body: "{}"}, ok}, 1, "returned application/json instead of an archive"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, test.responses...)
+			filePath := downloadPath(t)
+
+			validators, err := downloadFile(context.Background(), server.URL, filePath, downloadValidators{}, nil)
+
+			if len(server.requests) != test.attempts {
+				t.Errorf("%d attempts, want %d", len(server.requests), test.attempts)
+			}
+			content, _ := os.ReadFile(filePath)
+			if test.error == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != "PK new" || validators.ETag != `"v2"` {
+					t.Errorf("got %q with ETag %q", content, validators.ETag)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Fatalf("downloadFile = %v, want an error saying %q", err, test.error)
+				}
+				if string(content) != "old" {
+					t.Errorf("the archive was replaced with %q after a failed download", content)
+				}
+			}
+			checkNoPartFiles(t, filePath)
+		})
+	}
+}
+
+func TestDownloadFileBackoff(t *testing.T) {
+	useQuickTimeouts(t)
+	downloadRetryBackoff = 30 * time.Millisecond
+	server := newFakeServer(t, fakeResponse{status: http.StatusServiceUnavailable})
+
+	downloadFile(context.Background(), server.URL, downloadPath(t), downloadValidators{}, nil)
+
+	// The wait doubles after each attempt.
+	wait := downloadRetryBackoff
+	for i := 1; i < len(server.times); i++ {
+		if gap := server.times[i].Sub(server.times[i-1]); gap < wait {
+			t.Errorf("attempt %d came %s after the last, want at least %s", i+1, gap, wait)
+		}
+		wait *= 2
+	}
+}
+
+func TestDownloadFileNotModified(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Tue, 01 Oct 2024 00:00:00 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write([]byte("PK new"))
+	}))
+	t.Cleanup(server.Close)
+	filePath := downloadPath(t)
+	cached := downloadValidators{ETag: `"v1"`, LastModified: "Tue, 01 Oct 2024 00:00:00 GMT"}
+
+	validators, err := downloadFile(context.Background(), server.URL, filePath, cached, nil)
+
+	if err != errNotModified {
+		t.Fatalf("downloadFile = %v, want errNotModified", err)
+	}
+	if validators != cached {
+		t.Errorf("validators = %+v, want the cached ones", validators)
+	}
+	if content, _ := os.ReadFile(filePath); string(content) != "old" {
+		t.Errorf("the cached archive was replaced with %q", content)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("%d requests, want 1", requests.Load())
+	}
+}
+
+func TestDownloadFileStalled(t *testing.T) {
+	useQuickTimeouts(t)
+
+	// Sends a little, then nothing until the client gives up.
+	release := make(chan struct{})
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("PK"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	filePath := downloadPath(t)
+
+	var progress []int64
+	_, err := downloadFile(context.Background(), server.URL, filePath, downloadValidators{}, func(written, total int64) {
+		progress = append(progress, written)
+		if total != 1000 {
+			t.Errorf("total = %d, want the Content-Length", total)
+		}
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "stopped sending data for 100ms") {
+		t.Fatalf("downloadFile = %v, want a stall", err)
+	}
+	if attempts.Load() != downloadAttempts {
+		t.Errorf("%d attempts, want a stall to be retried up to %d times", attempts.Load(), downloadAttempts)
+	}
+	if len(progress) == 0 || progress[0] != 2 {
+		t.Errorf("progress = %v, want the first 2 bytes reported", progress)
+	}
+	if content, _ := os.ReadFile(filePath); string(content) != "old" {
+		t.Errorf("the archive was replaced with %q after a stall", content)
+	}
+	checkNoPartFiles(t, filePath)
+}
+
+func TestDownloadFileCancelled(t *testing.T) {
+	useQuickTimeouts(t)
+	downloadRetryBackoff = time.Minute
+	server := newFakeServer(t, fakeResponse{status: http.StatusServiceUnavailable})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := downloadFile(ctx, server.URL, downloadPath(t), downloadValidators{}, nil)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("downloadFile = %v, want the context's error", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("the backoff wasn't cut short")
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/fatih/color v1.16.0
 	github.com/go-git/go-git/v5 v5.12.0
 	github.com/xanzy/go-gitlab v0.101.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -3,16 +3,19 @@ package main
 import (
 	"archive/zip"
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,35 +29,18 @@ import (
 	"github.com/xanzy/go-gitlab"
 )
 
-type FolderCompleter struct {
-	Folders []string
-}
-
 // Used for copying files later on.
 type fileCopyTask struct {
 	sourceFile          string
 	destinationFileName string
 	destinationBasePath string
 	isDirectory         bool
-}
-
-// This function needs to be placed before the main function IIRC.
-func (f *FolderCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
-	prefix := string(line[:pos]) // Ensure we're only considering the part of the line up to the cursor.
-	for _, folder := range f.Folders {
-		if strings.HasPrefix(folder, prefix) {
-			// Append only the remaining part of the folder name beyond the prefix.
-			remainingPart := folder[len(prefix):]
-			newLine = append(newLine, []rune(remainingPart))
-		}
-	}
-	length = len(prefix)
-	return
+	capability          string // Only copied for schedulers with this capability, if set.
 }
 
 // Cross-function variables.
 var (
-	accessToken                  string
+	accessToken                  secret
 	organizationSelected         string
 	gitExistingRepoCommitMessage string
 	gitGroupID                   int
@@ -68,8 +54,27 @@ var (
 	releaseNumber                string
 	team                         string
 	submitToRemoteRepo           bool
+
+	// Set by setupSession.
+	activeSettings          settings
+	sessionSettings         *settings
+	sessionSettingOrigins   map[string]settingEntry
+	remoteChosenBy          string // What picked the remote profile for this run, such as -remote, if anything did.
+	accessTokenOrigin       settingEntry
+	accessTokenSourceOrigin settingEntry
+	downloadScriptsOnLanuch bool = true
+	gitRepoPath             string
+	scriptsPath             string
+	tmpFolder               string
+
+	// Answers to the prompts.
+	organizationContact string
+	caseNumber          int
 )
 
+// Lets Ctrl+C cancel whatever's watching main's context, such as downloads, instead of exiting straight away.
+var cancellable atomic.Bool
+
 func main() {
 	// To handle keyboard input better.
 	rl, err := readline.New("> ")
@@ -82,62 +87,91 @@ func main() {
 	redBackground := color.New(color.BgRed).SprintFunc()
 	redText := color.New(color.FgRed).SprintFunc()
 
-	// Goodies.
-	var caseNumber int
-	var clusterCount int
-	var clusterHostname string
-	var clusterMatlabRoot string
-	var clusterName string
-	var customMPI bool = false
-	var customMPIInput string
-	var downloadScriptsOnLanuch bool = true
-	var gitRepoPath string
-	var includeRemoteConfigFiles bool = false
-	var input string
-	var numberOfWorkers int
-	var organizationContact string
-	var organizationContactPath string
-	var profileName string
-	var schedulerSelected string
-	var scriptsPath string
-	var submissionType string
-	var tmpFolder string
-	var tmpOrganizationContactPath string
+	flag.BoolVar(&dryRun, "dry-run", false, "Print everything that would be done instead of doing it.")
+	flag.StringVar(&reportPath, "report", "", "Write a JSON report of the run to this file when it ends, whether it worked or not.")
+	flag.StringVar(&planJSONPath, "plan-json", "", "With -dry-run, also write the plan as JSON to this file, or print it instead of the plan if it's \"-\".")
+	specPath := flag.String("spec", "", "Path to a YAML or JSON engagement spec. Anything it leaves out will be prompted for.")
+	answers := registerAnswerFlags(flag.CommandLine)
+	settingFlagValues := settingFlags(flag.CommandLine)
+	flag.Usage = printUsage
+	flag.Parse()
+
+	// The command comes first, then its flags, though flags before it work too. Running without a command creates an
+	// engagement, like it always has.
+	command, commandArgs := "create", flag.Args()
+	if len(commandArgs) > 0 {
+		command, commandArgs = commandArgs[0], commandArgs[1:]
+	}
+	if slices.Contains(commandGroups, command) && len(commandArgs) > 0 {
+		command, commandArgs = command+" "+commandArgs[0], commandArgs[1:]
+	}
+	if !slices.ContainsFunc(commands, func(c commandHelp) bool { return c.name == command }) {
+		fmt.Print(redText("\nUnrecognized command: ", strings.Join(flag.Args(), " "), ". Run with -help to see the commands."))
+		os.Exit(1)
+	}
+
+	var bundlePath string
+	if command == "bundle export" || command == "bundle import" {
+		if len(commandArgs) == 0 || strings.HasPrefix(commandArgs[0], "-") {
+			fmt.Print(redText("\nUsage: ", command, " <bundle.zip> [flags]"))
+			os.Exit(1)
+		}
+		bundlePath, commandArgs = commandArgs[0], commandArgs[1:]
+	}
+
+	flag.CommandLine.Parse(commandArgs)
+	switch command {
+	case "create", "add-cluster", "update", "push":
+		startRunReport(command)
+	}
+	if flag.NArg() > 0 {
+		fmt.Print(redText("\nUnexpected arguments after ", command, ": ", strings.Join(flag.Args(), " ")))
+		os.Exit(1)
+	}
+
+	if planJSONPath != "" {
+		dryRun = true
+	}
 
 	// Setup for better Ctrl+C messaging. This is a channel to receive OS signals.
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
+	// Work that can be stopped cleanly watches ctx. While it's running, Ctrl+C cancels ctx instead of exiting straight
+	// away. Pressing it again exits regardless.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Start a Goroutine to listen for signals.
 	go func() {
+		for {
+			// Wait for the signal.
+			<-signalChan
 
-		// Wait for the signal.
-		<-signalChan
+			if cancellable.Load() && ctx.Err() == nil {
+				fmt.Print(redBackground("\nStopping... Press Ctrl+C again to exit immediately."))
+				logger.Warn("stopping after an interrupt")
+				cancel()
+				continue
+			}
 
-		// Handle the signal by exiting the program and reporting it as so.
-		fmt.Print(redBackground("\nExiting from user input..."))
-		os.Exit(0)
+			// Handle the signal by exiting the program and reporting it as so.
+			leaveWizardScreen(os.Stdout)
+			fmt.Print(redBackground("\nExiting from user input..."))
+			logger.Warn("interrupted")
+			reportFailure(failureInterrupted, "Exiting from user input...")
+
+			// Don't leave a half-made engagement behind, same as when a step fails.
+			if _, err := os.Stat(tmpEngagementPath); tmpEngagementPath != "" && err == nil {
+				if err := deleteFileOrFolder(tmpEngagementPath); err != nil {
+					fmt.Print(redText("\nError deleting temporary engagement files: ", err))
+					logger.Error("deleting temporary engagement files failed", "path", tmpEngagementPath, "error", err)
+				}
+			}
+			exitRun(0)
+		}
 	}()
 
-	// Regexp compile used for detecting things with numbers and letters.
-	lettersAndNumbersPattern, err := regexp.Compile(`^[^a-zA-Z0-9]+$`)
-	if err != nil {
-		fmt.Print(redText("\nError compiling regex lettersAndNumbersPattern: ", err))
-		os.Exit(1)
-	}
-
-	lettersPattern, err := regexp.Compile(`^[^a-zA-Z]+$`)
-	if err != nil {
-		fmt.Print(redText("\nError compiling regex lettersPattern: ", err))
-		os.Exit(1)
-	}
-
-	removeBannedSymbols, err := regexp.Compile("[^a-zA-Z0-9._-]+")
-	if err != nil {
-		fmt.Print(redText("\nError compiling regex removeBannedSymbols:", err))
-		os.Exit(1)
-	}
-
 	// Determine your OS.
 	switch userOS := runtime.GOOS; userOS {
 	case "darwin":
@@ -155,226 +189,305 @@ func main() {
 	// We want to remember this, even if you decide to change your scriptsPath.
 	tmpFolder = scriptsPath
 
-	// Determine any user-defined settings.
-	currentDir, err := os.Getwd() // Get the current working directory.
+	// The scheduler catalogue has to be ready before settings are checked against it.
+	if err := loadSchedulerCatalogue(); err != nil {
+		fail(failureSettings, "\nError loading the scheduler catalogue: ", err)
+	}
+
+	// Determine any user-defined settings. Each layer overrides the ones before it: defaults, your config directory's
+	// settings.txt, the current directory's settings.txt, ISP_* environment variables and then flags.
+	userSettings := settings{
+		DownloadScriptsOnLaunch: true,
+		DownloadWorkers:         4,
+		ScriptsPath:             scriptsPath,
+		CachePath:               defaultCachePath(),
+		LogPath:                 defaultLogPath(),
+		Wizard:                  true,
+		SSHCommand:              "ssh",
+	}
+
+	// Logging starts even if the settings are wrong, so that's logged too. Any that are wrong keep their default.
+	settingOrigins, err := loadLayeredSettings(&userSettings, settingsFromFlags(flag.CommandLine, settingFlagValues))
+	startLogging(userSettings.LogPath, userSettings.Verbose, command)
 	if err != nil {
-		fmt.Print(redText("\nError getting current working directory while looking for user settings : ", err, " Default settings will be used instead."))
+		fail(failureSettings, "\nYour settings need correcting:\n", err)
+	}
+
+	switch command {
+	case "config show", "cache status", "cache clear", "plugins prefetch", "bundle export", "bundle import":
+		runToolCommand(ctx, command, bundlePath, &userSettings, settingOrigins)
+		logger.Info("run ended", "exitCode", 0)
 		return
-	} else {
-		settingsPath := filepath.Join(currentDir, "settings.txt")
-
-		// Check if the settings file exists.
-		if _, err := os.Stat(settingsPath); os.IsNotExist(err) {
-			// No settings file found.
-			return
-		} else if err != nil {
-			fmt.Print(redText("\nError checking for user settings: ", err, " Default settings will be used instead."))
-		} else {
-			fmt.Print("\nCustom settings found!")
-			file, err := os.Open(settingsPath)
-			if err != nil {
-				fmt.Print(redText("\nError opening settings file: ", err, " Default settings will be used instead."))
-				return
-			}
-			defer file.Close()
-
-			scanner := bufio.NewScanner(file)
-
-			for scanner.Scan() {
-				line := scanner.Text()
-
-				if !strings.HasPrefix(line, "#") {
-					if strings.HasPrefix(strings.ToLower(line), "downloadscriptsonlaunch") {
-						if strings.Contains(strings.ToLower(line), "false") {
-							downloadScriptsOnLanuch = false
-							fmt.Print("\nA new set of integration scripts will not be downloaded per your settings.")
-						}
-
-					} else if strings.HasPrefix(line, "scriptsPath =") || strings.HasPrefix(line, "scriptsPath=") {
-						scriptsPath = strings.TrimPrefix(line, "scriptsPath =")
-						scriptsPath = strings.TrimPrefix(scriptsPath, "scriptsPath=")
-						scriptsPath = strings.TrimSpace(scriptsPath)
-						scriptsPath = strings.Trim(scriptsPath, "\"")
-
-						_, err := os.Stat(scriptsPath) // Do you actually exist? Does anything actually exist, man?
-						if err != nil {
-							fmt.Print(redText("\nThe custom scripts path you've specified, \"", scriptsPath, " does not exist. Please adjust your settings accordingly."))
-							os.Exit(1)
-						}
-
-						if !downloadScriptsOnLanuch {
-							schedulers := []string{"slurm", "pbs", "lsf", "gridengine", "htcondor", "awsbatch", "kubernetes"}
-							for _, scheduler := range schedulers {
-								schedulerDirectoryName := "matlab-parallel-" + scheduler + "-plugin-main"
-								schedulerPath := filepath.Join(scriptsPath, schedulerDirectoryName)
-								if _, err := os.Stat(schedulerPath); err != nil {
-									fmt.Printf(redText("\nThe path you've specified is missing the needed integration scripts folder \"%s\".\n"), schedulerDirectoryName)
-									os.Exit(1)
-								}
-							}
-						}
-
-						fmt.Print("\nA custom integration scripts download path has been set to ", scriptsPath)
-
-					} else if strings.HasPrefix(line, "accessToken =") || strings.HasPrefix(line, "accessToken=") {
-						accessToken = strings.TrimPrefix(line, "accessToken =")
-						accessToken = strings.TrimPrefix(accessToken, "accessToken=")
-						accessToken = strings.TrimSpace(accessToken)
-						accessToken = strings.Trim(accessToken, "\"")
-						fmt.Print("\nYour access token has been set to ", accessToken)
-					} else if strings.HasPrefix(line, "gitGroupID =") || strings.HasPrefix(line, "gitGroupID=") {
-						gitGroupIDString := strings.TrimPrefix(line, "gitGroupID =")
-						gitGroupIDString = strings.TrimPrefix(gitGroupIDString, "gitGroupID=")
-						gitGroupIDString = strings.TrimSpace(gitGroupIDString)
-						gitGroupIDString = strings.Trim(gitGroupIDString, "\"")
-
-						if _, err := strconv.Atoi(gitGroupIDString); err == nil {
-							gitGroupID, _ = strconv.Atoi(gitGroupIDString)
-						}
-						fmt.Print("\nYour Git group ID has been set to ", gitGroupID)
-					} else if strings.HasPrefix(line, "gitExistingRepoCommitMessage =") || strings.HasPrefix(line, "gitExistingRepoCommitMessage=") {
-						gitExistingRepoCommitMessage = strings.TrimPrefix(line, "gitExistingRepoCommitMessage =")
-						gitExistingRepoCommitMessage = strings.TrimPrefix(gitExistingRepoCommitMessage, "gitExistingRepoCommitMessage=")
-						gitExistingRepoCommitMessage = strings.TrimSpace(gitExistingRepoCommitMessage)
-						gitExistingRepoCommitMessage = strings.Trim(gitExistingRepoCommitMessage, "\"")
-						fmt.Print("\nYour existing Git repo commit message has been set to \"", gitExistingRepoCommitMessage, "\"")
-					} else if strings.HasPrefix(line, "gitRepoPath =") || strings.HasPrefix(line, "gitRepoPath=") {
-						gitRepoPath = strings.TrimPrefix(line, "gitRepoPath =")
-						gitRepoPath = strings.TrimPrefix(gitRepoPath, "gitRepoPath=")
-						gitRepoPath = strings.TrimSpace(gitRepoPath)
-						gitRepoPath = strings.Trim(gitRepoPath, "\"")
-
-						// Check if the path exists.
-						if _, err := os.Stat(gitRepoPath); os.IsNotExist(err) {
-							fmt.Print("\nThe specified Git repo path does not exist: ", gitRepoPath, ". It will not be used.")
-							gitRepoPath = ""
-						} else {
-							fmt.Print("\nYour Git Repo path has been set to ", gitRepoPath)
-						}
-					} else if strings.HasPrefix(line, "gitRepoAPIURL =") || strings.HasPrefix(line, "gitRepoAPIURL=") {
-						gitRepoAPIURL = strings.TrimPrefix(line, "gitRepoAPIURL =")
-						gitRepoAPIURL = strings.TrimPrefix(gitRepoAPIURL, "gitRepoAPIURL=")
-						gitRepoAPIURL = strings.TrimSpace(gitRepoAPIURL)
-						gitRepoAPIURL = strings.Trim(gitRepoAPIURL, "\"")
-
-						// We want the URL to end with "projects/"" for later Git repo usage.
-						if strings.HasSuffix(gitRepoAPIURL, "projects") {
-							gitRepoAPIURL += "/"
-						} else if strings.HasSuffix(gitRepoAPIURL, "projects/") {
-							// Do nothing.
-						} else if strings.HasSuffix(gitRepoAPIURL, "/") {
-							gitRepoAPIURL = gitRepoAPIURL[:len(gitRepoAPIURL)-1]
-							gitRepoAPIURL += "/projects"
-						}
-
-						fmt.Print("\nYour Git API URL has been set to ", gitRepoAPIURL)
-					} else if strings.HasPrefix(line, "gitGroupName =") || strings.HasPrefix(line, "gitGroupName=") {
-						gitGroupName = strings.TrimPrefix(line, "gitGroupName =")
-						gitGroupName = strings.TrimPrefix(gitGroupName, "gitGroupName=")
-						gitGroupName = strings.TrimSpace(gitGroupName)
-						gitGroupName = strings.Trim(gitGroupName, "\"")
-						fmt.Print("\nYour Git group name has been set to ", gitGroupName)
-					} else if strings.HasPrefix(line, "gitUsername =") || strings.HasPrefix(line, "gitUsername=") {
-						gitUsername = strings.TrimPrefix(line, "gitUsername =")
-						gitUsername = strings.TrimPrefix(gitUsername, "gitUsername=")
-						gitUsername = strings.TrimSpace(gitUsername)
-						gitUsername = strings.Trim(gitUsername, "\"")
-						fmt.Print("\nYour Git repo username has been set to ", gitUsername)
-					} else if strings.HasPrefix(line, "gitEmailAddress =") || strings.HasPrefix(line, "gitEmailAddress=") {
-						gitEmailAddress = strings.TrimPrefix(line, "gitEmailAddress =")
-						gitEmailAddress = strings.TrimPrefix(gitEmailAddress, "gitEmailAddress=")
-						gitEmailAddress = strings.TrimSpace(gitEmailAddress)
-						gitEmailAddress = strings.Trim(gitEmailAddress, "\"")
-						fmt.Print("\nYour Git repo email address has been set to ", gitEmailAddress)
-					} else if strings.HasPrefix(line, "releaseNumber =") || strings.HasPrefix(line, "releaseNumber=") {
-						releaseNumber = strings.TrimPrefix(line, "releaseNumber =")
-						releaseNumber = strings.TrimPrefix(releaseNumber, "releaseNumber=")
-						releaseNumber = strings.TrimSpace(releaseNumber)
-						releaseNumber = strings.Trim(releaseNumber, "\"")
-						fmt.Print("\nThe release number has been set to ", releaseNumber)
-					} else if strings.HasPrefix(strings.ToLower(line), "team") {
-						if strings.Contains(strings.ToLower(line), "install") {
-							team = "install"
-							fmt.Print("\nYour team has been set to Install.")
-						} else if strings.Contains(strings.ToLower(line), "parallel") {
-							team = "parallel"
-							fmt.Print("\nYour team has been set to Parallel Pilot.")
-						} else {
-							fmt.Print(redText("\nYou selected a team other than Install or Parallel Pilot team in your settings Please correct this."))
-							os.Exit(1)
-						}
-					} else if strings.HasPrefix(strings.ToLower(line), "submittoremoterepo") {
-						if strings.Contains(strings.ToLower(line), "false") {
-							submitToRemoteRepo = false
-							fmt.Print("\nPer your settings, you will not be sumbitting your work to a remote repo.")
-						} else if strings.Contains(strings.ToLower(line), "true") {
-							submitToRemoteRepo = true
-						} else {
-							fmt.Print(redText("\nYou entered something other than true or false for your submitToRemoteRepo setting. Please correct this."))
-							os.Exit(1)
-						}
-					} else {
-						fmt.Print(redText("\nUnrecognized setting detected. The line in question has this content: ", line))
-						os.Exit(1)
-					}
-				}
-			}
+	}
+
+	// Answers the engagement spec gives are used as-is. Everything else is asked for.
+	spec := &engagementSpec{}
+	if *specPath != "" {
+		spec, err = loadEngagementSpec(*specPath)
+		if err != nil {
+			fail(failureInput, "\nError loading the engagement spec: ", err)
+		}
+	}
+	if err := answers.apply(flag.CommandLine, spec); err != nil {
+		fail(failureInput, "\n", err)
+	}
+
+	// list and doctor don't need to tell you about every setting.
+	quiet := command == "list" || command == "doctor"
+	if !quiet && *specPath != "" {
+		fmt.Print("\nEngagement spec loaded from ", *specPath)
+	}
+
+	// push is an explicit request to submit, whatever submitToRemoteRepo says.
+	if command == "push" {
+		userSettings.SubmitToRemoteRepo = true
+	}
+	setupSession(spec, &userSettings, settingOrigins, quiet)
+
+	switch command {
+	case "create":
+		runCreate(ctx, rl, spec)
+	case "add-cluster":
+		runAddCluster(ctx, rl, spec)
+	case "update":
+		runUpdate(ctx, rl, spec)
+	case "push":
+		runPush(rl, spec)
+	case "list":
+		listEngagements()
+	case "doctor":
+		runDoctor(spec)
+	}
+	logger.Info("run ended", "exitCode", 0)
+	writeRunReport()
+}
 
-			if err := scanner.Err(); err != nil {
-				fmt.Print(redText("\nError reading settings file: ", err, " Default settings will be used instead."))
+// Picks the remote profile, fills in the cross-function variables from the settings and tells you about them.
+func setupSession(spec *engagementSpec, userSettings *settings, settingOrigins map[string]settingEntry, quiet bool) {
+	if !quiet {
+		for _, layer := range []string{"user config", "project"} {
+			for _, entry := range settingOrigins {
+				if entry.layer == layer {
+					fmt.Print("\nCustom settings found in ", entry.source)
+					break
+				}
 			}
 		}
 	}
 
-	if downloadScriptsOnLanuch {
-		fmt.Print("\nBeginning download of integration scripts. Please wait.")
+	// Pick the remote profile to use. A -remote flag wins, then the engagement spec's, then your settings'. Your
+	// settings' can give way to the one an engagement was made with, once it's known.
+	remoteName := userSettings.Remote
+	remoteChosenBy = ""
+	switch {
+	case settingOrigins["remote"].layer == "flag":
+		remoteChosenBy = "-remote"
+	case spec.Remote != "":
+		remoteName = spec.Remote
+		remoteChosenBy = "the engagement spec"
+	}
+
+	effectiveSettings, err := userSettings.withRemote(remoteName)
+	if err != nil {
+		fail(failureSettings, "\nError selecting a remote profile: ", err)
+	}
+	sessionSettings, sessionSettingOrigins = userSettings, settingOrigins
+	useRemoteSettings(effectiveSettings)
+
+	// Where each setting came from, but not its value, as some are secret.
+	for _, key := range sortedKeys(settingOrigins) {
+		logger.Debug("setting", "key", key, "layer", settingOrigins[key].layer, "source", settingOrigins[key].location())
+	}
+	logger.Info("session", "remote", remoteName, "gitRepoPath", effectiveSettings.GitRepoPath, "scriptsPath", effectiveSettings.ScriptsPath, "cachePath", effectiveSettings.CachePath, "release", effectiveSettings.ReleaseNumber, "team", effectiveSettings.Team, "offline", effectiveSettings.Offline, "submitToRemoteRepo", effectiveSettings.SubmitToRemoteRepo)
+	if remoteName != "" && !quiet {
+		fmt.Print("\nUsing the remote profile \"", remoteName, "\"")
+	}
+
+	downloadScriptsOnLanuch = effectiveSettings.DownloadScriptsOnLaunch
+	scriptsPath = effectiveSettings.ScriptsPath
+	gitExistingRepoCommitMessage = effectiveSettings.GitExistingRepoCommitMessage
+	gitRepoPath = effectiveSettings.GitRepoPath
+	releaseNumber = effectiveSettings.ReleaseNumber
+	team = effectiveSettings.Team
+	submitToRemoteRepo = effectiveSettings.SubmitToRemoteRepo
+	offline = effectiveSettings.Offline
+	clonePlugins = effectiveSettings.ClonePlugins
+
+	if err := configureHTTPClient(effectiveSettings.CABundle); err != nil {
+		fail(failureSettings, "\nError loading your CA bundle from ", settingOrigins["caBundle"].location(), ": ", err)
+	}
 
-		var scriptsURLs = map[string]string{
-			"https://codeload.github.com/mathworks/matlab-parallel-slurm-plugin/zip/refs/heads/main":      "slurm.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-pbs-plugin/zip/refs/heads/main":        "pbs.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-lsf-plugin/zip/refs/heads/main":        "lsf.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-htcondor-plugin/zip/refs/heads/main":   "htcondor.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-gridengine-plugin/zip/refs/heads/main": "gridengine.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-awsbatch-plugin/zip/refs/heads/main":   "awsbatch.zip",
-			"https://codeload.github.com/mathworks/matlab-parallel-kubernetes-plugin/zip/refs/heads/main": "kubernetes.zip",
+	if quiet {
+		if _, err := os.Stat(gitRepoPath); gitRepoPath != "" && os.IsNotExist(err) {
+			gitRepoPath = ""
 		}
+		return
+	}
 
-		for url, zipArchive := range scriptsURLs {
-			zipArchivePath := filepath.Join(scriptsPath, zipArchive)
-			err := downloadFile(url, zipArchivePath)
-			if err != nil {
-				fmt.Print(redText("\nFailed to download the integration scripts: ", err))
-				continue
-			}
+	if offline {
+		fmt.Print("\nRunning offline. Integration scripts will come from the plugin cache and nothing will be downloaded.")
+		if submitToRemoteRepo {
+			fmt.Print("\nYour work won't be submitted to a remote repo while offline.")
+			submitToRemoteRepo = false
+		}
+	}
+	if !downloadScriptsOnLanuch {
+		fmt.Print("\nA new set of integration scripts will not be downloaded per your settings.")
+	}
+	if scriptsPath != tmpFolder {
+		fmt.Print("\nA custom integration scripts download path has been set to ", scriptsPath)
+	}
+	if effectiveSettings.CABundle != "" {
+		fmt.Print("\nCertificates in ", effectiveSettings.CABundle, " will be trusted.")
+	}
+	resolveAccessToken()
+	if gitGroupID != 0 {
+		fmt.Print("\nYour Git group ID has been set to ", gitGroupID)
+	}
+	if gitExistingRepoCommitMessage != "" {
+		fmt.Print("\nYour existing Git repo commit message has been set to \"", gitExistingRepoCommitMessage, "\"")
+	}
+	if gitRepoPath != "" {
+		// Check if the path exists.
+		if _, err := os.Stat(gitRepoPath); os.IsNotExist(err) {
+			fmt.Print("\nThe specified Git repo path does not exist: ", gitRepoPath, ". It will not be used.")
+			gitRepoPath = ""
+		} else {
+			fmt.Print("\nYour Git Repo path has been set to ", gitRepoPath)
+		}
+	}
+	if gitRepoAPIURL != "" {
+		fmt.Print("\nYour Git API URL has been set to ", gitRepoAPIURL)
+	}
+	if gitGroupName != "" {
+		fmt.Print("\nYour Git group name has been set to ", gitGroupName)
+	}
+	if gitUsername != "" {
+		fmt.Print("\nYour Git repo username has been set to ", gitUsername)
+	}
+	if gitEmailAddress != "" {
+		fmt.Print("\nYour Git repo email address has been set to ", gitEmailAddress)
+	}
+	if releaseNumber != "" {
+		fmt.Print("\nThe release number has been set to ", releaseNumber)
+	}
+	switch team {
+	case "install":
+		fmt.Print("\nYour team has been set to Install.")
+	case "parallel":
+		fmt.Print("\nYour team has been set to Parallel Pilot.")
+	}
+	if !submitToRemoteRepo {
+		fmt.Print("\nPer your settings, you will not be sumbitting your work to a remote repo.")
+	}
+}
 
-			// Extract ZIP archives.
-			schedulerName := strings.TrimSuffix(zipArchive, ".zip")
-			unzipPath := filepath.Join(scriptsPath, schedulerName)
+// Sets the remote profile's settings, which effective has already been given, as the ones to use.
+func useRemoteSettings(effective settings) {
+	activeSettings = effective
+	accessToken = effective.AccessToken
+	gitEmailAddress = effective.GitEmailAddress
+	gitGroupID = effective.GitGroupID
+	gitGroupName = effective.GitGroupName
+	gitRepoAPIURL = effective.GitRepoAPIURL
+	gitUsername = effective.GitUsername
+
+	// Where the token came from, for messages about it.
+	accessTokenOrigin = sessionSettingOrigins["accessToken"]
+	accessTokenSourceOrigin = sessionSettingOrigins["accessTokenSource"]
+	if entry, ok := sessionSettingOrigins["remote."+effective.Remote+".accessToken"]; ok {
+		accessTokenOrigin = entry
+	}
+	if entry, ok := sessionSettingOrigins["remote."+effective.Remote+".accessTokenSource"]; ok {
+		accessTokenSourceOrigin = entry
+	}
+}
 
-			// Check if the integration scripts directory already exists. Delete it if it is.
-			if _, err := os.Stat(unzipPath); err == nil {
+// Gets the access token from accessTokenSource, if that's where it comes from, and says where it came from. It's only
+// looked up if it's going to be used, since some sources may prompt or run commands.
+func resolveAccessToken() {
+	redText := color.New(color.FgRed).SprintFunc()
 
-				err := os.RemoveAll(unzipPath)
-				if err != nil {
-					fmt.Print(redText("\nFailed to delete the existing integration scripts directory: ", err))
-					os.Exit(1)
-				}
-			}
+	if activeSettings.AccessTokenSource != "" && submitToRemoteRepo {
+		var err error
+		accessToken, err = resolveSecret(activeSettings.AccessTokenSource, gitRepoAPIURL)
+		if err != nil {
+			fail(failureSettings, "\nError getting your access token from ", accessTokenSourceOrigin.location(), ": ", redactError(err))
+		}
+		fmt.Print("\nYour access token has been set from ", activeSettings.AccessTokenSource)
+	} else if accessToken != "" {
+		if accessTokenOrigin.line > 0 {
+			fmt.Print(redText("\nYour access token is stored in plaintext in ", accessTokenOrigin.source, ". Consider using accessTokenSource instead."))
+			logger.Warn("access token stored in plaintext", "path", accessTokenOrigin.location())
+		}
+		fmt.Print("\nYour access token has been set.")
+	}
+}
 
-			err = unzipFile(zipArchivePath, scriptsPath)
-			if err != nil {
-				fmt.Print(redText("\nFailed to extract integration scripts: ", err))
-				os.Exit(1)
-			}
+// Switches to the remote profile the organization's engagements were made with, so they're added to and pushed to
+// the same GitLab as before. Fails if the remote was chosen for this run and it's a different one.
+func useEngagementRemote(organizationPath string) {
+	recordedRemote, err := recordedEngagementRemote(organizationPath)
+	if err != nil {
+		fail(failureInput, "\n", err)
+	}
+	remoteName, err := engagementRemote(activeSettings.Remote, remoteChosenBy, recordedRemote)
+	if err != nil {
+		fail(failureSettings, "\n", organizationSelected, ": ", err)
+	}
+	if remoteName == activeSettings.Remote {
+		return
+	}
 
-			if strings.Contains(zipArchivePath, "kubernetes.zip") {
-				fmt.Print("\nLatest integration scripts downloaded and extracted successfully!")
-			}
+	effective, err := sessionSettings.withRemote(remoteName)
+	if err != nil {
+		fail(failureSettings, "\n", organizationSelected, "'s engagements were made with a remote profile you don't have: ", err)
+	}
+	fmt.Print("\nUsing the remote profile \"", remoteName, "\", which ", organizationSelected, "'s engagements were made with.")
+	logger.Info("remote profile from the engagement record", "org", organizationSelected, "remote", remoteName)
+	useRemoteSettings(effective)
+	resolveAccessToken()
+}
+
+// Picks between the remote profile in use and the one an engagement was recorded with. An engagement with no remote
+// recorded was made before they were, or without one, so the one in use is kept.
+func engagementRemote(current, chosenBy, recorded string) (string, error) {
+	if recorded == "" || recorded == current {
+		return current, nil
+	}
+	if chosenBy != "" {
+		currentName := "no remote profile"
+		if current != "" {
+			currentName = fmt.Sprintf("the remote profile \"%s\"", current)
 		}
-	} else {
-		fmt.Print("\nIntegration scripts download skipped per user's settings.")
+		return "", fmt.Errorf("its engagements were made with the remote profile \"%s\", but %s chose %s. Use -remote %s, or leave it out.", recorded, chosenBy, currentName, recorded)
+	}
+	return recorded, nil
+}
+
+// The remote profile an organization's engagements were made with, from its contacts' records. They share one GitLab
+// project, so they should all agree.
+func recordedEngagementRemote(organizationPath string) (string, error) {
+	remoteName, remoteContact := "", ""
+	for _, contact := range visibleFolders(organizationPath) {
+		record, err := readEngagementRecord(filepath.Join(organizationPath, contact))
+		if err != nil {
+			return "", fmt.Errorf("Error reading the engagement record: %w", err)
+		}
+		if record == nil || record.Remote == "" {
+			continue
+		}
+		if remoteName != "" && record.Remote != remoteName {
+			return "", fmt.Errorf("%s's engagements were made with different remote profiles: \"%s\" for %s and \"%s\" for %s.", filepath.Base(organizationPath), remoteName, remoteContact, record.Remote, contact)
+		}
+		remoteName, remoteContact = record.Remote, contact
 	}
+	return remoteName, nil
+}
 
+// Lists existing engagements and asks which organization this is for. With mustExist, only an existing one will do.
+// Returns false if the user interrupted.
+func promptOrganization(rl *readline.Instance, spec *engagementSpec, mustExist bool) bool {
 	// List existing engagements and setup auto-completion.
 	var engagementFolders []string
 	if gitRepoPath != "" {
@@ -382,10 +495,8 @@ func main() {
 		if _, err := os.Stat(customerEngagementsPath); !os.IsNotExist(err) {
 			files, err := os.ReadDir(customerEngagementsPath)
 			if err != nil {
-				fmt.Print(redText("\nError reading directory: ", err))
-				os.Exit(1)
+				fail(failureGeneration, "\nError reading directory: ", err)
 			} else {
-				fmt.Print("\n\nExisting engagements found:\n\n")
 				for _, f := range files {
 
 					// Don't list "hidden" folders.
@@ -395,559 +506,369 @@ func main() {
 
 					if f.IsDir() {
 						engagementFolders = append(engagementFolders, f.Name())
-						fmt.Println("-", f.Name())
+					}
+				}
+
+				// As with contacts, there's no need to list them if the organization's already been given.
+				if spec.Organization == "" {
+					fmt.Print("\n\nExisting engagements found:\n\n")
+					for _, folderName := range engagementFolders {
+						fmt.Println("-", folderName)
 					}
 				}
 			}
 		}
 	}
 
-	// Setup auto-completer.
-	completer := &FolderCompleter{Folders: engagementFolders}
-	rl.Config.AutoComplete = completer
-
-	for {
-		fmt.Print("\nEnter the organization's name.\n")
-		organizationSelected, err = rl.Readline()
-		if err != nil {
-			if err.Error() == "Interrupt" {
-				fmt.Println(redText("Exiting from user input."))
-			} else {
-				fmt.Print(redText("Error reading line: ", err))
-				continue
-			}
-			return
+	// Setup auto-completer. A new engagement may already be a project on GitLab that just isn't here yet.
+	useFolderCompleter(rl, func() []completionCandidate {
+		if mustExist {
+			return organizationCandidates()
 		}
-		organizationSelected = strings.TrimSpace(organizationSelected)
-		organizationSelected = strings.ReplaceAll(organizationSelected, " ", "-")
-		organizationSelected = removeBannedSymbols.ReplaceAllString(organizationSelected, "")
+		return append(organizationCandidates(), remoteOrganizationCandidates()...)
+	})
 
-		if organizationSelected == "" {
-			fmt.Print(redText("Invalid input. You must input something here."))
-			continue
-		} else {
-			break
+	if !resolveAnswer(rl, spec.sources, "organization", specString(spec.Organization), "\nEnter the organization's name.\n", func(input string) (err error) {
+		organizationSelected, err = normalizeOrganization(input)
+		if err == nil && mustExist && !slices.Contains(engagementFolders, organizationSelected) {
+			return fmt.Errorf("There's no existing engagement named \"%s\".", organizationSelected)
 		}
+		return err
+	}) {
+		return false
 	}
 
 	// Now that we know what the organization's name is, define its path.
 	organizationPath = filepath.Join(gitRepoPath, "Customer-Engagements", organizationSelected)
+	logger.Info("organization selected", "org", organizationSelected, "path", organizationPath)
+	journalAnswers(func(answers *engagementSpec) { answers.Organization = organizationSelected })
+	useEngagementRemote(organizationPath)
+	return true
+}
 
-	if submitToRemoteRepo {
+// Checks whether the organization's GitLab project exists, fetching it if so, and asks for the abbreviation a new one
+// needs. Returns false if the user interrupted.
+func checkRemoteProject(rl *readline.Instance, spec *engagementSpec) bool {
+	// And we can check if the remote repo exists! Fetch it now!
+	exists, err := CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, organizationPath)
+	if err != nil {
+		fail(failureGitLab, "\nError checking project existence: ", redactError(err))
+	}
 
-		// And we can check if the remote repo exists! Fetch it now!
-		exists, err := CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, organizationPath)
-		if err != nil {
-			fmt.Print(redText("\nError checking project existence: ", err))
-			os.Exit(1)
+	if exists {
+		// I've probably printed enough messages about the repo existing at this point, so I won't anymore.
+		needToCreateRemoteGitRepo = false
+	} else {
+		fmt.Print("\nThe project does not exist.")
+		needToCreateRemoteGitRepo = true
+	}
+
+	if needToCreateRemoteGitRepo {
+		if !resolveAnswer(rl, spec.sources, "abbreviation", spec.Abbreviation, "\nEnter the organization's abrreviation. If it's unknown, leave it empty.\n", func(input string) (err error) {
+			organizationAbbreviation, err = validateAbbreviation(input)
+			return err
+		}) {
+			return false
 		}
+		abbreviation := organizationAbbreviation
+		journalAnswers(func(answers *engagementSpec) { answers.Abbreviation = &abbreviation })
+	}
+	return true
+}
+
+// Lists the organization's contacts and asks which one this is for. With mustExist, only an existing one will do.
+// Returns false if the user interrupted.
+func promptContact(rl *readline.Instance, spec *engagementSpec, mustExist bool) bool {
+	// List existing contacts and setup auto-completion.
+	var contactFolders []string
 
-		if exists {
-			// I've probably printed enough messages about the repo existing at this point, so I won't anymore.
-			needToCreateRemoteGitRepo = false
+	if _, err := os.Stat(organizationPath); !os.IsNotExist(err) {
+		files, err := os.ReadDir(organizationPath)
+		if err != nil {
+			fail(failureGeneration, "\nError reading directory: ", err)
 		} else {
-			fmt.Print("\nThe project does not exist.")
-			needToCreateRemoteGitRepo = true
-		}
+			for _, f := range files {
 
-		if needToCreateRemoteGitRepo {
-			for {
-				fmt.Print("\nEnter the organization's abrreviation. If it's unknown, leave it empty.\n")
-				organizationAbbreviation, err = rl.Readline()
-				if err != nil {
-					if err.Error() == "Interrupt" {
-						fmt.Print(redText("\nExiting from user input."))
-					} else {
-						fmt.Print(redText("\nError reading line: ", err))
-						continue
-					}
-					return
+				// We don't want your .git folders listed, thanks.
+				if strings.HasPrefix(f.Name(), ".") {
+					continue
 				}
-				organizationAbbreviation = strings.TrimSpace(organizationAbbreviation)
 
-				if organizationAbbreviation == "" {
-					break
-				} else if lettersPattern.MatchString(organizationAbbreviation) && organizationAbbreviation != "" {
-					fmt.Print(redText("\nInvalid input. You may only use letters in the abbreviation and at least 1 letter is required.\n"))
-					continue
-				} else {
-					break
+				if f.IsDir() {
+					contactFolders = append(contactFolders, f.Name())
+				}
+			}
+
+			// Only display the existing contacts message if there are valid folders found.
+			if len(contactFolders) > 0 && spec.Contact == "" {
+				fmt.Print("\n\nExisting contacts found:\n\n")
+				for _, folderName := range contactFolders {
+					fmt.Println("-", folderName)
 				}
 			}
 		}
 	}
 
-	if gitRepoPath != "" {
-
-		// List existing contacts and setup auto-completion.
-		var contactFolders []string
-
-		if _, err := os.Stat(organizationPath); !os.IsNotExist(err) {
-			files, err := os.ReadDir(organizationPath)
-			if err != nil {
-				fmt.Print(redText("\nError reading directory: ", err))
-				os.Exit(1)
-			} else {
-				for _, f := range files {
+	// Setup auto-completer with the valid folders found.
+	useFolderCompleter(rl, func() []completionCandidate { return contactCandidates(organizationPath) })
 
-					// We don't want your .git folders listed, thanks.
-					if strings.HasPrefix(f.Name(), ".") {
-						continue
-					}
-
-					if f.IsDir() {
-						contactFolders = append(contactFolders, f.Name())
-					}
-				}
-
-				// Only display the existing contacts message if there are valid folders found.
-				if len(contactFolders) > 0 {
-					fmt.Print("\n\nExisting contacts found:\n\n")
-					for _, folderName := range contactFolders {
-						fmt.Println("-", folderName)
-					}
-				}
-			}
+	if !resolveAnswer(rl, spec.sources, "contact", specString(spec.Contact), "\nEnter the organization's contact name. If it's unknown, leave it empty and it will populate as \"first-last\".\n", func(input string) (err error) {
+		organizationContact, err = normalizeContact(input)
+		if err == nil && mustExist && !slices.Contains(contactFolders, organizationContact) {
+			return fmt.Errorf("%s has no contact named \"%s\".", organizationSelected, organizationContact)
 		}
+		return err
+	}) {
+		return false
+	}
+	logger.Info("contact selected", "org", organizationSelected, "contact", organizationContact)
+	journalAnswers(func(answers *engagementSpec) { answers.Contact = organizationContact })
+	return true
+}
 
-		// Setup auto-completer with the valid folders found.
-		completer := &FolderCompleter{Folders: contactFolders}
-		rl.Config.AutoComplete = completer
+// Install asks for a case number. Returns false if the user interrupted.
+func promptCaseNumber(rl *readline.Instance, spec *engagementSpec) bool {
+	if team != "install" {
+		return true
+	}
 
-		for {
-			fmt.Print("\nEnter the organization's contact name. If it's unknown, leave it empty and it will populate as \"first-last\".\n")
-			organizationContact, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
+	// A caseNumber of 0 in the spec deliberately skips it.
+	var caseNumberSpec *string
+	if spec.CaseNumber != nil {
+		caseNumberSpec = new(string)
+		if *spec.CaseNumber != 0 {
+			*caseNumberSpec = strconv.Itoa(*spec.CaseNumber)
+		}
+	}
 
-			organizationContact = strings.TrimSpace(organizationContact)
-			organizationContact = strings.TrimSpace(strings.ToLower(organizationContact))
+	if !resolveAnswer(rl, spec.sources, "caseNumber", caseNumberSpec, "Enter the Salesforce Case Number associated with these scripts. Press Enter to skip.\n", func(input string) (err error) {
+		caseNumber, err = parseCaseNumber(input)
+		return err
+	}) {
+		return false
+	}
+	answeredCaseNumber := caseNumber
+	journalAnswers(func(answers *engagementSpec) { answers.CaseNumber = &answeredCaseNumber })
+	return true
+}
 
-			if organizationContact == "" {
-				organizationContact = "first-last"
-				break
-			} else if lettersPattern.MatchString(organizationContact) && organizationContact != "" {
-				fmt.Print(redText("\nInvalid input. You may only use letters in the contact name and at least 1 letter is required.\n"))
-				continue
-			} else {
-				organizationContact = strings.ReplaceAll(organizationContact, " ", "-")
-				organizationContact = removeBannedSymbols.ReplaceAllString(organizationContact, "")
-				break
-			}
+// Fills in whatever each cluster is missing, asking how many there are first if there aren't any. Clusters are
+// numbered from firstNumber in messages, and none may be named the same as one in takenNames. Returns false if the user
+// interrupted.
+func promptClusters(rl *readline.Instance, spec *engagementSpec, clusters []clusterSpec, firstNumber int, takenNames []string) ([]clusterSpec, bool) {
+	// Without any clusters in the spec, ask how many there are and prompt for each of them.
+	if len(clusters) == 0 {
+		var clusterCount int
+		if !promptUntilValid(rl, "Enter the number of clusters you'd like to make scripts for. Entering nothing will select 1.\n", func(input string) (err error) {
+			clusterCount, err = parseClusterCount(input)
+			return err
+		}) {
+			return nil, false
 		}
+		clusters = make([]clusterSpec, clusterCount)
 	}
 
-	if team == "install" {
-		for {
-			fmt.Print("Enter the Salesforce Case Number associated with these scripts. Press Enter to skip.\n")
-			input, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
-			input = strings.TrimSpace(input)
-
-			// Don't accept anything other than numbers and blank input.
-			if input == "" {
-				break
-			} else if _, err := strconv.Atoi(input); err == nil && input != "" {
-				caseNumber, _ = strconv.Atoi(input)
-				if caseNumber < 01000000 {
-					fmt.Print(redText("\nAre you sure that's the right Case Number? It seems a bit too small.\n"))
-					continue
-				} else if caseNumber > 20000000 {
-					fmt.Print(redText("\nAre you sure that's the right Case Number? It seems a bit too large.\n"))
-					continue
-				}
-				break
-			} else {
-				fmt.Print(redText("\nInvalid input. You must input nothing or a valid case number."))
-				continue
-			}
+	// Each cluster's answers are journaled as they're given, so even a half-answered cluster can be resumed.
+	resolve := func(field string, specValue *string, message string, parse func(input string) error) bool {
+		if !resolveAnswer(rl, spec.sources, field, specValue, message, parse) {
+			return false
 		}
+		journalAnswers(func(answers *engagementSpec) { answers.Clusters = slices.Clone(clusters) })
+		return true
 	}
 
-	for {
-		fmt.Print("Enter the number of clusters you'd like to make scripts for. Entering nothing will select 1.\n")
-		input, err = rl.Readline()
-		if err != nil {
-			if err.Error() == "Interrupt" {
-				fmt.Print(redText("\nExiting from user input."))
-			} else {
-				fmt.Print(redText("\nError reading line: ", err))
-				continue
-			}
-			return
+	for i := range clusters {
+		cluster := &clusters[i]
+		clusterNumber := firstNumber + i
+		clusterField := func(field string) string {
+			return fmt.Sprintf("cluster #%d's %s", i+1, field)
 		}
-		input = strings.TrimSpace(input)
 
-		// Don't accept anything other than numbers and blank input.
-		if input == "" {
-			clusterCount = 1
-			break
+		// Fill in what -mpi, -submission and -remote-configs answer for every cluster.
+		if cluster.CustomMPI == nil && spec.clusterDefaults.CustomMPI != nil {
+			cluster.CustomMPI = spec.clusterDefaults.CustomMPI
+			spec.sources[clusterField("customMPI")] = "-mpi"
+		}
+		if cluster.SubmissionType == "" && spec.clusterDefaults.SubmissionType != "" {
+			cluster.SubmissionType = spec.clusterDefaults.SubmissionType
+			spec.sources[clusterField("submissionType")] = "-submission"
+		}
+		if cluster.RemoteConfigs == nil && spec.clusterDefaults.RemoteConfigs != nil {
+			cluster.RemoteConfigs = spec.clusterDefaults.RemoteConfigs
+			spec.sources[clusterField("remoteConfigs")] = "-remote-configs"
 		}
 
-		if _, err := strconv.Atoi(input); err == nil {
-			clusterCount, _ = strconv.Atoi(input)
-			if clusterCount < 1 {
-				fmt.Print(redText("\nInvalid input. You've selected zero or less clusters to create scripts for.\n"))
-				continue
+		if !resolve(clusterField("name"), specString(cluster.Name), fmt.Sprint("\nEnter cluster #", clusterNumber, "'s name. Entering nothing will use \"HPC\"\n"), func(input string) error {
+			_, profileName, err := normalizeClusterName(input)
+			if err == nil && slices.ContainsFunc(takenNames, func(taken string) bool { return strings.EqualFold(taken, profileName) }) {
+				return fmt.Errorf("This engagement already has a cluster named \"%s\".", profileName)
 			}
-			break
-		} else {
-			fmt.Print(redText("\nInvalid input. Please enter an integer greater than zero.\n"))
-			continue
+			cluster.Name = profileName
+			return err
+		}) {
+			return nil, false
 		}
-	}
+		takenNames = append(takenNames, cluster.Name)
 
-	// Loop cluster creation for as many times as you specified.
-	for i := 1; i <= clusterCount; i++ {
-		for {
-			fmt.Print("\nEnter cluster #", i, "'s name. Entering nothing will use \"HPC\"\n")
-			clusterName, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
+		if !resolve(clusterField("scheduler"), specString(cluster.Scheduler), "Select the scheduler you'd like to use by entering its number or name, such as sge or k8s. Entering nothing will select Slurm.\n"+schedulerMenu()+"\n", func(input string) (err error) {
+			cluster.Scheduler, err = parseScheduler(input)
+			return err
+		}) {
+			return nil, false
+		}
 
-			// The "profileName" is used for the cluster profile's name.
-			profileName = strings.TrimSpace(clusterName)
-			profileName = strings.ReplaceAll(profileName, " ", "-")
-			clusterName = strings.TrimSpace(strings.ToLower(profileName))
-			clusterName = removeBannedSymbols.ReplaceAllString(clusterName, "")
-
-			if clusterName == "" {
-				clusterName = "hpc"
-				profileName = "HPC"
-				break
-			} else if lettersAndNumbersPattern.MatchString(clusterName) && clusterName != "" {
-				fmt.Print(redText("\nInvalid input. You must include at least 1 letter or number in the cluster's name.\n"))
-				continue
-			} else {
-				break
-			}
+		if !resolve(clusterField("customMPI"), specBool(cluster.CustomMPI), "Would you like to use include the custom MPI file? (y/n) Entering nothing will not include it.\n", func(input string) error {
+			customMPI, err := parseYesNo(input)
+			cluster.CustomMPI = &customMPI
+			return err
+		}) {
+			return nil, false
 		}
 
-		// Map numbers to actual scheduler names.
-		schedulerMap := map[int]string{
-			1: "slurm",
-			2: "pbs",
-			3: "lsf",
-			4: "gridengine",
-			5: "htcondor",
-			6: "awsbatch",
-			7: "kubernetes",
+		if !resolve(clusterField("submissionType"), specString(cluster.SubmissionType), "Select the submissions types you'd like to include by entering its corresponding number. Entering nothing will select both.\n[1 Desktop] [2 Cluster] [3 Both]\n", func(input string) (err error) {
+			cluster.SubmissionType, err = parseSubmissionType(input)
+			return err
+		}) {
+			return nil, false
 		}
 
-		for {
-			fmt.Print("Select the scheduler you'd like to use by entering its corresponding number. Entering nothing will select Slurm.\n")
-			fmt.Print("[1 Slurm] [2 PBS] [3 LSF] [4 Grid Engine] [5 HTCondor] [6 AWS] [7 Kubernetes]\n")
-			schedulerSelected, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
+		if !resolve(clusterField("remoteConfigs"), specBool(cluster.RemoteConfigs), "Would you like to include the remote submission configuration files? (y/n) Entering nothing will exclude them.\n", func(input string) error {
+			includeRemoteConfigFiles, err := parseYesNo(input)
+			cluster.RemoteConfigs = &includeRemoteConfigFiles
+			return err
+		}) {
+			return nil, false
+		}
 
-			if schedulerSelected == "" {
-				schedulerSelected = "slurm"
-				break
-			}
+		if !resolve(clusterField("workers"), specInt(cluster.Workers), "Enter the number of workers available on the cluster's license. Entering nothing will select 100,000.\n", func(input string) (err error) {
+			cluster.Workers, err = parseWorkerCount(input)
+			return err
+		}) {
+			return nil, false
+		}
 
-			// Parse for an integer to make for some prettier code later.
-			var schedulerNumberSelected int
-			parsedInt, err := strconv.Atoi(schedulerSelected)
-			if err != nil {
-				fmt.Print(redText("\nYou did not enter a number. Enter a number to select a scheduler.\n"))
-				continue
-			} else {
-				schedulerNumberSelected = parsedInt
+		if cluster.SubmissionType == "desktop" || cluster.SubmissionType == "both" {
+			if !resolve(clusterField("matlabRoot"), specString(cluster.MatlabRoot), "What is the full filepath of MATLAB on the cluster? (ex: /usr/local/MATLAB/R2024a)\n", func(input string) (err error) {
+				cluster.MatlabRoot, err = validateMatlabRoot(input)
+				return err
+			}) {
+				return nil, false
 			}
-
-			if schedulerNumberSelected < 1 || schedulerNumberSelected > 7 {
-				fmt.Print(redText("\nYou selected an invalid number. You must select a number between 1-7.\n"))
-				continue
-			} else {
-				schedulerSelected = schedulerMap[schedulerNumberSelected]
-				break
+			if warning := matlabRootWarning(cluster.MatlabRoot); warning != "" {
+				redText := color.New(color.FgRed).SprintFunc()
+				fmt.Print(redText("\n", warning, "\n"))
+				logger.Warn("MATLAB root is for another release", "cluster", cluster.Name, "matlabRoot", cluster.MatlabRoot, "release", releaseNumber)
 			}
-		}
 
-		for {
-			fmt.Print("Would you like to use include the custom MPI file? (y/n) Entering nothing will not include it.\n")
-			customMPIInput, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
+			if !resolve(clusterField("hostname"), specString(cluster.Hostname), "What is the hostname, FQDN, or IP address used to SSH to the cluster?\n", func(input string) (err error) {
+				cluster.Hostname, err = validateHostname(input)
+				return err
+			}) {
+				return nil, false
 			}
+		}
+	}
+	return clusters, true
+}
 
-			customMPIInput = strings.TrimSpace(strings.ToLower(customMPIInput))
+// Gets the plugins for the schedulers the clusters use. Exits if any can't be had, since generation needs them all.
+func fetchEngagementPlugins(ctx context.Context, clusters []clusterSpec) {
+	if !downloadScriptsOnLanuch {
+		return
+	}
 
-			if customMPIInput == "y" || customMPIInput == "yes" {
-				customMPI = true
-				break
-			} else if customMPIInput == "n" || customMPIInput == "no" || customMPIInput == "" {
-				break
-			} else {
-				fmt.Print(redText("\nInvalid input. You must enter one of the following: \"y\" or \"n\".\n"))
-				continue
-			}
-		}
+	neededSchedulers := clusterSchedulers(clusters)
 
-		for {
-			fmt.Print("Select the submissions types you'd like to include by entering its corresponding number. Entering nothing will select both.\n")
-			fmt.Print("[1 Desktop] [2 Cluster] [3 Both]\n")
-			submissionType, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
-			submissionType = strings.TrimSpace(strings.ToLower(submissionType))
-
-			if submissionType == "" {
-				submissionType = "both"
-				break
-			} else if submissionType == "1" || submissionType == "2" || submissionType == "3" {
-				switch submissionType {
-				case "1":
-					submissionType = "desktop"
-				case "2":
-					submissionType = "cluster"
-				case "3":
-					submissionType = "both"
-				}
-				break
-			} else if submissionType == "cluster" || submissionType == "desktop" || submissionType == "both" {
-				break
-			} else {
-				fmt.Print(redText("\nInvalid input. Enter a number between 1-3 to select a submission type.\n"))
-				continue
-			}
+	// These are downloaded together, so a dry run just lists them.
+	if dryRun {
+		for _, scheduler := range neededSchedulers {
+			plannedSteps = append(plannedSteps, planStep{Action: "get plugin", Source: scheduler.source(), Destination: filepath.Join(scriptsPath, scheduler.ArchiveFolder)})
 		}
+		return
+	}
 
-		for {
-			fmt.Print("Would you like to include the remote submission configuration files? (y/n) Entering nothing will exclude them.\n")
-			input, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
-			input = strings.TrimSpace(strings.ToLower(input))
+	cancellable.Store(true)
+	failures := downloadPlugins(ctx, neededSchedulers, scriptsPath, activeSettings.CachePath, activeSettings.DownloadWorkers)
+	cancellable.Store(false)
 
-			if input == "y" || input == "yes" {
-				includeRemoteConfigFiles = true
-				break
-			} else if input == "n" || input == "no" || input == "" {
-				break
-			} else {
-				fmt.Print(redText("Invalid input. You must enter one of the following: \"y\" or \"n\".\n"))
-				continue
-			}
-		}
+	if ctx.Err() != nil {
+		fail(failureInterrupted, "\nDownloads cancelled. Exiting.")
+	}
+	if failures > 0 {
+		fail(failurePlugins, "\nThe integration scripts for every cluster are needed to continue. Exiting.")
+	}
+	fmt.Print("\n")
+}
 
-		for {
-			fmt.Print("Enter the number of workers available on the cluster's license. Entering nothing will select 100,000.\n")
-			input, err = rl.Readline()
-			if err != nil {
-				if err.Error() == "Interrupt" {
-					fmt.Print(redText("\nExiting from user input."))
-				} else {
-					fmt.Print(redText("\nError reading line: ", err))
-					continue
-				}
-				return
-			}
-			input = strings.TrimSpace(input)
+// Builds each cluster's scripts and moves them into the contact's folder, alongside what's already there. The
+// engagement-wide files, such as the docs, are only copied with includeEngagementFiles. Afterwards the lockfile and
+// engagement record are updated and the organization's local Git repo is created if it needs to be.
+func generateEngagement(clusters []clusterSpec, includeEngagementFiles bool) {
+	checkBeforeGenerating(clusters, includeEngagementFiles)
+	report.Clusters = clusters
 
-			if input == "" {
-				numberOfWorkers = 100000
-				break
-			}
+	organizationContactPath := filepath.Join(organizationPath, organizationContact)
+	tmpOrganizationContactPath := filepath.Join(tmpFolder, organizationContact)
+	tmpEngagementPath = tmpOrganizationContactPath
+	if !dryRun {
+		resumeGeneration(tmpOrganizationContactPath)
+		journalGenerating(tmpOrganizationContactPath)
+	}
 
-			// Don't accept anything other than numbers.
-			if _, err := strconv.Atoi(input); err == nil {
-				numberOfWorkers, _ = strconv.Atoi(input)
-				if numberOfWorkers < 1 {
-					fmt.Print(redText("\nInvalid input. You've selected zero or less workers.\n"))
-					continue
-				} else if numberOfWorkers > 100000 {
-					fmt.Print(redText("\nInvalid input. You've selected more than 100000 workers, which is not offered on any license.\n"))
-					continue
-				} else if numberOfWorkers < 16 { // You've likely got bigger problems on your hands...
-					fmt.Print(redText("\nMATLAB Parallel Server licenses typically aren't issued with and may not work with less than 16 seats. You likely have a bigger issue at hand...\n"))
-					continue
-				}
+	// Copies a file or folder for cluster (or the whole engagement, if it's "").
+	copyTask := func(cluster string, task fileCopyTask, sourceFilePath string) {
+		destFilePath := filepath.Join(task.destinationBasePath, task.destinationFileName)
 
-				break
-			} else {
-				fmt.Print(redText("Invalid input. You've likely included a character other than a number.\n"))
-				continue
-			}
+		if task.isDirectory {
+			perform(planStep{Cluster: cluster, Action: "copy folder", Source: sourceFilePath, Destination: destFilePath, failure: "Failed to copy the directory",
+				run: func() error { return copyDirectory(sourceFilePath, destFilePath) }})
+		} else {
+			perform(planStep{Cluster: cluster, Action: "copy file", Source: sourceFilePath, Destination: destFilePath, failure: "Failed to copy the file",
+				run: func() error { return copyFile(sourceFilePath, destFilePath) }})
 		}
+	}
 
-		if submissionType == "desktop" || submissionType == "both" {
-			for {
-				fmt.Print("What is the full filepath of MATLAB on the cluster? (ex: /usr/local/MATLAB/R2024a)\n")
-				clusterMatlabRoot, err = rl.Readline()
-				if err != nil {
-					if err.Error() == "Interrupt" {
-						fmt.Print(redText("\nExiting from user input."))
-					} else {
-						fmt.Print(redText("\nError reading line: ", err))
-						continue
-					}
-					return
-				}
-				clusterMatlabRoot = strings.TrimSpace(clusterMatlabRoot)
-
-				if strings.Contains(clusterMatlabRoot, "/") || strings.Contains(clusterMatlabRoot, "\\") {
-					break
-				} else {
-					fmt.Print(redText("Invalid filepath.\n"))
-					continue
-				}
-			}
+	deleteTask := func(cluster, fileToDelete string) {
+		perform(planStep{Cluster: cluster, Action: "delete", Path: fileToDelete, failure: "Failed to delete the file or folder",
+			run: func() error { return deleteFileOrFolder(fileToDelete) }})
+	}
 
-			for {
-				fmt.Print("What is the hostname, FQDN, or IP address used to SSH to the cluster?\n")
-				clusterHostname, err = rl.Readline()
-				if err != nil {
-					if err.Error() == "Interrupt" {
-						fmt.Print(redText("\nExiting from user input."))
-					} else {
-						fmt.Print(redText("\nError reading line: ", err))
-						continue
-					}
-					return
-				}
-				clusterHostname = strings.TrimSpace(clusterHostname)
+	// Loop cluster creation for as many clusters as you specified.
+	for i := 1; i <= len(clusters); i++ {
+		cluster := clusters[i-1]
+		clusterName, profileName, _ := normalizeClusterName(cluster.Name)
+		schedulerSelected := cluster.Scheduler
+		scheduler, _ := findScheduler(schedulerSelected)
+		customMPI := *cluster.CustomMPI
+		submissionType := cluster.SubmissionType
+		includeRemoteConfigFiles := *cluster.RemoteConfigs
+		numberOfWorkers := cluster.Workers
+		clusterMatlabRoot := cluster.MatlabRoot
+		clusterHostname := cluster.Hostname
 
-				if clusterHostname == "" {
-					fmt.Print(redText("Invalid input. You must input something here."))
-					continue
-				} else {
-					break
-				}
-			}
+		if !dryRun {
+			fmt.Print("\nCreating integration scripts for ", profileName, "...")
 		}
-		fmt.Print("\nCreating integration scripts for cluster #", i, "...")
+		logger.Info("generating cluster", "org", organizationSelected, "contact", organizationContact, "cluster", clusterName, "scheduler", scheduler.Name, "release", releaseNumber, "hostname", clusterHostname, "dryRun", dryRun)
 
 		// This is where Big Things Part 1(tm) will happen.
 		// These will be used in and out of if statements, so let's setup them up now.
-		organizationContactPath = filepath.Join(organizationPath, organizationContact)
-		tmpOrganizationContactPath = filepath.Join(tmpFolder, organizationContact)
 		docPath := filepath.Join(tmpOrganizationContactPath, "doc")
 		matlabPath := filepath.Join(tmpOrganizationContactPath, "scripts", schedulerSelected, releaseNumber, "matlab")
 		IntegrationScriptsPath := filepath.Join(matlabPath, "IntegrationScripts")
 
 		// Let's assume you aren't massively screwing with things. We should only need to do these things once.
-		if i == 1 {
-
+		if i == 1 && includeEngagementFiles {
 			// Copy new engagement files.
 			// Add some code that'll skip everything but the conf file if your team isn't parallel.
-			tasks := []fileCopyTask{
-				{sourceFile: filepath.Join("Utilities", "doc", "Getting_Started_With_Serial_And_Parallel_MATLAB.docx"), destinationFileName: "Getting_Started_With_Serial_And_Parallel_MATLAB.docx", destinationBasePath: docPath},
-				{sourceFile: filepath.Join("Utilities", "doc", "README.txt"), destinationFileName: "README.txt", destinationBasePath: docPath},
-				{sourceFile: filepath.Join("Utilities", "pub"), destinationFileName: "", destinationBasePath: filepath.Join(tmpOrganizationContactPath, "pub"), isDirectory: true},
-			}
-
-			for _, task := range tasks {
-				sourceFilePath := filepath.Join(gitRepoPath, task.sourceFile)
-				destFilePath := filepath.Join(task.destinationBasePath, task.destinationFileName)
-
-				if task.isDirectory {
-					err := copyDirectory(sourceFilePath, destFilePath)
-					if err != nil {
-						fmt.Print(redText("\nFailed to copy the directory: ", err))
-						cleanUpTempFiles(tmpOrganizationContactPath)
-					}
-				} else {
-					err := copyFile(sourceFilePath, destFilePath)
-					if err != nil {
-						fmt.Print(redText("\nFailed to copy the file: ", err))
-						cleanUpTempFiles(tmpOrganizationContactPath)
-					}
-				}
+			for _, task := range engagementCopyTasks(docPath, tmpOrganizationContactPath) {
+				copyTask("", task, filepath.Join(gitRepoPath, task.sourceFile))
 			}
 		}
 
 		// Back to make cluster i's stuff!
-		tasks := []fileCopyTask{
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "config-scripts", schedulerSelected, "bin"), destinationFileName: "", destinationBasePath: filepath.Join(tmpOrganizationContactPath, "scripts", schedulerSelected, releaseNumber, "bin"), isDirectory: true},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "ClientJavaLogging.p"), destinationFileName: "ClientJavaLogging.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "ClientJavaMessageHandler.p"), destinationFileName: "ClientJavaMessageHandler.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "Finalize.p"), destinationFileName: "Finalize.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "Init.p"), destinationFileName: "Init.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "helper-fcn", schedulerSelected), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "helper-fcn", "common"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "conf-files"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
-			{sourceFile: filepath.Join(gitRepoPath, "Utilities", "matlab-files"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
-			{sourceFile: filepath.Join(scriptsPath, "matlab-parallel-"+schedulerSelected+"-plugin-main"), destinationFileName: "", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName), isDirectory: true},
-			{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "communicatingSubmitFcn.m"), destinationFileName: "communicatingSubmitFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
-			{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "getCommonSubmitArgs.m"), destinationFileName: "getCommonSubmitArgs.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName, "private")},
-			{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "getRemoteConnection.m"), destinationFileName: "getRemoteConnection.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName, "private")},
-			{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "independentSubmitFcn.m"), destinationFileName: "independentSubmitFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
-			{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "postConstructFcn.m"), destinationFileName: "postConstructFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
-		}
-
-		for i, task := range tasks {
-
-			// They don't have anything special for these schedulers.
-			if schedulerSelected == "awsbatch" || schedulerSelected == "kubernetes" || schedulerSelected == "htcondor" && (i == 0 || i == 5) {
-				continue
-			}
-
-			destFilePath := filepath.Join(task.destinationBasePath, task.destinationFileName)
-
-			if task.isDirectory {
-				err := copyDirectory(task.sourceFile, destFilePath)
-				if err != nil {
-					fmt.Print(redText("\nFailed to copy the directory: ", err))
-					cleanUpTempFiles(tmpOrganizationContactPath)
-				}
-			} else {
-				err := copyFile(task.sourceFile, destFilePath)
-				if err != nil {
-					fmt.Print(redText("\nFailed to copy the file: ", err))
-					cleanUpTempFiles(tmpOrganizationContactPath)
-				}
-			}
+		for _, task := range clusterCopyTasks(scheduler, clusterName, tmpOrganizationContactPath) {
+			copyTask(profileName, task, task.sourceFile)
 		}
 
 		// Yes, the method I'm using is to delete the files after all possibly needed ones are copied.
@@ -958,50 +879,25 @@ func main() {
 			filepath.Join(IntegrationScriptsPath, clusterName, "discover"),
 		}
 
-		for _, fileToDelete := range filesToDelete {
-			err := deleteFileOrFolder(fileToDelete)
-			if err != nil {
-				fmt.Println(redText("\nFailed to delete the file or folder: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
-		}
-
 		if !customMPI {
-			fileToDelete := filepath.Join(matlabPath, "mpiLibConf.m")
-			err := deleteFileOrFolder(fileToDelete)
-			if err != nil {
-				fmt.Print(redText("\nFailed to delete the file: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
+			filesToDelete = append(filesToDelete, filepath.Join(matlabPath, "mpiLibConf.m"))
 		}
 
 		if !includeRemoteConfigFiles {
-			filesToDelete := []string{
+			filesToDelete = append(filesToDelete,
 				filepath.Join(matlabPath, "hpcRemoteCluster.conf"),
 				filepath.Join(matlabPath, "hpcRemoteDesktop.conf"),
-			}
-
-			for _, fileToDelete := range filesToDelete {
-				err := deleteFileOrFolder(fileToDelete)
-				if err != nil {
-					fmt.Println(redText("\nFailed to delete the file: ", err))
-					cleanUpTempFiles(tmpOrganizationContactPath)
-				}
-			}
+			)
 		}
 
 		if submissionType == "cluster" {
-			err := deleteFileOrFolder(filepath.Join(matlabPath, "hpcDesktop.conf"))
-			if err != nil {
-				fmt.Println(redText("\nFailed to delete the file: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
+			filesToDelete = append(filesToDelete, filepath.Join(matlabPath, "hpcDesktop.conf"))
 		} else if submissionType == "desktop" {
-			err := deleteFileOrFolder(filepath.Join(matlabPath, "hpcCluster.conf"))
-			if err != nil {
-				fmt.Println(redText("\nFailed to delete the file: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
+			filesToDelete = append(filesToDelete, filepath.Join(matlabPath, "hpcCluster.conf"))
+		}
+
+		for _, fileToDelete := range filesToDelete {
+			deleteTask(profileName, fileToDelete)
 		}
 
 		confFilesToModify := []string{
@@ -1035,7 +931,9 @@ func main() {
 				continue
 			}
 
-			for contentToModify, modifiedContent := range originalContent {
+			// Sorted so the plan comes out the same every time.
+			for _, contentToModify := range sortedKeys(originalContent) {
+				modifiedContent := originalContent[contentToModify]
 
 				if (fileToModify == "hpcCluster.conf" || fileToModify == "hpcRemoteCluster") && contentToModify == "ClusterMatlabRoot = " {
 					continue
@@ -1043,26 +941,20 @@ func main() {
 					continue
 				}
 
-				if (schedulerSelected == "pbs" || schedulerSelected == "lsf" || schedulerSelected == "gridengine") && contentToModify == "QueueName = " {
+				if scheduler.has(capabilityQueueName) && contentToModify == "QueueName = " {
 					continue
-				} else if schedulerSelected == "slurm" && contentToModify == "Partition = " {
+				} else if scheduler.has(capabilityPartition) && contentToModify == "Partition = " {
 					continue
 				}
 
-				err = ModifyFileContents(fileToModifyFullPath, contentToModify, modifiedContent)
-				if err != nil {
-					fmt.Println(redText("\nFailed to modify the file: ", err))
-					cleanUpTempFiles(tmpOrganizationContactPath)
-				}
+				perform(planStep{Cluster: profileName, Action: "replace", Path: fileToModifyFullPath, Find: contentToModify, Replace: modifiedContent, failure: "Failed to modify the file",
+					run: func() error { return ModifyFileContents(fileToModifyFullPath, contentToModify, modifiedContent) }})
 			}
 
 			modifiedFileName := strings.ReplaceAll(fileToModifyFullPath, "hpc", clusterName)
 
-			err = renameFile(fileToModifyFullPath, modifiedFileName)
-			if err != nil {
-				fmt.Println(redText("\nFailed to rename the file: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
+			perform(planStep{Cluster: profileName, Action: "rename", Source: fileToModifyFullPath, Destination: modifiedFileName, failure: "Failed to rename the file",
+				run: func() error { return renameFile(fileToModifyFullPath, modifiedFileName) }})
 		}
 
 		wrappersToModify := []string{
@@ -1083,80 +975,166 @@ fi
 
 # If "`
 
-			err := ModifyMultiLineFileContents(fileToModifyFullPath, oldText, newText)
-			if err != nil {
-				fmt.Println(redText("\nFailed to modify the file: ", err))
-				cleanUpTempFiles(tmpOrganizationContactPath)
-			}
+			perform(planStep{Cluster: profileName, Action: "patch", Path: fileToModifyFullPath, Detail: "set TZ from timedatectl if it isn't already", failure: "Failed to modify the file",
+				run: func() error { return ModifyMultiLineFileContents(fileToModifyFullPath, oldText, newText) }})
 		}
 
-		fmt.Print("\nFinished script creation for cluster #", i, "!")
+		if !dryRun {
+			fmt.Print("\nFinished script creation for ", profileName, "!")
+		}
 	}
 
 	// Move everything to its permanent location.
-	err = moveDirectory(tmpOrganizationContactPath, organizationContactPath)
-	if err != nil {
-		fmt.Println(redText("\nFailed to move the file: "), err)
-		cleanUpTempFiles(tmpOrganizationContactPath)
-	}
+	perform(planStep{Action: "move", Source: tmpOrganizationContactPath, Destination: organizationContactPath, failure: "Failed to move the file",
+		run: func() error { return moveDirectory(tmpOrganizationContactPath, organizationContactPath) }})
+
+	// Record exactly which upstream scripts this engagement was built from.
+	perform(planStep{Action: "write", Path: filepath.Join(organizationContactPath, pluginLockfileName), Detail: "the plugin lockfile", failure: "Error writing the plugin lockfile",
+		run: func() error {
+			// Clusters sharing a scheduler share its plugin, so it's only recorded once.
+			var pluginLocks []pluginLock
+			for _, scheduler := range clusterSchedulers(clusters) {
+				pluginLocks = append(pluginLocks, localPluginLock(scheduler, scriptsPath))
+			}
+			report.Plugins = pluginLocks
+			return writePluginLockfile(organizationContactPath, releaseNumber, pluginLocks)
+		}})
+
+	// Also record the answers it was built with, so it can be added to or updated later.
+	perform(planStep{Action: "write", Path: filepath.Join(organizationContactPath, engagementRecordName), Detail: "the engagement record", failure: "Error writing the engagement record",
+		run: func() error { return updateEngagementRecord(organizationContactPath, clusters) }})
 
 	// The needless README.md file.
 	testFilePath := filepath.Join(organizationContactPath, "README.md")
 
-	file, err := os.Create(testFilePath)
-	if err != nil {
-		fmt.Print(redText("\nError creating file: ", err))
-		cleanUpTempFiles(tmpOrganizationContactPath)
-	}
-	defer file.Close()
+	perform(planStep{Action: "write", Path: testFilePath, Detail: "an empty README", failure: "Error creating file",
+		run: func() error {
+			file, err := os.Create(testFilePath)
+			if err != nil {
+				return err
+			}
+			return file.Close()
+		}})
 
 	// Create the local repo, if needed.
 	organizationDotGitFolder := filepath.Join(organizationPath, ".git")
 
 	if _, err := os.Stat(organizationDotGitFolder); os.IsNotExist(err) {
-		if err := createLocalGitRepo(organizationPath); err != nil {
-			fmt.Println(redText("\nError creating local Git repo: ", err))
-			os.Exit(1)
-		}
+		perform(planStep{Action: "git init", Path: organizationPath, failure: "Error creating local Git repo",
+			run: func() error { return createLocalGitRepo(organizationPath) }})
+		reportCommit(organizationPath)
 	} else if err != nil {
-		fmt.Print(redText("\nError checking if .git directory exists: ", err))
-		os.Exit(1)
-		return
-	} else {
+		fail(failureGit, "\nError checking if .git directory exists: ", err)
+	} else if !dryRun {
 		fmt.Println("\n.git directory already exists.")
 	}
+}
 
-	// This is where Big Things Part 2(tm) will happen (sort of.)
-	if submitToRemoteRepo {
-		fmt.Print("\nSubmitting to your remote Git repo...")
+// The files every engagement gets once, relative to gitRepoPath.
+func engagementCopyTasks(docPath, tmpOrganizationContactPath string) []fileCopyTask {
+	return []fileCopyTask{
+		{sourceFile: filepath.Join("Utilities", "doc", "Getting_Started_With_Serial_And_Parallel_MATLAB.docx"), destinationFileName: "Getting_Started_With_Serial_And_Parallel_MATLAB.docx", destinationBasePath: docPath},
+		{sourceFile: filepath.Join("Utilities", "doc", "README.txt"), destinationFileName: "README.txt", destinationBasePath: docPath},
+		{sourceFile: filepath.Join("Utilities", "pub"), destinationFileName: "", destinationBasePath: filepath.Join(tmpOrganizationContactPath, "pub"), isDirectory: true},
+	}
+}
 
-		// Create the repo on GitLab, if needed.
-		if needToCreateRemoteGitRepo {
-			projectURL, err := createGitLabRepo(organizationSelected, accessToken, gitRepoAPIURL, gitGroupID)
-			if err != nil {
-				fmt.Print(redText("\nError creating GitLab project: ", err))
-				os.Exit(1)
-				return
-			}
-			fmt.Print("\nGitLab project created: ", projectURL)
-		} else { // Commit the changes made and push them to the remote repo.
-			if err := remoteCommitAndPush(organizationPath, organizationSelected, gitUsername, accessToken); err != nil {
-				fmt.Print(redText("\nError committing or pushing: ", err))
-				os.Exit(1)
-				return
-			}
+// The files each cluster gets, leaving out any its scheduler doesn't have.
+func clusterCopyTasks(scheduler schedulerEntry, clusterName, tmpOrganizationContactPath string) []fileCopyTask {
+	schedulerSelected := scheduler.Name
+	matlabPath := filepath.Join(tmpOrganizationContactPath, "scripts", schedulerSelected, releaseNumber, "matlab")
+	IntegrationScriptsPath := filepath.Join(matlabPath, "IntegrationScripts")
+
+	tasks := []fileCopyTask{
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "config-scripts", schedulerSelected, "bin"), destinationFileName: "", destinationBasePath: filepath.Join(tmpOrganizationContactPath, "scripts", schedulerSelected, releaseNumber, "bin"), isDirectory: true, capability: capabilityConfigScripts},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "ClientJavaLogging.p"), destinationFileName: "ClientJavaLogging.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "ClientJavaMessageHandler.p"), destinationFileName: "ClientJavaMessageHandler.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "Finalize.p"), destinationFileName: "Finalize.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "+pctDebug", "Init.p"), destinationFileName: "Init.p", destinationBasePath: filepath.Join(matlabPath, "+pctDebug")},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "helper-fcn", schedulerSelected), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true, capability: capabilityHelperFunctions},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "helper-fcn", "common"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "conf-files"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
+		{sourceFile: filepath.Join(gitRepoPath, "Utilities", "matlab-files"), destinationFileName: "", destinationBasePath: matlabPath, isDirectory: true},
+		{sourceFile: filepath.Join(scriptsPath, scheduler.ArchiveFolder), destinationFileName: "", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName), isDirectory: true},
+		{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "communicatingSubmitFcn.m"), destinationFileName: "communicatingSubmitFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
+		{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "getCommonSubmitArgs.m"), destinationFileName: "getCommonSubmitArgs.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName, "private")},
+		{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "getRemoteConnection.m"), destinationFileName: "getRemoteConnection.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName, "private")},
+		{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "independentSubmitFcn.m"), destinationFileName: "independentSubmitFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
+		{sourceFile: filepath.Join(gitRepoPath, "Gold", releaseNumber, schedulerSelected, "postConstructFcn.m"), destinationFileName: "postConstructFcn.m", destinationBasePath: filepath.Join(IntegrationScriptsPath, clusterName)},
+	}
+
+	var available []fileCopyTask
+	for _, task := range tasks {
+
+		// Some schedulers don't have anything special for these.
+		if task.capability != "" && !scheduler.has(task.capability) {
+			continue
 		}
+		available = append(available, task)
+	}
+	return available
+}
 
-		if needToCreateRemoteGitRepo {
-			if err := publishMainBranch(organizationPath, organizationSelected, gitUsername, accessToken); err != nil {
-				fmt.Print(redText("\nError publishing main branch: ", err))
-				os.Exit(1)
-				return
-			}
-		}
+// Records the engagement's answers in the contact's folder, keeping any clusters it already had.
+func updateEngagementRecord(organizationContactPath string, clusters []clusterSpec) error {
+	record, err := readEngagementRecord(organizationContactPath)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = &engagementSpec{}
+	}
+
+	record.Organization = organizationSelected
+	record.Contact = organizationContact
+	record.Remote = activeSettings.Remote
+	if organizationAbbreviation != "" {
+		record.Abbreviation = &organizationAbbreviation
+	}
+	if caseNumber != 0 {
+		record.CaseNumber = &caseNumber
+	}
+	record.mergeClusters(clusters)
+	return writeEngagementRecord(organizationContactPath, record)
+}
+
+// This is where Big Things Part 2(tm) will happen (sort of.) Submits the organization's local repo to GitLab, creating
+// the project first if checkRemoteProject found it doesn't exist.
+func submitEngagement() {
+	if !dryRun {
+		fmt.Print("\nSubmitting to your remote Git repo...")
+	}
+
+	// Create the repo on GitLab, if needed.
+	if needToCreateRemoteGitRepo {
+		perform(planStep{Action: "gitlab create", Path: gitRepoAPIURL, Detail: fmt.Sprintf("project %s in group %d", organizationSelected, gitGroupID), failure: "Error creating GitLab project",
+			run: func() error {
+				projectURL, err := createGitLabRepo(organizationSelected, accessToken, gitRepoAPIURL, gitGroupID)
+				if err == nil {
+					fmt.Print("\nGitLab project created: ", projectURL)
+					logger.Info("GitLab project created", "org", organizationSelected, "url", projectURL)
+					reportedGitLab().Created = true
+					reportedGitLab().ProjectURL = projectURL
+				}
+				return err
+			}})
+		perform(planStep{Action: "git push", Path: organizationPath, Detail: "publish the main branch", failure: "Error publishing main branch",
+			run: func() error {
+				return publishMainBranch(organizationPath, organizationSelected, gitUsername, accessToken)
+			}})
+	} else { // Commit the changes made and push them to the remote repo.
+		perform(planStep{Action: "git push", Path: organizationPath, Detail: "commit everything and push", failure: "Error committing or pushing",
+			run: func() error {
+				return remoteCommitAndPush(organizationPath, organizationSelected, gitUsername, accessToken)
+			}})
+	}
+
+	if !dryRun {
 		fmt.Print("\nPushed to GitLab successfully.")
+		logger.Info("pushed to GitLab", "org", organizationSelected, "path", organizationPath)
+		reportedGitLab().Pushed = true
+		reportCommit(organizationPath)
 	}
-	fmt.Print("\nFinished!")
 }
 
 func ModifyFileContents(filePath, oldText, newText string) error {
@@ -1236,34 +1214,22 @@ func cleanUpTempFiles(tmpOrganizationContactPath string) error {
 	err := deleteFileOrFolder(tmpOrganizationContactPath)
 	if err != nil {
 		fmt.Print(redText("\nError deleting temporary engagement files: ", err))
-		os.Exit(2)
+		logger.Error("deleting temporary engagement files failed", "path", tmpOrganizationContactPath, "error", err)
+		exitRun(2)
 	}
-	os.Exit(2)
+	exitRun(2)
 	return err
 }
 
-func downloadFile(url string, filePath string) error {
-	response, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, response.Body)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
+// Limits on what unzipFile will extract. The plugins are a few MB, so anything near these is broken or malicious.
+// They're only changed by tests.
+var (
+	maxArchiveEntries             = 10000
+	maxArchiveExtractedSize int64 = 512 << 20
+)
 
-// Function to unzip integration scripts.
+// Function to unzip integration scripts. Entries that would land outside dest, such as "../../.bashrc" or absolute
+// paths, are rejected, as are symlinks and archives that extract to more than the limits above.
 func unzipFile(src, dest string) error {
 	reader, err := zip.OpenReader(src)
 	if err != nil {
@@ -1271,17 +1237,28 @@ func unzipFile(src, dest string) error {
 	}
 	defer reader.Close()
 
+	if len(reader.File) > maxArchiveEntries {
+		return fmt.Errorf("%s has %d entries, more than the %d allowed", filepath.Base(src), len(reader.File), maxArchiveEntries)
+	}
+
+	var extractedSize int64
 	for _, file := range reader.File {
-		path := filepath.Join(dest, file.Name)
+		// Zip entries always use forward slashes. filepath.IsLocal catches "..", absolute paths and, on Windows,
+		// drive letters and reserved names.
+		name := filepath.FromSlash(file.Name)
+		if !filepath.IsLocal(name) || strings.Contains(file.Name, "\\") {
+			return fmt.Errorf("%s contains an unsafe path: %s", filepath.Base(src), file.Name)
+		}
+		path := filepath.Join(dest, name)
 
-		// Reconstruct the file path on Windows to ensure proper subdirectories are created. Don't know why other OSes don't need this.
-		if runtime.GOOS == "windows" {
-			path = filepath.Join(dest, file.Name)
-			path = filepath.FromSlash(path)
+		if file.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s contains a symlink, which isn't allowed: %s", filepath.Base(src), file.Name)
 		}
 
 		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.Mode())
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -1290,24 +1267,38 @@ func unzipFile(src, dest string) error {
 			return err
 		}
 
-		fileReader, err := file.Open()
+		written, err := extractZipEntry(file, path, maxArchiveExtractedSize-extractedSize)
 		if err != nil {
 			return err
 		}
-		defer fileReader.Close()
+		extractedSize += written
+	}
+	return nil
+}
 
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return err
-		}
-		defer targetFile.Close()
+// Writes one entry to path, giving up if it turns out to be bigger than limit. The size in the zip's header isn't
+// trusted since it's easily faked.
+func extractZipEntry(file *zip.File, path string, limit int64) (int64, error) {
+	fileReader, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer fileReader.Close()
 
-		_, err = io.Copy(targetFile, fileReader)
-		if err != nil {
-			return err
-		}
+	targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode().Perm()|0600)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	defer targetFile.Close()
+
+	written, err := io.Copy(targetFile, io.LimitReader(fileReader, limit+1))
+	if err != nil {
+		return written, err
+	}
+	if written > limit {
+		return written, fmt.Errorf("the archive extracts to more than %s, which isn't allowed", formatBytes(maxArchiveExtractedSize))
+	}
+	return written, targetFile.Close()
 }
 
 func renameFile(oldPath, newPath string) error {
@@ -1410,22 +1401,15 @@ func copyDirectory(srcDir, destDir string) error {
 	return nil
 }
 
-func CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, localRepoPath string) (bool, error) {
+func CheckIfGitLabProjectExistsAndFetch(organizationSelected string, accessToken secret, localRepoPath string) (bool, error) {
 
-	redText := color.New(color.FgRed).SprintFunc()
 	urlToCheck := gitRepoAPIURL + gitGroupName + "%2F" + organizationSelected
 
-	// Need to remove everything after .com/ in your API URL for the cloneURL.
-	parts := strings.Split(gitRepoAPIURL, ".com")
-	baseURL := ""
-	if len(parts) > 0 {
-		baseURL = parts[0] + ".com"
-	} else {
-		return false, fmt.Errorf("'.com' not found in your gitRepoAPIURL")
+	cloneURL, err := gitLabProjectURL(gitRepoAPIURL, gitGroupName, organizationSelected)
+	if err != nil {
+		return false, err
 	}
 
-	cloneURL := fmt.Sprintf("%s/%s/%s.git", baseURL, gitGroupName, organizationSelected)
-
 	fmt.Println("\nChecking this project to see if it exists: " + urlToCheck)
 
 	// Create a new request
@@ -1435,11 +1419,10 @@ func CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, local
 	}
 
 	// Add the private token to the request headers for authentication.
-	req.Header.Add("PRIVATE-TOKEN", accessToken)
+	req.Header.Add("PRIVATE-TOKEN", accessToken.Reveal())
 
 	// Execute the request.
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return false, err
 	}
@@ -1452,24 +1435,27 @@ func CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, local
 	// A 200 status code means the project exists.
 	if resp.StatusCode == 200 {
 		fmt.Println("Project exists.")
+		reportedGitLab().ProjectURL = strings.TrimSuffix(cloneURL, ".git")
 
 		// Check if localRepoPath exists
 		if _, err := os.Stat(localRepoPath); os.IsNotExist(err) {
-			fmt.Println("Local repository path does not exist. Cloning repository...")
-
 			// Clone the repository.
-			_, err := git.PlainClone(localRepoPath, false, &git.CloneOptions{
-				URL:      cloneURL,
-				Progress: os.Stdout, // Show progress
-				Auth: &githttp.BasicAuth{
-					Username: gitUsername,
-					Password: accessToken,
-				},
-			})
-			if err != nil {
-				return true, fmt.Errorf("failed to clone repository: %w", err)
-			}
-			fmt.Println("Repository cloned.")
+			perform(planStep{Action: "git clone", Source: cloneURL, Destination: localRepoPath, failure: "Failed to clone repository",
+				run: func() error {
+					fmt.Println("Local repository path does not exist. Cloning repository...")
+					_, err := git.PlainClone(localRepoPath, false, &git.CloneOptions{
+						URL:      cloneURL,
+						Progress: os.Stdout, // Show progress
+						Auth: &githttp.BasicAuth{
+							Username: gitUsername,
+							Password: accessToken.Reveal(),
+						},
+					})
+					if err == nil {
+						fmt.Println("Repository cloned.")
+					}
+					return err
+				}})
 		} else {
 
 			// If the directory exists, attempt to open the repository.
@@ -1479,11 +1465,8 @@ func CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, local
 			}
 
 			// Fetch updates from the remote repository.
-			err = fetchUpdates(r)
-			if err != nil {
-				fmt.Print(redText("\nFailed to fetch updates: ", err))
-				os.Exit(1)
-			}
+			perform(planStep{Action: "git fetch", Path: localRepoPath, Detail: "fetch every ref from origin", failure: "Failed to fetch updates",
+				run: func() error { return fetchUpdates(r) }})
 		}
 
 		return true, nil
@@ -1495,7 +1478,7 @@ func CheckIfGitLabProjectExistsAndFetch(organizationSelected, accessToken, local
 		return false, err
 	}
 
-	return false, fmt.Errorf("GitLab API returned status %d: %s", resp.StatusCode, string(body))
+	return false, fmt.Errorf("GitLab API returned status %d: %s", resp.StatusCode, redactSecrets(string(body)))
 }
 
 func fetchUpdates(r *git.Repository) error {
@@ -1508,22 +1491,22 @@ func fetchUpdates(r *git.Repository) error {
 	// Get the remote configuration
 	remote, err := r.Remote("origin")
 	if err != nil {
-		fmt.Print(redText("\nFailed to get remote origin: ", err))
-		os.Exit(1)
+		fail(failureGit, "\nFailed to get remote origin: ", err)
 	}
 
 	// Fetch the latest changes from the remote repository with authentication
 	err = remote.Fetch(&git.FetchOptions{
 		Auth: &githttp.BasicAuth{
 			Username: gitUsername,
-			Password: accessToken,
+			Password: accessToken.Reveal(),
 		},
 		RefSpecs: []config.RefSpec{"refs/*:refs/*"},
 		Force:    true,
 	})
 
 	if err != nil && err != git.NoErrAlreadyUpToDate {
-		fmt.Print(redText("\nFailed to fetch updates: ", err))
+		fmt.Print(redText("\nFailed to fetch updates: ", redactError(err)))
+		logger.Warn("fetching updates failed", "org", organizationSelected, "error", redactError(err))
 	}
 
 	fmt.Print("\nFetch completed.")
@@ -1591,9 +1574,8 @@ func createLocalGitRepo(folderPath string) error {
 	return nil
 }
 
-func createGitLabRepo(projectName, accessToken, gitRepoAPIURL string, namespaceID int) (string, error) {
-	gitRepoAPIWithNoProjectURL := gitRepoAPIURL[:len(gitRepoAPIURL)-9]
-	git, err := gitlab.NewClient(accessToken, gitlab.WithBaseURL(gitRepoAPIWithNoProjectURL))
+func createGitLabRepo(projectName string, accessToken secret, gitRepoAPIURL string, namespaceID int) (string, error) {
+	git, err := gitlab.NewClient(accessToken.Reveal(), gitlab.WithBaseURL(gitLabAPIBaseURL(gitRepoAPIURL)), gitlab.WithHTTPClient(httpClient))
 	if err != nil {
 		return "", err
 	}
@@ -1619,19 +1601,13 @@ func createGitLabRepo(projectName, accessToken, gitRepoAPIURL string, namespaceI
 	return project.WebURL, nil
 }
 
-func remoteCommitAndPush(folderPath, projectName, gitUsername, accessToken string) error {
+func remoteCommitAndPush(folderPath, projectName, gitUsername string, accessToken secret) error {
 
-	// Need to remove everything after .com in your API URL for the constructedURL.
-	parts := strings.Split(gitRepoAPIURL, ".com")
-	baseURL := ""
-	if len(parts) > 0 {
-		baseURL = parts[0] + ".com"
-	} else {
-		return fmt.Errorf("'.com' not found in your gitRepoAPIURL")
+	constructedURL, err := gitLabProjectURL(gitRepoAPIURL, gitGroupName, projectName)
+	if err != nil {
+		return err
 	}
 
-	constructedURL := fmt.Sprintf("%s/%s/%s.git", baseURL, gitGroupName, projectName)
-
 	fmt.Printf("\nProject URL to commit to: %s", constructedURL)
 
 	r, err := git.PlainOpen(folderPath)
@@ -1690,7 +1666,7 @@ func remoteCommitAndPush(folderPath, projectName, gitUsername, accessToken strin
 		RemoteName: "origin",
 		Auth: &githttp.BasicAuth{
 			Username: gitUsername,
-			Password: accessToken,
+			Password: accessToken.Reveal(),
 		},
 	})
 	if err != nil {
@@ -1700,18 +1676,12 @@ func remoteCommitAndPush(folderPath, projectName, gitUsername, accessToken strin
 	return nil
 }
 
-func publishMainBranch(folderPath, projectName, gitUsername, accessToken string) error {
+func publishMainBranch(folderPath, projectName, gitUsername string, accessToken secret) error {
 
-	// Need to remove everything after .com/ in your API URL for the constructedURL.
-	parts := strings.Split(gitRepoAPIURL, ".com")
-	baseURL := ""
-	if len(parts) > 0 {
-		baseURL = parts[0] + ".com"
-	} else {
-		return fmt.Errorf("'.com' not found in your gitRepoAPIURL")
+	constructedURL, err := gitLabProjectURL(gitRepoAPIURL, gitGroupName, projectName)
+	if err != nil {
+		return err
 	}
-
-	constructedURL := fmt.Sprintf("%s/%s/%s.git", baseURL, gitGroupName, projectName)
 	fmt.Printf("\nPreparing to publish 'main' branch to: %s\n", constructedURL)
 
 	// Open the existing repo.
@@ -1739,7 +1709,7 @@ func publishMainBranch(folderPath, projectName, gitUsername, accessToken string)
 		RefSpecs:   []config.RefSpec{"refs/heads/main:refs/heads/main"},
 		Auth: &githttp.BasicAuth{
 			Username: gitUsername,
-			Password: accessToken,
+			Password: accessToken.Reveal(),
 		},
 	})
 	if err != nil {
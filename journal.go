@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// Kept next to the log in logPath while an engagement command runs, and deleted once it finishes.
+const sessionJournalName = "session.json"
+
+// The answers a run has been given so far, saved after each one so that an interrupted run can be picked up where it
+// stopped.
+type sessionJournal struct {
+	Command   string         `json:"command"`
+	StartedAt time.Time      `json:"startedAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Answers   engagementSpec `json:"answers"`
+
+	// Where the engagement was being put together, once generating started, and how many of the steps there were
+	// done for which release. Cleared once it's been moved into gitRepoPath.
+	TmpEngagementPath string `json:"tmpEngagementPath,omitempty"`
+	StepsDone         int    `json:"stepsDone,omitempty"`
+	Release           string `json:"release,omitempty"`
+}
+
+// An interrupted session's partly made engagement, which a resumed session carries on with.
+type interruptedGeneration struct {
+	tmpPath   string
+	stepsDone int
+	release   string
+	answers   []byte // As JSON, so they can be compared with the resumed session's.
+}
+
+var (
+	// The running session's journal. It's nil when there isn't one, such as for a dry run.
+	journal *sessionJournal
+
+	// Set when a session that had started generating is resumed, until generating starts again.
+	resumedGeneration *interruptedGeneration
+
+	// How many of the steps perform is given next were already done by the resumed session.
+	stepsToSkip int
+)
+
+func sessionJournalPath() string {
+	return filepath.Join(activeSettings.LogPath, sessionJournalName)
+}
+
+// Returns nil if there's no journal.
+func readSessionJournal() (*sessionJournal, error) {
+	content, err := os.ReadFile(sessionJournalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	previous := &sessionJournal{}
+	if err := json.Unmarshal(content, previous); err != nil {
+		return nil, fmt.Errorf("%s: %w", sessionJournalPath(), err)
+	}
+	return previous, nil
+}
+
+// Offers to reuse the answers from command's last session if it was interrupted, filling in whatever spec doesn't
+// already answer with them. If it had started putting the engagement together, that's carried on with from the step
+// it stopped at. Either way, this session's answers are journaled from here on. Returns false if the user interrupted.
+func offerResume(rl *readline.Instance, spec *engagementSpec, command string) bool {
+	if dryRun {
+		return true
+	}
+
+	previous, err := readSessionJournal()
+	if err != nil {
+		logger.Warn("the session journal couldn't be read", "path", sessionJournalPath(), "error", err)
+	}
+	if previous == nil || previous.Command != command || !readline.DefaultIsTerminal() {
+		journal = &sessionJournal{Command: command, StartedAt: time.Now().UTC()}
+		return true
+	}
+
+	fmt.Print("\n\nThe last ", command, " session, from ", previous.UpdatedAt.Local().Format("2006-01-02 15:04"), ", didn't finish")
+	if previous.Answers.Organization != "" {
+		fmt.Print(". It was for ", previous.Answers.Organization)
+		if previous.Answers.Contact != "" {
+			fmt.Print("/", previous.Answers.Contact)
+		}
+		if len(previous.Answers.Clusters) > 0 {
+			fmt.Print(" with ", len(previous.Answers.Clusters), " cluster(s)")
+		}
+	}
+	fmt.Print(". Its answers were saved.")
+
+	_, statErr := os.Stat(previous.TmpEngagementPath)
+	partial := previous.TmpEngagementPath != "" && statErr == nil
+	if partial {
+		fmt.Print(" It had done ", previous.StepsDone, " of the steps putting the engagement together in ", previous.TmpEngagementPath, ".")
+	}
+
+	var resume bool
+	if !promptUntilValid(rl, "\nWould you like to pick up where it stopped? (y/n) Entering nothing will start over with none of its answers.\n", func(input string) (err error) {
+		resume, err = parseYesNo(input)
+		return err
+	}) {
+		return false
+	}
+
+	if !resume {
+		logger.Info("session not resumed", "command", command, "startedAt", previous.StartedAt)
+		if partial {
+			fmt.Print("\nWhat it had put together has been left in ", previous.TmpEngagementPath, ". It'll be deleted if this session makes an engagement for the same contact.")
+		}
+		journal = &sessionJournal{Command: command, StartedAt: time.Now().UTC()}
+		saveJournal()
+		return true
+	}
+
+	logger.Info("session resumed", "command", command, "org", previous.Answers.Organization, "contact", previous.Answers.Contact, "clusters", len(previous.Answers.Clusters), "stepsDone", previous.StepsDone, "startedAt", previous.StartedAt)
+	if partial {
+		answers, err := json.Marshal(previous.Answers)
+		if err == nil {
+			resumedGeneration = &interruptedGeneration{tmpPath: previous.TmpEngagementPath, stepsDone: previous.StepsDone, release: previous.Release, answers: answers}
+		}
+	}
+	spec.fillFrom(previous.Answers)
+	previous.TmpEngagementPath, previous.StepsDone, previous.Release = "", 0, ""
+	journal = previous
+	return true
+}
+
+// Gets tmpPath ready for generating into. If the resumed session had started putting the same engagement together
+// there, for the same release and with the same answers, the steps it did are skipped. Anything else there is left
+// from an earlier session, and is deleted so the engagement's made from the start.
+func resumeGeneration(tmpPath string) {
+	previous := resumedGeneration
+	resumedGeneration, stepsToSkip = nil, 0
+	if _, err := os.Stat(tmpPath); err != nil {
+		return
+	}
+
+	if previous != nil && previous.tmpPath == tmpPath {
+		answers, err := json.Marshal(journal.Answers)
+		if err == nil && previous.release == releaseNumber && bytes.Equal(answers, previous.answers) {
+			stepsToSkip = previous.stepsDone
+			fmt.Print("\nCarrying on from step ", stepsToSkip+1, " of putting the engagement together in ", tmpPath, ".")
+			logger.Info("carrying on with the interrupted engagement", "path", tmpPath, "stepsDone", stepsToSkip)
+			return
+		}
+		fmt.Print("\nThe answers or release have changed since ", tmpPath, " was started, so it'll be made again from the start.")
+	}
+
+	fmt.Print("\nDeleting ", tmpPath, ", which an earlier session didn't finish.")
+	logger.Info("deleting an unfinished engagement", "path", tmpPath)
+	if err := deleteFileOrFolder(tmpPath); err != nil {
+		fail(failureGeneration, "\nError deleting ", tmpPath, ": ", err)
+	}
+}
+
+// Whether step was already done by the session being resumed, in which case it's counted as done again.
+func skipDoneStep(step planStep) bool {
+	if stepsToSkip == 0 {
+		return false
+	}
+	stepsToSkip--
+	logger.Debug("already done", append(step.logAttrs(), "action", step.Action)...)
+	journalStepDone(step)
+	return true
+}
+
+// Fills in anything spec doesn't answer from saved. Clusters are only used if spec doesn't have any.
+func (spec *engagementSpec) fillFrom(saved engagementSpec) {
+	if spec.Organization == "" {
+		spec.Organization = saved.Organization
+	}
+	if spec.Abbreviation == nil {
+		spec.Abbreviation = saved.Abbreviation
+	}
+	if spec.Contact == "" {
+		spec.Contact = saved.Contact
+	}
+	if spec.CaseNumber == nil {
+		spec.CaseNumber = saved.CaseNumber
+	}
+	if len(spec.Clusters) == 0 {
+		spec.Clusters = saved.Clusters
+	}
+}
+
+// Records an answer in the journal, if there is one, and saves it.
+func journalAnswers(update func(answers *engagementSpec)) {
+	if journal == nil {
+		return
+	}
+	update(&journal.Answers)
+	saveJournal()
+}
+
+// Records that the engagement is being put together in tmpPath.
+func journalGenerating(tmpPath string) {
+	if journal == nil {
+		return
+	}
+	journal.TmpEngagementPath, journal.StepsDone, journal.Release = tmpPath, 0, releaseNumber
+	saveJournal()
+}
+
+// Counts a step towards the engagement in the journal. Once it's been moved out of its temporary folder, there's
+// nothing left there to carry on with.
+func journalStepDone(step planStep) {
+	if journal == nil || journal.TmpEngagementPath == "" {
+		return
+	}
+	journal.StepsDone++
+	if step.Action == "move" && step.Source == journal.TmpEngagementPath {
+		journal.TmpEngagementPath, journal.StepsDone, journal.Release = "", 0, ""
+	}
+	saveJournal()
+}
+
+// Writes the journal out. It's written to a temporary file first so that dying halfway through doesn't lose the last
+// one. Not being able to save it is only logged, since the run itself is fine.
+func saveJournal() {
+	journal.UpdatedAt = time.Now().UTC()
+	content, err := json.MarshalIndent(journal, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(activeSettings.LogPath, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(sessionJournalPath()+".tmp", append(content, '\n'), 0600)
+	}
+	if err == nil {
+		err = os.Rename(sessionJournalPath()+".tmp", sessionJournalPath())
+	}
+	if err != nil {
+		logger.Warn("the session journal couldn't be saved", "path", sessionJournalPath(), "error", err)
+	}
+}
+
+// Deletes the journal once the session is done with.
+func clearJournal() {
+	if journal == nil {
+		return
+	}
+	journal = nil
+	if err := os.Remove(sessionJournalPath()); err != nil && !os.IsNotExist(err) {
+		logger.Warn("the session journal couldn't be deleted", "path", sessionJournalPath(), "error", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Points the journal at a temporary logPath and puts the session's globals back afterwards.
+func useTempJournal(t *testing.T) {
+	t.Helper()
+	savedSettings, savedJournal, savedRelease := activeSettings, journal, releaseNumber
+	t.Cleanup(func() {
+		activeSettings, journal, releaseNumber = savedSettings, savedJournal, savedRelease
+		resumedGeneration, stepsToSkip = nil, 0
+	})
+	activeSettings.LogPath = filepath.Join(t.TempDir(), "logs")
+	journal, resumedGeneration, stepsToSkip = nil, nil, 0
+}
+
+func TestFillFrom(t *testing.T) {
+	saved := engagementSpec{
+		Organization: "Acme-Labs",
+		Abbreviation: specPointer("AL"),
+		Contact:      "jane-doe",
+		CaseNumber:   specPointer(1234567),
+		Clusters:     []clusterSpec{{Name: "Hopper"}, {Name: "Turing"}, {Name: "Lovelace"}},
+	}
+
+	tests := []struct {
+		name string
+		spec engagementSpec
+		want engagementSpec
+	}{
+		{"empty spec", engagementSpec{}, saved},
+		{
+			"spec wins",
+			engagementSpec{Organization: "Globex", Abbreviation: specPointer(""), Contact: "john-doe", CaseNumber: specPointer(0), Clusters: []clusterSpec{{Name: "Babbage"}}},
+			engagementSpec{Organization: "Globex", Abbreviation: specPointer(""), Contact: "john-doe", CaseNumber: specPointer(0), Clusters: []clusterSpec{{Name: "Babbage"}}},
+		},
+		{
+			"some answers given",
+			engagementSpec{Contact: "john-doe"},
+			engagementSpec{Organization: "Acme-Labs", Abbreviation: specPointer("AL"), Contact: "john-doe", CaseNumber: specPointer(1234567), Clusters: saved.Clusters},
+		},
+		{
+			// The clusters are taken whole or not at all, so they're never a mix of the two.
+			"clusters given",
+			engagementSpec{Clusters: []clusterSpec{{Name: "Babbage"}}},
+			engagementSpec{Organization: "Acme-Labs", Abbreviation: specPointer("AL"), Contact: "jane-doe", CaseNumber: specPointer(1234567), Clusters: []clusterSpec{{Name: "Babbage"}}},
+		},
+	}
+	for _, test := range tests {
+		spec := test.spec
+		spec.fillFrom(saved)
+		if !reflect.DeepEqual(spec, test.want) {
+			t.Errorf("%s: fillFrom gave %+v, want %+v", test.name, spec, test.want)
+		}
+	}
+}
+
+func specPointer[T any](value T) *T {
+	return &value
+}
+
+func TestSessionJournalRoundTrip(t *testing.T) {
+	useTempJournal(t)
+	if previous, err := readSessionJournal(); previous != nil || err != nil {
+		t.Fatalf("readSessionJournal with no journal = %+v, %v", previous, err)
+	}
+
+	started := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	journal = &sessionJournal{Command: "create", StartedAt: started}
+	journalAnswers(func(answers *engagementSpec) { answers.Organization = "Acme-Labs" })
+	journalAnswers(func(answers *engagementSpec) { answers.CaseNumber = specPointer(0) })
+	journalAnswers(func(answers *engagementSpec) {
+		answers.Clusters = []clusterSpec{{Name: "Hopper", Scheduler: "slurm", CustomMPI: specPointer(false), Workers: 64, Hostname: "hopper.example.edu"}}
+	})
+	releaseNumber = "R2024a"
+	journalGenerating("/tmp/jane-doe")
+	journalStepDone(planStep{Action: "copy file"})
+	journalStepDone(planStep{Action: "delete"})
+
+	previous, err := readSessionJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(previous, journal) {
+		t.Errorf("readSessionJournal = %+v, want %+v", previous, journal)
+	}
+	if previous.StepsDone != 2 || previous.Release != "R2024a" || previous.Answers.CaseNumber == nil || !previous.StartedAt.Equal(started) {
+		t.Errorf("readSessionJournal = %+v", previous)
+	}
+
+	info, err := os.Stat(sessionJournalPath())
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the journal's permissions are %v, %v", info.Mode().Perm(), err)
+	}
+	if _, err := os.Stat(sessionJournalPath() + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the journal's temporary file was left behind: %v", err)
+	}
+
+	// Once it's moved into gitRepoPath, there's nothing to carry on with.
+	journalStepDone(planStep{Action: "move", Source: "/tmp/jane-doe", Destination: "/repo/jane-doe"})
+	if previous, _ := readSessionJournal(); previous.TmpEngagementPath != "" || previous.StepsDone != 0 {
+		t.Errorf("after the move, the journal has %q and %d steps", previous.TmpEngagementPath, previous.StepsDone)
+	}
+
+	clearJournal()
+	if previous, err := readSessionJournal(); previous != nil || err != nil {
+		t.Errorf("readSessionJournal after clearJournal = %+v, %v", previous, err)
+	}
+
+	os.WriteFile(sessionJournalPath(), []byte("{"), 0600)
+	if _, err := readSessionJournal(); err == nil {
+		t.Error("readSessionJournal accepted a broken journal")
+	}
+}
+
+func TestResumeGeneration(t *testing.T) {
+	answers := engagementSpec{Organization: "Acme-Labs", Contact: "jane-doe", Clusters: []clusterSpec{{Name: "Hopper", Scheduler: "slurm"}}}
+	savedAnswers, _ := json.Marshal(answers)
+
+	tests := []struct {
+		name      string
+		release   string
+		answers   engagementSpec
+		wantRun   []string
+		wantFiles bool
+	}{
+		{"same answers", "R2024a", answers, []string{"c", "d"}, true},
+		{"another release", "R2024b", answers, []string{"a", "b", "c", "d"}, false},
+		{"other answers", "R2024a", engagementSpec{Organization: "Acme-Labs", Contact: "jane-doe"}, []string{"a", "b", "c", "d"}, false},
+	}
+	for _, test := range tests {
+		useTempJournal(t)
+		tmpPath := filepath.Join(t.TempDir(), "jane-doe")
+		os.MkdirAll(tmpPath, 0755)
+		os.WriteFile(filepath.Join(tmpPath, "a"), nil, 0644)
+
+		releaseNumber = test.release
+		journal = &sessionJournal{Command: "create", Answers: test.answers}
+		resumedGeneration = &interruptedGeneration{tmpPath: tmpPath, stepsDone: 2, release: "R2024a", answers: savedAnswers}
+		var run []string
+		captureStdout(t, func() {
+			resumeGeneration(tmpPath)
+			journalGenerating(tmpPath)
+			for _, name := range []string{"a", "b", "c", "d"} {
+				perform(planStep{Action: "delete", Path: name, run: func() error {
+					run = append(run, name)
+					return nil
+				}})
+			}
+		})
+
+		if !reflect.DeepEqual(run, test.wantRun) {
+			t.Errorf("%s: the steps run were %v, want %v", test.name, run, test.wantRun)
+		}
+		if _, err := os.Stat(filepath.Join(tmpPath, "a")); (err == nil) != test.wantFiles {
+			t.Errorf("%s: what was put together before is there: %v, want %v", test.name, err == nil, test.wantFiles)
+		}
+		if journal.StepsDone != 4 || resumedGeneration != nil || stepsToSkip != 0 {
+			t.Errorf("%s: afterwards, the journal has %d steps done and %d are still to skip", test.name, journal.StepsDone, stepsToSkip)
+		}
+	}
+}
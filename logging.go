@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// The log file is kept in logPath and rotated once it reaches maxLogSize, keeping logFilesKept old ones as
+// integration-scripts-profiler.log.1, .2 and so on.
+const logFileName = "integration-scripts-profiler.log"
+
+// Only changed by tests.
+var (
+	maxLogSize   int64 = 5 << 20
+	logFilesKept       = 3
+)
+
+// Everything worth knowing about a run after the fact goes here, with fields like org, cluster, scheduler and path.
+// What you see on the console is still printed separately. Until startLogging, nothing is kept.
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// Where the log lives when logPath isn't set, which is your user state directory.
+func defaultLogPath() string {
+	var stateDir string
+	switch runtime.GOOS {
+	case "windows":
+		stateDir = os.Getenv("LocalAppData")
+	case "darwin":
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			stateDir = filepath.Join(homeDir, "Library", "Logs")
+		}
+	default:
+		stateDir = os.Getenv("XDG_STATE_HOME")
+		if stateDir == "" {
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				stateDir = filepath.Join(homeDir, ".local", "state")
+			}
+		}
+	}
+	if stateDir == "" {
+		return filepath.Join(os.TempDir(), "integration-scripts-profiler-logs")
+	}
+	return filepath.Join(stateDir, "integration-scripts-profiler")
+}
+
+// Starts logging to the log file, at every level. With verbose, the log is printed to stderr as well. A log file that
+// can't be opened is only a warning; the run carries on without one.
+func startLogging(logPath string, verbose bool, command string) {
+	var handlers []slog.Handler
+
+	logFile, err := openRotatingFile(filepath.Join(logPath, logFileName))
+	if err != nil {
+		redText := color.New(color.FgRed).SprintFunc()
+		fmt.Print(redText("\nThe log file couldn't be opened, so this run won't be logged: ", err))
+	} else {
+		handlers = append(handlers, slog.NewJSONHandler(logFile, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if verbose {
+		handlers = append(handlers, slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if len(handlers) == 0 {
+		return
+	}
+
+	logger = slog.New(teeHandler(handlers))
+	logger.Info("run started", "command", command, "args", redactSecrets(strings.Join(os.Args[1:], " ")), "os", runtime.GOOS, "pid", os.Getpid())
+}
+
+// Sends each record to every handler that wants it.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range t {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, handler := range t {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, handler := range t {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, handler := range t {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// A log file that moves itself aside once it's too big.
+type rotatingFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > maxLogSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Shifts each old log up by one, dropping the oldest, and starts a new one.
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", r.path, logFilesKept))
+	for i := logFilesKept - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	// If it can't be moved, such as while another run has it open on Windows, it just keeps growing.
+	os.Rename(r.path, r.path+".1")
+	return r.open()
+}
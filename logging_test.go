@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	previousSize, previousKept := maxLogSize, logFilesKept
+	t.Cleanup(func() { maxLogSize, logFilesKept = previousSize, previousKept })
+	maxLogSize, logFilesKept = 10, 2
+
+	tests := []struct {
+		name     string
+		existing map[string]string // The logs there before it's opened, by suffix, with "" for the log itself.
+		writes   []string
+		want     map[string]string
+	}{
+		{"under the limit", nil, []string{"abc", "def"}, map[string]string{"": "abcdef"}},
+		{"exactly full", nil, []string{"12345", "67890"}, map[string]string{"": "1234567890"}},
+		{"rotated once full", nil, []string{"12345678", "abc"}, map[string]string{"": "abc", ".1": "12345678"}},
+		{
+			// A single record bigger than the limit is still written whole, and then moved aside by the next.
+			"too big to fit",
+			nil,
+			[]string{"0123456789abcdef", "x"},
+			map[string]string{"": "x", ".1": "0123456789abcdef"},
+		},
+		{
+			"oldest dropped",
+			nil,
+			[]string{"aaaaaaaaa", "bbbbbbbbb", "ccccccccc", "ddddddddd"},
+			map[string]string{"": "ddddddddd", ".1": "ccccccccc", ".2": "bbbbbbbbb"},
+		},
+		{
+			// What was there from the last run counts towards the limit.
+			"appends to the last run's",
+			map[string]string{"": "123456789", ".1": "older", ".2": "oldest"},
+			[]string{"a", "b"},
+			map[string]string{"": "b", ".1": "123456789a", ".2": "older"},
+		},
+	}
+	for _, test := range tests {
+		logPath := filepath.Join(t.TempDir(), "logs", logFileName)
+		os.MkdirAll(filepath.Dir(logPath), 0755)
+		for suffix, content := range test.existing {
+			os.WriteFile(logPath+suffix, []byte(content), 0644)
+		}
+
+		logFile, err := openRotatingFile(logPath)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, write := range test.writes {
+			if n, err := logFile.Write([]byte(write)); n != len(write) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", test.name, write, n, err)
+			}
+		}
+		logFile.file.Close()
+
+		got := map[string]string{}
+		matches, _ := filepath.Glob(logPath + "*")
+		for _, match := range matches {
+			content, _ := os.ReadFile(match)
+			got[match[len(logPath):]] = string(content)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: the logs are %q, want %q", test.name, got, test.want)
+		}
+	}
+}
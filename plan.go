@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// One change a run makes, to disk, Git or GitLab. Everything that changes something goes through perform, so that
+// -dry-run can list it instead.
+type planStep struct {
+	Cluster     string `json:"cluster,omitempty"`
+	Action      string `json:"action"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Find        string `json:"find,omitempty"`
+	Replace     string `json:"replace,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+
+	run     func() error
+	failure string
+}
+
+type generationPlan struct {
+	Organization string     `json:"organization"`
+	Contact      string     `json:"contact"`
+	Release      string     `json:"release"`
+	Steps        []planStep `json:"steps"`
+}
+
+var (
+	// Set by -dry-run and -plan-json.
+	dryRun       bool
+	planJSONPath string
+
+	plannedSteps []planStep
+
+	// Where the engagement is put together before it's moved into gitRepoPath. A failure before then deletes it.
+	tmpEngagementPath string
+)
+
+// Runs step, or just records it for a dry run. A failed step is fatal.
+func perform(step planStep) {
+	if dryRun {
+		plannedSteps = append(plannedSteps, step)
+		return
+	}
+	if skipDoneStep(step) {
+		return
+	}
+	logger.Debug(step.Action, step.logAttrs()...)
+
+	// Files are recorded from where they're put together, since they're somewhere else once moved.
+	if step.Action == "move" {
+		if err := reportFilesIn(step.Source, step.Destination); err != nil {
+			reportFailure(failureGeneration, "Error recording the files in ", step.Source, ": ", err)
+		}
+	}
+
+	if err := step.run(); err != nil {
+		redText := color.New(color.FgRed).SprintFunc()
+		fmt.Print(redText("\n", step.failure, ": ", redactError(err)))
+		logger.Error(step.failure, append(step.logAttrs(), "action", step.Action, "error", redactError(err))...)
+		reportFailure(failureCategory(step.Action), step.failure, ": ", redactError(err))
+		if _, statErr := os.Stat(tmpEngagementPath); tmpEngagementPath != "" && statErr == nil {
+			cleanUpTempFiles(tmpEngagementPath)
+		}
+		exitRun(1)
+	}
+
+	if step.Action == "write" {
+		if err := reportFile(step.Path); err != nil {
+			reportFailure(failureGeneration, "Error recording ", step.Path, ": ", err)
+		}
+	}
+	journalStepDone(step)
+}
+
+// The step's fields that are set, for the log.
+func (step planStep) logAttrs() []any {
+	var attrs []any
+	for _, field := range []struct{ key, value string }{
+		{"cluster", step.Cluster},
+		{"source", step.Source},
+		{"destination", step.Destination},
+		{"path", step.Path},
+		{"find", step.Find},
+		{"replace", step.Replace},
+		{"detail", step.Detail},
+	} {
+		if field.value != "" {
+			attrs = append(attrs, field.key, field.value)
+		}
+	}
+	return attrs
+}
+
+// What a failed step counts as in the run report.
+func failureCategory(action string) string {
+	switch action {
+	case "git init", "git clone", "git fetch", "git push":
+		return failureGit
+	case "gitlab create":
+		return failureGitLab
+	default:
+		return failureGeneration
+	}
+}
+
+// Ends a run, printing the plan if it was a dry run.
+func finishRun() {
+	if !dryRun {
+		clearJournal()
+		fmt.Print("\nFinished!")
+		return
+	}
+
+	plan := generationPlan{Organization: organizationSelected, Contact: organizationContact, Release: releaseNumber, Steps: plannedSteps}
+	if planJSONPath == "-" {
+		fmt.Print("\n")
+		if err := writePlanJSON(os.Stdout, plan); err != nil {
+			fail(failureGeneration, "\nError writing the plan: ", err)
+		}
+		return
+	}
+	if planJSONPath != "" {
+		file, err := os.Create(planJSONPath)
+		if err == nil {
+			err = writePlanJSON(file, plan)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fail(failureGeneration, "\nError writing the plan: ", err)
+		}
+		fmt.Print("\nThe plan has been written to ", planJSONPath)
+	}
+	printPlan(os.Stdout, plan)
+}
+
+func writePlanJSON(w io.Writer, plan generationPlan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+func printPlan(w io.Writer, plan generationPlan) {
+	fmt.Fprint(w, "\n\nDry run: nothing has been changed. This is what would be done for ", plan.Organization)
+	if plan.Contact != "" {
+		fmt.Fprint(w, "/", plan.Contact)
+	}
+	if plan.Release != "" {
+		fmt.Fprint(w, " (", plan.Release, ")")
+	}
+	fmt.Fprint(w, ":\n")
+
+	if len(plan.Steps) == 0 {
+		fmt.Fprint(w, "\nNothing.\n")
+		return
+	}
+
+	cluster := "-"
+	for _, step := range plan.Steps {
+		if step.Cluster != cluster {
+			cluster = step.Cluster
+			if cluster == "" {
+				fmt.Fprint(w, "\nEngagement\n")
+			} else {
+				fmt.Fprint(w, "\nCluster ", cluster, "\n")
+			}
+		}
+
+		fmt.Fprintf(w, "  %-14s ", step.Action)
+		switch {
+		case step.Find != "":
+			fmt.Fprintf(w, "%s: %q -> %q", step.Path, step.Find, step.Replace)
+		case step.Source != "":
+			fmt.Fprint(w, step.Source, " -> ", step.Destination)
+		case step.Path != "" && step.Detail != "":
+			fmt.Fprint(w, step.Path, ": ", step.Detail)
+		default:
+			fmt.Fprint(w, step.Path, step.Detail)
+		}
+		fmt.Fprint(w, "\n")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testPlan = generationPlan{
+	Organization: "Acme-Labs",
+	Contact:      "Jo-Doe",
+	Release:      "R2024a",
+	Steps: []planStep{
+		{Action: "mkdir", Path: "/tmp/Acme-Labs"},
+		{Cluster: "Hopper", Action: "copy", Source: "Gold/R2024a/slurm", Destination: "/tmp/Acme-Labs/Hopper"},
+		{Cluster: "Hopper", Action: "edit", Path: "Hopper.conf", Find: "ClusterHost=", Replace: "ClusterHost=hopper.example.edu"},
+	},
+}
+
+func TestPrintPlan(t *testing.T) {
+	var output bytes.Buffer
+	printPlan(&output, testPlan)
+
+	want := `
+
+Dry run: nothing has been changed. This is what would be done for Acme-Labs/Jo-Doe (R2024a):
+
+Engagement
+  mkdir          /tmp/Acme-Labs
+
+Cluster Hopper
+  copy           Gold/R2024a/slurm -> /tmp/Acme-Labs/Hopper
+  edit           Hopper.conf: "ClusterHost=" -> "ClusterHost=hopper.example.edu"
+`
+	if output.String() != want {
+		t.Errorf("printPlan printed:\n%s\nwant:\n%s", output.String(), want)
+	}
+
+	output.Reset()
+	printPlan(&output, generationPlan{Organization: "Acme-Labs"})
+	if !strings.HasSuffix(output.String(), "Acme-Labs:\n\nNothing.\n") {
+		t.Errorf("printPlan printed %q for an empty plan", output.String())
+	}
+}
+
+func TestWritePlanJSON(t *testing.T) {
+	var output bytes.Buffer
+	if err := writePlanJSON(&output, testPlan); err != nil {
+		t.Fatal(err)
+	}
+
+	var plan generationPlan
+	if err := json.Unmarshal(output.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan, testPlan) {
+		t.Errorf("the plan read back is %+v, want %+v", plan, testPlan)
+	}
+	if strings.Count(output.String(), `"find"`) != 1 {
+		t.Error("steps without a substitution have one")
+	}
+}
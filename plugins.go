@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exactly which upstream scripts went into an engagement.
+type pluginLock struct {
+	Scheduler string `json:"scheduler"`
+	Source    string `json:"source"`
+	Ref       string `json:"ref,omitempty"`
+	Revision  string `json:"revision,omitempty"` // The commit the archive was made from, when known.
+	SHA256    string `json:"sha256,omitempty"`   // Of the archive, when one was downloaded.
+}
+
+// The lockfile written to each engagement's contact folder.
+type pluginLockfile struct {
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Release   string       `json:"release"`
+	Plugins   []pluginLock `json:"plugins"`
+}
+
+const pluginLockfileName = "plugins.lock.json"
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// What we know about each plugin in scriptsPath, keyed by scheduler name. Filled in as plugins are acquired.
+var acquiredPlugins = map[string]pluginLock{}
+
+// Set by -offline. Nothing is downloaded; plugins have to already be in the cache, usually from "bundle import".
+var offline bool
+
+// Gets a scheduler's plugin archive into the cache and extracts it to the scheduler's archive folder in scriptsPath.
+// Returns whether the cached archive was used.
+func acquirePlugin(ctx context.Context, scheduler schedulerEntry, scriptsPath, cachePath string, progress progressFunc) (pluginLock, bool, error) {
+	lock := pluginLock{Scheduler: scheduler.Name, Source: scheduler.source(), Ref: scheduler.Ref}
+
+	cached, fromCache, err := cachePlugin(ctx, scheduler, cachePath, progress)
+	if err != nil {
+		return lock, false, err
+	}
+	zipArchivePath := cachedArchivePath(cachePath, scheduler.Name)
+	lock.Source = cached.URL // Offline, this is wherever the bundle's copy came from.
+	lock.Ref = cached.Ref
+	lock.SHA256 = cached.SHA256
+
+	lock.Revision, err = archiveRevision(zipArchivePath, lock.Ref)
+	if err != nil {
+		return lock, fromCache, err
+	}
+
+	// Don't extract the same archive over itself.
+	archiveFolderPath := filepath.Join(scriptsPath, scheduler.ArchiveFolder)
+	extractedMarkerPath := filepath.Join(scriptsPath, "."+scheduler.Name+".extracted")
+	if extracted, err := os.ReadFile(extractedMarkerPath); err == nil && string(extracted) == lock.SHA256 {
+		if _, err := os.Stat(archiveFolderPath); err == nil {
+			return lock, fromCache, nil
+		}
+	}
+
+	if err := extractPlugin(zipArchivePath, scriptsPath, scheduler.ArchiveFolder); err != nil {
+		return lock, fromCache, fmt.Errorf("failed to extract integration scripts: %w", err)
+	}
+
+	if err := os.WriteFile(extractedMarkerPath, []byte(lock.SHA256), 0644); err != nil {
+		return lock, fromCache, err
+	}
+	return lock, fromCache, nil
+}
+
+// Makes sure the cache has a current archive for the scheduler. A cached archive is revalidated with the server, or
+// reused outright if it's pinned to a commit or we're offline. Returns whether the cached archive was used.
+func cachePlugin(ctx context.Context, scheduler schedulerEntry, cachePath string, progress progressFunc) (cacheEntry, bool, error) {
+	source := scheduler.source()
+
+	cached, isCached := readCacheEntry(cachePath, scheduler.Name)
+	if offline {
+		if !isCached {
+			return cached, false, fmt.Errorf("%s isn't in the plugin cache; import a bundle that has it with \"bundle import\"", scheduler.Name)
+		}
+		return cached, true, nil
+	}
+	if isCached && (cached.URL != source || cached.Ref != scheduler.Ref) {
+		isCached = false // The catalogue's changed since, so what's cached is for something else.
+	}
+
+	// A commit can't change, so there's nothing to ask the server.
+	if isCached && commitSHAPattern.MatchString(scheduler.Ref) {
+		return cached, true, nil
+	}
+
+	if err := os.MkdirAll(pluginCacheFolder(cachePath), 0755); err != nil {
+		return cached, false, fmt.Errorf("failed to create the plugin cache: %w", err)
+	}
+	zipArchivePath := cachedArchivePath(cachePath, scheduler.Name)
+
+	var validators downloadValidators
+	if isCached {
+		validators = downloadValidators{ETag: cached.ETag, LastModified: cached.LastModified}
+	}
+
+	fromCache := false
+	var newValidators downloadValidators
+	var err error
+	if scheduler.cloneURL() != "" {
+		newValidators, err = clonePlugin(ctx, scheduler, zipArchivePath, validators)
+	} else {
+		newValidators, err = downloadFile(ctx, source, zipArchivePath, validators, progress)
+	}
+	switch {
+	case err == errNotModified:
+		fromCache = true
+		cached.CheckedAt = time.Now().UTC()
+	case err != nil:
+		return cached, false, fmt.Errorf("failed to get the integration scripts: %w", err)
+	default:
+		archiveSHA256, err := fileSHA256(zipArchivePath)
+		if err != nil {
+			return cached, false, err
+		}
+		info, err := os.Stat(zipArchivePath)
+		if err != nil {
+			return cached, false, err
+		}
+		cached = cacheEntry{
+			Scheduler:    scheduler.Name,
+			URL:          source,
+			Ref:          scheduler.Ref,
+			ETag:         newValidators.ETag,
+			LastModified: newValidators.LastModified,
+			SHA256:       archiveSHA256,
+			Size:         info.Size(),
+			DownloadedAt: time.Now().UTC(),
+			CheckedAt:    time.Now().UTC(),
+		}
+	}
+
+	if err := writeCacheEntry(cachePath, cached); err != nil {
+		return cached, fromCache, fmt.Errorf("failed to update the plugin cache: %w", err)
+	}
+	return cached, fromCache, nil
+}
+
+// Moves plugin folders for extractPlugin. Tests replace it to make the swap fail.
+var renameFolder = os.Rename
+
+// Extracts a plugin archive into a staging folder, then swaps it in for scriptsPath/archiveFolder. Until the swap,
+// whatever was there before is untouched, and afterwards none of its files are left behind.
+func extractPlugin(zipArchivePath, scriptsPath, archiveFolder string) error {
+	stagingPath, err := os.MkdirTemp(scriptsPath, "."+archiveFolder+".staging-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingPath)
+
+	if err := unzipFile(zipArchivePath, stagingPath); err != nil {
+		return err
+	}
+
+	// Everything should be inside one folder, such as matlab-parallel-slurm-plugin-main. A pinned ref's might be
+	// named something like matlab-parallel-slurm-plugin-2.1.0, which is why it's renamed to archiveFolder.
+	stagedEntries, err := os.ReadDir(stagingPath)
+	if err != nil {
+		return err
+	}
+	if len(stagedEntries) != 1 || !stagedEntries[0].IsDir() {
+		return fmt.Errorf("%s should have everything inside one top-level folder", filepath.Base(zipArchivePath))
+	}
+	stagedFolderPath := filepath.Join(stagingPath, stagedEntries[0].Name())
+
+	// Move the old folder aside rather than deleting it first, so it can be put back if the swap fails.
+	archiveFolderPath := filepath.Join(scriptsPath, archiveFolder)
+	oldPath, err := os.MkdirTemp(scriptsPath, "."+archiveFolder+".old-")
+	if err != nil {
+		return err
+	}
+	keepOld := false
+	defer func() {
+		if !keepOld {
+			os.RemoveAll(oldPath)
+		}
+	}()
+	oldFolderPath := filepath.Join(oldPath, archiveFolder)
+	movedAside := false
+	if _, err := os.Stat(archiveFolderPath); err == nil {
+		if err := renameFolder(archiveFolderPath, oldFolderPath); err != nil {
+			return fmt.Errorf("failed to move the existing integration scripts aside: %w", err)
+		}
+		movedAside = true
+	}
+
+	if err := renameFolder(stagedFolderPath, archiveFolderPath); err != nil {
+		if !movedAside {
+			return err
+		}
+		if restoreErr := renameFolder(oldFolderPath, archiveFolderPath); restoreErr != nil {
+			keepOld = true // They're all that's left, so they stay where they are.
+			return fmt.Errorf("%w, and the existing integration scripts couldn't be put back, so they're in %s: %v", err, oldFolderPath, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Records plugins that weren't downloaded this run, so the lockfile at least says where they came from.
+func localPluginLock(scheduler schedulerEntry, scriptsPath string) pluginLock {
+	if lock, ok := acquiredPlugins[scheduler.Name]; ok {
+		return lock
+	}
+	return pluginLock{Scheduler: scheduler.Name, Source: filepath.Join(scriptsPath, scheduler.ArchiveFolder)}
+}
+
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Works out which commit an archive was made from. A ref that's already a commit SHA is used as-is. Otherwise we rely
+// on git archive (which GitHub and GitLab use) storing the commit ID as the zip's comment.
+func archiveRevision(zipArchivePath, ref string) (string, error) {
+	if commitSHAPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	reader, err := zip.OpenReader(zipArchivePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	comment := strings.TrimSpace(reader.Comment)
+	if commitSHAPattern.MatchString(comment) {
+		return comment, nil
+	}
+	return "", nil
+}
+
+// Writes or updates the lockfile in folderPath. Plugins already recorded for other schedulers are kept, so adding a
+// cluster later doesn't lose what earlier ones were built from.
+func writePluginLockfile(folderPath, release string, locks []pluginLock) error {
+	lockfilePath := filepath.Join(folderPath, pluginLockfileName)
+
+	lockfile := pluginLockfile{}
+	if content, err := os.ReadFile(lockfilePath); err == nil {
+		if err := json.Unmarshal(content, &lockfile); err != nil {
+			return fmt.Errorf("%s: %w", lockfilePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, lock := range locks {
+		replaced := false
+		for i := range lockfile.Plugins {
+			if lockfile.Plugins[i].Scheduler == lock.Scheduler {
+				lockfile.Plugins[i] = lock
+				replaced = true
+			}
+		}
+		if !replaced {
+			lockfile.Plugins = append(lockfile.Plugins, lock)
+		}
+	}
+	sort.Slice(lockfile.Plugins, func(i, j int) bool { return lockfile.Plugins[i].Scheduler < lockfile.Plugins[j].Scheduler })
+
+	lockfile.UpdatedAt = time.Now().UTC()
+	lockfile.Release = release
+
+	content, err := json.MarshalIndent(lockfile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(lockfilePath, append(content, '\n'), 0644)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// One entry for writeZip. A name ending in a slash is a folder.
+type zipEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+// Writes a zip of entries to a new temporary folder and returns its path.
+func writeZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		file, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "plugin.zip")
+	if err := os.WriteFile(zipPath, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+// Sets the extraction limits for the rest of the test.
+func setArchiveLimits(t *testing.T, entries int, extractedSize int64) {
+	previousEntries, previousSize := maxArchiveEntries, maxArchiveExtractedSize
+	t.Cleanup(func() { maxArchiveEntries, maxArchiveExtractedSize = previousEntries, previousSize })
+	maxArchiveEntries, maxArchiveExtractedSize = entries, extractedSize
+}
+
+func TestUnzipFile(t *testing.T) {
+	setArchiveLimits(t, 4, 100)
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		error   string
+	}{
+		{"a plugin", []zipEntry{{name: "plugin/"}, {name: "plugin/README.md", content: "hi"}, {name: "plugin/scripts/submit.m", content: "% submit"}}, ""},
+		{"folders made as needed", []zipEntry{{name: "plugin/a/b/c.m", content: "c"}}, ""},
+		{"parent folder", []zipEntry{{name: "../evil.sh", content: "rm -rf ~"}}, "unsafe path: ../evil.sh"},
+		{"parent folder deeper in", []zipEntry{{name: "plugin/../../evil.sh", content: "rm -rf ~"}}, "unsafe path: plugin/../../evil.sh"},
+		{"absolute path", []zipEntry{{name: "/etc/evil", content: "x"}}, "unsafe path: /etc/evil"},
+		{"backslashes", []zipEntry{{name: `..\evil.bat`, content: "x"}}, `unsafe path: ..\evil.bat`},
+		{"symlink", []zipEntry{{name: "plugin/link", content: "/etc/passwd", mode: os.ModeSymlink | 0777}}, "contains a symlink, which isn't allowed: plugin/link"},
+		{"too many entries", []zipEntry{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}, {name: "e"}}, "has 5 entries, more than the 4 allowed"},
+		{"one entry too big", []zipEntry{{name: "big", content: strings.Repeat("x", 101)}}, "extracts to more than"},
+		{"too big together", []zipEntry{{name: "a", content: strings.Repeat("x", 60)}, {name: "b", content: strings.Repeat("x", 60)}}, "extracts to more than"},
+		{"right at the limit", []zipEntry{{name: "a", content: strings.Repeat("x", 50)}, {name: "b", content: strings.Repeat("x", 50)}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "dest")
+			err := unzipFile(writeZip(t, test.entries), dest)
+
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Fatalf("unzipFile = %v, want an error saying %q", err, test.error)
+				}
+				if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "evil.sh")); err == nil {
+					t.Error("a file was written outside the destination")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range test.entries {
+				if strings.HasSuffix(entry.name, "/") {
+					continue
+				}
+				content, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(entry.name)))
+				if err != nil || string(content) != entry.content {
+					t.Errorf("%s = %q, %v; want %q", entry.name, content, err, entry.content)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPlugin(t *testing.T) {
+	setArchiveLimits(t, 10, 1000)
+
+	// A scripts folder with last time's plugin in it.
+	setUp := func(t *testing.T) string {
+		scriptsPath := t.TempDir()
+		oldFiles := map[string]string{"README.md": "old", "scripts/removed.m": "% gone upstream"}
+		for name, content := range oldFiles {
+			path := filepath.Join(scriptsPath, "matlab-parallel-slurm-plugin-main", filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return scriptsPath
+	}
+	readme := func(scriptsPath string) string {
+		content, _ := os.ReadFile(filepath.Join(scriptsPath, "matlab-parallel-slurm-plugin-main", "README.md"))
+		return string(content)
+	}
+	leftovers := func(t *testing.T, scriptsPath string) {
+		entries, _ := os.ReadDir(scriptsPath)
+		for _, entry := range entries {
+			if strings.Contains(entry.Name(), ".staging-") || strings.Contains(entry.Name(), ".old-") {
+				t.Errorf("%s was left behind", entry.Name())
+			}
+		}
+	}
+
+	t.Run("swapped in", func(t *testing.T) {
+		scriptsPath := setUp(t)
+		zipPath := writeZip(t, []zipEntry{{name: "matlab-parallel-slurm-plugin-2.1.0/README.md", content: "new"}, {name: "matlab-parallel-slurm-plugin-2.1.0/scripts/submit.m", content: "% new"}})
+		if err := extractPlugin(zipPath, scriptsPath, "matlab-parallel-slurm-plugin-main"); err != nil {
+			t.Fatal(err)
+		}
+		if got := readme(scriptsPath); got != "new" {
+			t.Errorf("README.md = %q, want the new one", got)
+		}
+		if _, err := os.Stat(filepath.Join(scriptsPath, "matlab-parallel-slurm-plugin-main", "scripts", "removed.m")); err == nil {
+			t.Error("a file from the old plugin was left behind")
+		}
+		leftovers(t, scriptsPath)
+	})
+
+	// The old folder is moved aside next to the staging folder, not into it.
+	t.Run("top folder named previous", func(t *testing.T) {
+		scriptsPath := setUp(t)
+		zipPath := writeZip(t, []zipEntry{{name: "previous/README.md", content: "new"}})
+		if err := extractPlugin(zipPath, scriptsPath, "matlab-parallel-slurm-plugin-main"); err != nil {
+			t.Fatal(err)
+		}
+		if got := readme(scriptsPath); got != "new" {
+			t.Errorf("README.md = %q, want the new one", got)
+		}
+		leftovers(t, scriptsPath)
+	})
+
+	failures := []struct {
+		name    string
+		entries []zipEntry
+		error   string
+	}{
+		{"unsafe path", []zipEntry{{name: "plugin/README.md", content: "new"}, {name: "../evil.sh", content: "x"}}, "unsafe path"},
+		{"symlink", []zipEntry{{name: "plugin/README.md", content: "new"}, {name: "plugin/link", content: "/etc", mode: os.ModeSymlink | 0777}}, "symlink"},
+		{"too big", []zipEntry{{name: "plugin/README.md", content: "new"}, {name: "plugin/big", content: strings.Repeat("x", 1001)}}, "extracts to more than"},
+		{"more than one folder", []zipEntry{{name: "plugin/README.md", content: "new"}, {name: "other/README.md", content: "new"}}, "inside one top-level folder"},
+		{"loose files", []zipEntry{{name: "README.md", content: "new"}}, "inside one top-level folder"},
+	}
+	for _, test := range failures {
+		t.Run(test.name, func(t *testing.T) {
+			scriptsPath := setUp(t)
+			err := extractPlugin(writeZip(t, test.entries), scriptsPath, "matlab-parallel-slurm-plugin-main")
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Fatalf("extractPlugin = %v, want an error saying %q", err, test.error)
+			}
+			if got := readme(scriptsPath); got != "old" {
+				t.Errorf("README.md = %q, want the old one kept", got)
+			}
+			leftovers(t, scriptsPath)
+		})
+	}
+
+	t.Run("not a zip", func(t *testing.T) {
+		scriptsPath := setUp(t)
+		notZip := filepath.Join(t.TempDir(), "plugin.zip")
+		os.WriteFile(notZip, []byte("<html>Sign in</html>"), 0644)
+		if err := extractPlugin(notZip, scriptsPath, "matlab-parallel-slurm-plugin-main"); err == nil {
+			t.Fatal("extractPlugin accepted an HTML page")
+		}
+		if got := readme(scriptsPath); got != "old" {
+			t.Errorf("README.md = %q, want the old one kept", got)
+		}
+		leftovers(t, scriptsPath)
+	})
+
+	// If the new folder can't be moved in, the old one is put back.
+	t.Run("swap fails", func(t *testing.T) {
+		scriptsPath := setUp(t)
+		zipPath := writeZip(t, []zipEntry{{name: "plugin/README.md", content: "new"}})
+		renameFolder = func(from, to string) error {
+			if strings.Contains(from, ".staging-") {
+				return os.ErrPermission
+			}
+			return os.Rename(from, to)
+		}
+		t.Cleanup(func() { renameFolder = os.Rename })
+
+		if err := extractPlugin(zipPath, scriptsPath, "matlab-parallel-slurm-plugin-main"); err == nil {
+			t.Fatal("extractPlugin didn't report the failed swap")
+		}
+		if got := readme(scriptsPath); got != "old" {
+			t.Errorf("README.md = %q, want the old one put back", got)
+		}
+		leftovers(t, scriptsPath)
+	})
+
+	// If it can't be put back either, it's left where it was moved to and the error says where.
+	t.Run("putting it back fails", func(t *testing.T) {
+		scriptsPath := setUp(t)
+		zipPath := writeZip(t, []zipEntry{{name: "plugin/README.md", content: "new"}})
+		renameFolder = func(from, to string) error {
+			if strings.Contains(from, ".staging-") || strings.Contains(from, ".old-") {
+				return os.ErrPermission
+			}
+			return os.Rename(from, to)
+		}
+		t.Cleanup(func() { renameFolder = os.Rename })
+
+		err := extractPlugin(zipPath, scriptsPath, "matlab-parallel-slurm-plugin-main")
+		if err == nil || !strings.Contains(err.Error(), "couldn't be put back") {
+			t.Fatalf("extractPlugin = %v, want it to say the old scripts couldn't be put back", err)
+		}
+		kept, _ := filepath.Glob(filepath.Join(scriptsPath, ".matlab-parallel-slurm-plugin-main.old-*", "matlab-parallel-slurm-plugin-main", "README.md"))
+		if len(kept) != 1 || !strings.Contains(err.Error(), filepath.Dir(kept[0])) {
+			t.Errorf("the old scripts weren't kept where the error says: %v, %v", kept, err)
+		}
+	})
+}
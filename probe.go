@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// How long a cluster gets to answer a probe, connecting included.
+const probeTimeout = 30 * time.Second
+
+// What -probe found on a cluster. It's kept in the engagement record, so it says what was there when the scripts
+// were made.
+type probeResult struct {
+	ProbedAt  time.Time `json:"probedAt" yaml:"probedAt"`
+	Reachable bool      `json:"reachable" yaml:"reachable"`
+	Error     string    `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// Whether bin/matlab is in the MATLAB root, and the release its VersionInfo.xml gives.
+	MatlabFound   *bool  `json:"matlabFound,omitempty" yaml:"matlabFound,omitempty"`
+	MatlabRelease string `json:"matlabRelease,omitempty" yaml:"matlabRelease,omitempty"`
+
+	// The scheduler's commands, from the catalogue, that are and aren't on the PATH.
+	FoundCommands   []string `json:"foundCommands,omitempty" yaml:"foundCommands,omitempty"`
+	MissingCommands []string `json:"missingCommands,omitempty" yaml:"missingCommands,omitempty"`
+}
+
+// SSHes to each cluster with a hostname to check that its MATLAB root and scheduler commands are there, and records
+// what was found in the cluster's answers. Nothing found stops the run, since the cluster may only be reachable from
+// somewhere else.
+func probeClusters(ctx context.Context, clusters []clusterSpec) {
+	if !activeSettings.Probe {
+		return
+	}
+	redText := color.New(color.FgRed).SprintFunc()
+
+	// Offline means not connecting to anything, clusters included.
+	if offline {
+		fmt.Print(redText("\nClusters won't be probed, since you're offline.\n"))
+		logger.Info("probe skipped", "reason", "offline")
+		return
+	}
+
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Hostname == "" {
+			fmt.Print("\n", cluster.Name, " has no hostname, so it won't be probed.")
+			continue
+		}
+
+		fmt.Print("\nProbing ", cluster.Name, " (", cluster.Hostname, ")...")
+		scheduler, _ := findScheduler(cluster.Scheduler)
+		cluster.Probe = probeCluster(ctx, cluster.Hostname, cluster.MatlabRoot, scheduler.Commands)
+		result := cluster.Probe
+
+		if !result.Reachable {
+			fmt.Print(redText("\n  Couldn't probe it: ", result.Error))
+			logger.Warn("cluster couldn't be probed", "cluster", cluster.Name, "hostname", cluster.Hostname, "error", result.Error)
+			continue
+		}
+
+		if result.MatlabFound != nil {
+			if *result.MatlabFound {
+				fmt.Print("\n  MATLAB was found in ", cluster.MatlabRoot)
+				if result.MatlabRelease != "" {
+					fmt.Print(" (", result.MatlabRelease, ")")
+				}
+				fmt.Print(".")
+			} else {
+				fmt.Print(redText("\n  MATLAB wasn't found in ", cluster.MatlabRoot, "."))
+			}
+			if result.MatlabRelease != "" && releaseNumber != "" && !strings.EqualFold(result.MatlabRelease, releaseNumber) {
+				fmt.Print(redText("\n  It's ", result.MatlabRelease, ", but these scripts are for ", releaseNumber, "."))
+			}
+		}
+		if len(result.FoundCommands) > 0 {
+			fmt.Print("\n  Found ", strings.Join(result.FoundCommands, ", "), ".")
+		}
+		if len(result.MissingCommands) > 0 {
+			fmt.Print(redText("\n  ", strings.Join(result.MissingCommands, ", "), " couldn't be found. Is ", scheduler.Label, " on the PATH there?"))
+		}
+		logger.Info("cluster probed", "cluster", cluster.Name, "hostname", cluster.Hostname, "matlabFound", result.MatlabFound, "matlabRelease", result.MatlabRelease,
+			"foundCommands", result.FoundCommands, "missingCommands", result.MissingCommands)
+	}
+	fmt.Print("\n")
+}
+
+// Runs the checks on hostname with sshCommand. BatchMode stops SSH asking for a password or passphrase, so the host
+// needs a key it'll accept.
+func probeCluster(ctx context.Context, hostname, matlabRoot string, commands []string) *probeResult {
+	result := &probeResult{ProbedAt: time.Now().UTC()}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	sshCommand := strings.Fields(activeSettings.SSHCommand)
+	arguments := append(sshCommand[1:], "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", hostname, "sh -s")
+	cmd := exec.CommandContext(ctx, sshCommand[0], arguments...)
+	cmd.Stdin = strings.NewReader(probeScript(matlabRoot, commands))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		result.Error = probeError(ctx, err, stderr.String())
+		return result
+	}
+
+	// The script prints one finding per line, and anything else, such as a login banner, is ignored.
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		kind, value, _ := strings.Cut(scanner.Text(), " ")
+		switch kind {
+		case "probe-done":
+			result.Reachable = true
+		case "matlab-found", "matlab-missing":
+			found := kind == "matlab-found"
+			result.MatlabFound = &found
+		case "matlab-release":
+			result.MatlabRelease = value
+		case "command-found":
+			result.FoundCommands = append(result.FoundCommands, value)
+		case "command-missing":
+			result.MissingCommands = append(result.MissingCommands, value)
+		}
+	}
+	if !result.Reachable {
+		result.Error = "the checks didn't finish"
+	}
+	return result
+}
+
+// The script run on the cluster. It's given to sh on stdin so the login shell, which may well be csh, doesn't matter.
+func probeScript(matlabRoot string, commands []string) string {
+	var script strings.Builder
+
+	// Scheduler commands are often only on the PATH of a login shell.
+	script.WriteString(". /etc/profile >/dev/null 2>&1\n")
+	script.WriteString("[ -f \"$HOME/.profile\" ] && . \"$HOME/.profile\" >/dev/null 2>&1\n")
+
+	if matlabRoot != "" {
+		fmt.Fprintf(&script, "root=%s\n", shellQuote(matlabRoot))
+		script.WriteString("if [ -x \"$root/bin/matlab\" ]; then echo matlab-found; else echo matlab-missing; fi\n")
+		script.WriteString("sed -n 's:.*<release>\\(R[0-9]*[ab]\\)</release>.*:matlab-release \\1:p' \"$root/VersionInfo.xml\" 2>/dev/null\n")
+	}
+	for _, command := range commands {
+		fmt.Fprintf(&script, "if command -v %[1]s >/dev/null 2>&1; then echo command-found %[1]s; else echo command-missing %[1]s; fi\n", shellQuote(command))
+	}
+	script.WriteString("echo probe-done\n")
+	return script.String()
+}
+
+// Single quotes value for sh.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Describes why SSH failed, using the last thing it said, which is usually the reason.
+func probeError(ctx context.Context, err error, stderr string) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("it didn't answer within %s", probeTimeout)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err.Error()
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return err.Error()
+}
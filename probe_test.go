@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Stands in for ssh: it records its arguments, fails like ssh does for hosts under .invalid and otherwise runs the
+// script with a home whose .profile puts a fake sbatch on the PATH.
+const fakeSSH = `#!/bin/sh
+echo "$@" >> "$FAKE_SSH_DIR/arguments"
+while [ $# -gt 2 ]; do shift; done
+case $1 in
+*.invalid)
+	echo "Warning: a banner" >&2
+	echo "ssh: Could not resolve hostname $1: Name or service not known" >&2
+	exit 255 ;;
+esac
+HOME="$FAKE_SSH_DIR/home" exec $2
+`
+
+// Sets up the fake ssh as sshCommand and returns its folder.
+func useFakeSSH(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("FAKE_SSH_DIR", dir)
+	files := map[string]string{
+		"ssh":                                fakeSSH,
+		"bin/sbatch":                         "#!/bin/sh\n",
+		"home/.profile":                      "PATH=\"$FAKE_SSH_DIR/bin:$PATH\"\n",
+		"it's MATLAB/R2024a/bin/matlab":      "#!/bin/sh\n",
+		"it's MATLAB/R2024a/VersionInfo.xml": "<?xml version=\"1.0\"?>\n<MathWorks_version_info>\n  <version>24.1.0</version>\n  <release>R2024a</release>\n</MathWorks_version_info>\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousSettings, previousOffline := activeSettings, offline
+	t.Cleanup(func() { activeSettings, offline = previousSettings, previousOffline })
+	activeSettings.SSHCommand = filepath.Join(dir, "ssh") + " -p 2222"
+	offline = false
+	return dir
+}
+
+func TestProbeCluster(t *testing.T) {
+	dir := useFakeSSH(t)
+	matlabRoot := filepath.Join(dir, "it's MATLAB", "R2024a")
+	found, missing := true, false
+
+	tests := []struct {
+		name            string
+		hostname        string
+		matlabRoot      string
+		reachable       bool
+		error           string
+		matlabFound     *bool
+		matlabRelease   string
+		foundCommands   []string
+		missingCommands []string
+	}{
+		{"everything there", "hopper.example.edu", matlabRoot, true, "", &found, "R2024a", []string{"sbatch"}, []string{"squeue"}},
+		{"no MATLAB", "hopper.example.edu", filepath.Join(dir, "R2023b"), true, "", &missing, "", []string{"sbatch"}, []string{"squeue"}},
+		{"no MATLAB root given", "hopper.example.edu", "", true, "", nil, "", []string{"sbatch"}, []string{"squeue"}},
+		{"unreachable", "hopper.invalid", matlabRoot, false, "ssh: Could not resolve hostname hopper.invalid: Name or service not known", nil, "", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := probeCluster(context.Background(), test.hostname, test.matlabRoot, []string{"sbatch", "squeue"})
+
+			if result.Reachable != test.reachable || result.Error != test.error {
+				t.Errorf("reachable = %v, error = %q; want %v, %q", result.Reachable, result.Error, test.reachable, test.error)
+			}
+			if (result.MatlabFound == nil) != (test.matlabFound == nil) || (result.MatlabFound != nil && *result.MatlabFound != *test.matlabFound) {
+				t.Errorf("matlabFound = %v, want %v", result.MatlabFound, test.matlabFound)
+			}
+			if result.MatlabRelease != test.matlabRelease {
+				t.Errorf("matlabRelease = %q, want %q", result.MatlabRelease, test.matlabRelease)
+			}
+			if !slices.Equal(result.FoundCommands, test.foundCommands) || !slices.Equal(result.MissingCommands, test.missingCommands) {
+				t.Errorf("found %v and missing %v, want %v and %v", result.FoundCommands, result.MissingCommands, test.foundCommands, test.missingCommands)
+			}
+		})
+	}
+
+	// sshCommand's own options come first, then the ones that stop SSH prompting.
+	arguments, err := os.ReadFile(filepath.Join(dir, "arguments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := strings.Split(string(arguments), "\n")[0]; first != "-p 2222 -o BatchMode=yes -o ConnectTimeout=10 hopper.example.edu sh -s" {
+		t.Errorf("ssh was run with %q", first)
+	}
+}
+
+func TestProbeClustersOffline(t *testing.T) {
+	dir := useFakeSSH(t)
+	activeSettings.Probe = true
+	offline = true
+
+	output := captureStdout(t, func() {
+		clusters := []clusterSpec{{Name: "Hopper", Scheduler: "slurm", Hostname: "hopper.example.edu"}}
+		probeClusters(context.Background(), clusters)
+		if clusters[0].Probe != nil {
+			t.Error("Hopper was probed while offline")
+		}
+	})
+
+	if !strings.Contains(output, "won't be probed, since you're offline") {
+		t.Errorf("output = %q", output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "arguments")); err == nil {
+		t.Error("ssh was run while offline")
+	}
+}
+
+// Returns what run prints to stdout.
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	run()
+	writer.Close()
+	return <-output
+}
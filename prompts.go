@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// Regexps used for validating input. Each of these match input that DOESN'T contain what's named.
+var (
+	lettersAndNumbersPattern = regexp.MustCompile(`^[^a-zA-Z0-9]+$`)
+	lettersPattern           = regexp.MustCompile(`^[^a-zA-Z]+$`)
+	removeBannedSymbols      = regexp.MustCompile("[^a-zA-Z0-9._-]+")
+)
+
+var (
+	// One part of a hostname: letters, numbers and dashes, but not starting or ending with a dash.
+	hostnameLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+	// A release at the end of a MATLAB root, such as /usr/local/MATLAB/R2024a or /Applications/MATLAB_R2024a.app.
+	matlabRootReleasePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(R\d{4}[ab])(?:\.app)?$`)
+)
+
+// Keeps asking the same question until parse accepts the answer. Returns false if the user interrupted.
+func promptUntilValid(rl *readline.Instance, message string, parse func(input string) error) bool {
+	redText := color.New(color.FgRed).SprintFunc()
+
+	for {
+		fmt.Print(message)
+		input, err := rl.Readline()
+		if err != nil {
+			if err == readline.ErrInterrupt || err == io.EOF {
+				fmt.Print(redText("\nExiting from user input."))
+				logger.Warn("interrupted at a prompt")
+				reportFailure(failureInterrupted, "Exiting from user input.")
+				return false
+			}
+			fmt.Print(redText("\nError reading line: ", err))
+			logger.Error("reading a line failed", "error", err)
+			continue
+		}
+
+		if err := parse(input); err != nil {
+			fmt.Print(redText("\n", err, "\n"))
+			continue
+		}
+		return true
+	}
+}
+
+// Uses the engagement spec's answer (or a flag's) when there is one and prompts for it otherwise. A bad answer there is
+// fatal since there's nobody around to correct it. Returns false if the user interrupted.
+func resolveAnswer(rl *readline.Instance, sources map[string]string, field string, specValue *string, message string, parse func(input string) error) bool {
+	if specValue == nil {
+		return promptUntilValid(rl, message, parse)
+	}
+
+	if err := parse(*specValue); err != nil {
+		source, ok := sources[field]
+		if !ok {
+			source = "The engagement spec's " + field
+		}
+		fail(failureInput, "\n", source, " is invalid: ", err)
+	}
+	return true
+}
+
+// Turns an empty string into "not specified" for resolveAnswer.
+func specString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func specBool(value *bool) *string {
+	if value == nil {
+		return nil
+	}
+	return specString(strconv.FormatBool(*value))
+}
+
+func specInt(value int) *string {
+	if value == 0 {
+		return nil
+	}
+	return specString(strconv.Itoa(value))
+}
+
+func normalizeOrganization(input string) (string, error) {
+	organization := strings.TrimSpace(input)
+	organization = strings.ReplaceAll(organization, " ", "-")
+	organization = removeBannedSymbols.ReplaceAllString(organization, "")
+
+	if organization == "" {
+		return "", errors.New("Invalid input. You must input something here.")
+	}
+	return organization, nil
+}
+
+func validateAbbreviation(input string) (string, error) {
+	abbreviation := strings.TrimSpace(input)
+
+	if abbreviation != "" && lettersPattern.MatchString(abbreviation) {
+		return "", errors.New("Invalid input. You may only use letters in the abbreviation and at least 1 letter is required.")
+	}
+	return abbreviation, nil
+}
+
+func normalizeContact(input string) (string, error) {
+	contact := strings.TrimSpace(strings.ToLower(input))
+
+	if contact == "" {
+		return "first-last", nil
+	} else if lettersPattern.MatchString(contact) {
+		return "", errors.New("Invalid input. You may only use letters in the contact name and at least 1 letter is required.")
+	}
+
+	contact = strings.ReplaceAll(contact, " ", "-")
+	contact = removeBannedSymbols.ReplaceAllString(contact, "")
+	return contact, nil
+}
+
+// Zero means no case number was given.
+func parseCaseNumber(input string) (int, error) {
+	input = strings.TrimSpace(input)
+
+	// Don't accept anything other than numbers and blank input.
+	if input == "" {
+		return 0, nil
+	}
+
+	caseNumber, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, errors.New("Invalid input. You must input nothing or a valid case number.")
+	}
+	if caseNumber < 01000000 {
+		return 0, errors.New("Are you sure that's the right Case Number? It seems a bit too small.")
+	} else if caseNumber > 20000000 {
+		return 0, errors.New("Are you sure that's the right Case Number? It seems a bit too large.")
+	}
+	return caseNumber, nil
+}
+
+func parseClusterCount(input string) (int, error) {
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		return 1, nil
+	}
+
+	clusterCount, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, errors.New("Invalid input. Please enter an integer greater than zero.")
+	}
+	if clusterCount < 1 {
+		return 0, errors.New("Invalid input. You've selected zero or less clusters to create scripts for.")
+	}
+	return clusterCount, nil
+}
+
+// Returns the cluster's name as used in file names and the profile name as shown in MATLAB.
+func normalizeClusterName(input string) (clusterName string, profileName string, err error) {
+	profileName = strings.TrimSpace(input)
+	profileName = strings.ReplaceAll(profileName, " ", "-")
+	clusterName = strings.TrimSpace(strings.ToLower(profileName))
+	clusterName = removeBannedSymbols.ReplaceAllString(clusterName, "")
+
+	if clusterName == "" {
+		return "hpc", "HPC", nil
+	} else if lettersAndNumbersPattern.MatchString(clusterName) {
+		return "", "", errors.New("Invalid input. You must include at least 1 letter or number in the cluster's name.")
+	}
+	return clusterName, profileName, nil
+}
+
+// Accepts the scheduler's menu number, its name or any of its aliases, such as sge for Grid Engine.
+func parseScheduler(input string) (string, error) {
+	input = strings.TrimSpace(strings.ToLower(input))
+
+	if input == "" {
+		return "slurm", nil
+	}
+
+	schedulerNumberSelected, err := strconv.Atoi(input)
+	if err != nil {
+		scheduler, err := resolveScheduler(input)
+		return scheduler.Name, err
+	}
+	if schedulerNumberSelected < 1 || schedulerNumberSelected > len(schedulerCatalogue) {
+		return "", fmt.Errorf("You selected an invalid number. You must select a number between 1-%d.", len(schedulerCatalogue))
+	}
+	return schedulerCatalogue[schedulerNumberSelected-1].Name, nil
+}
+
+// Entering nothing is treated as "no".
+func parseYesNo(input string) (bool, error) {
+	switch strings.TrimSpace(strings.ToLower(input)) {
+	case "y", "yes", "true":
+		return true, nil
+	case "n", "no", "false", "":
+		return false, nil
+	}
+	return false, errors.New("Invalid input. You must enter one of the following: \"y\" or \"n\".")
+}
+
+func parseSubmissionType(input string) (string, error) {
+	switch strings.TrimSpace(strings.ToLower(input)) {
+	case "1", "desktop":
+		return "desktop", nil
+	case "2", "cluster":
+		return "cluster", nil
+	case "3", "both", "":
+		return "both", nil
+	}
+	return "", errors.New("Invalid input. Enter a number between 1-3 to select a submission type.")
+}
+
+func parseWorkerCount(input string) (int, error) {
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		return 100000, nil
+	}
+
+	// Don't accept anything other than numbers.
+	numberOfWorkers, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, errors.New("Invalid input. You've likely included a character other than a number.")
+	}
+	if numberOfWorkers < 1 {
+		return 0, errors.New("Invalid input. You've selected zero or less workers.")
+	} else if numberOfWorkers > 100000 {
+		return 0, errors.New("Invalid input. You've selected more than 100000 workers, which is not offered on any license.")
+	} else if numberOfWorkers < 16 { // You've likely got bigger problems on your hands...
+		return 0, errors.New("MATLAB Parallel Server licenses typically aren't issued with and may not work with less than 16 seats. You likely have a bigger issue at hand...")
+	}
+	return numberOfWorkers, nil
+}
+
+func validateMatlabRoot(input string) (string, error) {
+	clusterMatlabRoot := strings.TrimSpace(input)
+
+	if !strings.Contains(clusterMatlabRoot, "/") && !strings.Contains(clusterMatlabRoot, "\\") {
+		return "", errors.New("Invalid filepath.")
+	}
+	return clusterMatlabRoot, nil
+}
+
+// Returns a warning if the MATLAB root ends in a different release than the one the scripts are for, such as
+// /usr/local/MATLAB/R2023b for R2024a's. It's only a warning, since MATLAB can be installed anywhere.
+func matlabRootWarning(clusterMatlabRoot string) string {
+	match := matlabRootReleasePattern.FindStringSubmatch(strings.TrimRight(clusterMatlabRoot, "/\\"))
+	if match == nil || releaseNumber == "" || strings.EqualFold(match[1], releaseNumber) {
+		return ""
+	}
+	return fmt.Sprintf("%s looks like %s's MATLAB root, but these scripts are for %s.", clusterMatlabRoot, match[1], releaseNumber)
+}
+
+// The MATLAB root with the release it ends in changed to release, such as /usr/local/MATLAB/R2024b for
+// /usr/local/MATLAB/R2024a. Roots that don't end in a release are returned as they are.
+func matlabRootForRelease(clusterMatlabRoot, release string) string {
+	trimmed := strings.TrimRight(clusterMatlabRoot, "/\\")
+	match := matlabRootReleasePattern.FindStringSubmatchIndex(trimmed)
+	if match == nil {
+		return clusterMatlabRoot
+	}
+	return trimmed[:match[2]] + release + trimmed[match[3]:]
+}
+
+// Accepts a hostname, FQDN or IPv4 or IPv6 address.
+func validateHostname(input string) (string, error) {
+	clusterHostname := strings.TrimSpace(input)
+
+	if clusterHostname == "" {
+		return "", errors.New("Invalid input. You must input something here.")
+	}
+
+	// IPv6 addresses are sometimes written in brackets, like in URLs.
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(clusterHostname, "["), "]")); ip != nil {
+		return ip.String(), nil
+	}
+
+	if strings.Contains(clusterHostname, "@") {
+		return "", errors.New("Invalid input. Enter just the hostname, without a username.")
+	} else if strings.Contains(clusterHostname, ":") {
+		return "", errors.New("Invalid input. Enter just the hostname, without a port. If SSH needs one, add it to sshCommand.")
+	}
+
+	// A fully qualified name may end in a dot.
+	name := strings.TrimSuffix(clusterHostname, ".")
+	if len(name) > 253 {
+		return "", errors.New("Invalid input. Hostnames can't be longer than 253 characters.")
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		if !hostnameLabelPattern.MatchString(label) {
+			return "", fmt.Errorf("Invalid input. \"%s\" isn't a valid hostname, FQDN or IP address. Each part between dots may only use letters, numbers and dashes, and can't start or end with a dash.", clusterHostname)
+		}
+	}
+
+	// Top-level domains are never all numbers, so this was meant to be an IP address.
+	if _, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+		return "", fmt.Errorf("Invalid input. \"%s\" isn't a valid IP address.", clusterHostname)
+	}
+	return clusterHostname, nil
+}
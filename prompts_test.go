@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		error string
+	}{
+		{"hopper", "hopper", ""},
+		{" hopper.example.edu ", "hopper.example.edu", ""},
+		{"hopper.example.edu.", "hopper.example.edu.", ""},
+		{"login-1.hpc.example.edu", "login-1.hpc.example.edu", ""},
+		{"10.0.0.5", "10.0.0.5", ""},
+		{"2001:db8::1", "2001:db8::1", ""},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+		{"[2001:0db8:0000::0001]", "2001:db8::1", ""},
+		{"", "", "You must input something here."},
+		{"you@hopper.example.edu", "", "without a username"},
+		{"hopper.example.edu:2222", "", "without a port"},
+		{"[2001:db8::1]:22", "", "without a port"},
+		{"10.0.0.256", "", `"10.0.0.256" isn't a valid IP address.`},
+		{"hopper.123", "", `"hopper.123" isn't a valid IP address.`},
+		{"hopper..example.edu", "", "isn't a valid hostname"},
+		{"-hopper.example.edu", "", "isn't a valid hostname"},
+		{"hopper-.example.edu", "", "isn't a valid hostname"},
+		{"hopper_1.example.edu", "", "isn't a valid hostname"},
+		{"hopper.example.edu..", "", "isn't a valid hostname"},
+		{strings.Repeat("a", 64) + ".example.edu", "", "isn't a valid hostname"},
+		{strings.Repeat("a.", 127) + "edu", "", "longer than 253 characters"},
+	}
+	for _, test := range tests {
+		got, err := validateHostname(test.input)
+		if test.error == "" {
+			if err != nil || got != test.want {
+				t.Errorf("validateHostname(%q) = %q, %v; want %q", test.input, got, err, test.want)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("validateHostname(%q) = %q, %v; want an error saying %q", test.input, got, err, test.error)
+		}
+	}
+}
+
+func TestMatlabRootWarning(t *testing.T) {
+	previousRelease := releaseNumber
+	t.Cleanup(func() { releaseNumber = previousRelease })
+	releaseNumber = "R2024a"
+
+	tests := []struct {
+		matlabRoot string
+		warns      string
+	}{
+		{"/usr/local/MATLAB/R2024a", ""},
+		{"/usr/local/MATLAB/r2024a/", ""},
+		{"/usr/local/MATLAB/R2023b", "R2023b"},
+		{"/usr/local/MATLAB/R2023b/", "R2023b"},
+		{`C:\Program Files\MATLAB\R2023b\`, "R2023b"},
+		{"/Applications/MATLAB_R2023b.app", "R2023b"},
+		{"/Applications/MATLAB_R2024a.app/", ""},
+		{"/opt/matlab-R2023b", "R2023b"},
+		{"/opt/matlab/latest", ""},
+		{"/opt/XR2023b", ""},
+		{"/opt/R2023b/bin", ""},
+	}
+	for _, test := range tests {
+		warning := matlabRootWarning(test.matlabRoot)
+		if test.warns == "" && warning != "" {
+			t.Errorf("matlabRootWarning(%q) = %q, want no warning", test.matlabRoot, warning)
+		} else if test.warns != "" && !strings.Contains(warning, test.warns+"'s MATLAB root, but these scripts are for R2024a") {
+			t.Errorf("matlabRootWarning(%q) = %q, want a warning about %s", test.matlabRoot, warning, test.warns)
+		}
+	}
+
+	releaseNumber = ""
+	if warning := matlabRootWarning("/usr/local/MATLAB/R2023b"); warning != "" {
+		t.Errorf("warned with no release set: %q", warning)
+	}
+}
+
+func TestMatlabRootForRelease(t *testing.T) {
+	tests := []struct {
+		matlabRoot string
+		want       string
+	}{
+		{"/usr/local/MATLAB/R2024a", "/usr/local/MATLAB/R2024b"},
+		{"/usr/local/MATLAB/R2024a/", "/usr/local/MATLAB/R2024b"},
+		{"/Applications/MATLAB_R2024a.app", "/Applications/MATLAB_R2024b.app"},
+		{`C:\Program Files\MATLAB\R2024a`, `C:\Program Files\MATLAB\R2024b`},
+		{"/opt/matlab/latest", "/opt/matlab/latest"},
+	}
+	for _, test := range tests {
+		if got := matlabRootForRelease(test.matlabRoot, "R2024b"); got != test.want {
+			t.Errorf("matlabRootForRelease(%q) = %q, want %q", test.matlabRoot, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-git/go-git/v5"
+)
+
+// Written to -report when an engagement command ends, however it ends, so runs can be tracked elsewhere.
+type runReport struct {
+	Command      string         `json:"command"`
+	StartedAt    time.Time      `json:"startedAt"`
+	FinishedAt   time.Time      `json:"finishedAt"`
+	Succeeded    bool           `json:"succeeded"`
+	DryRun       bool           `json:"dryRun,omitempty"`
+	Organization string         `json:"organization,omitempty"`
+	Abbreviation string         `json:"abbreviation,omitempty"`
+	Contact      string         `json:"contact,omitempty"`
+	CaseNumber   int            `json:"caseNumber,omitempty"`
+	Release      string         `json:"release,omitempty"`
+	Team         string         `json:"team,omitempty"`
+	Clusters     []clusterSpec  `json:"clusters,omitempty"`
+	Plugins      []pluginLock   `json:"plugins,omitempty"`
+	Files        []reportedFile `json:"files,omitempty"`
+	Commit       string         `json:"commit,omitempty"`
+	GitLab       *gitLabResult  `json:"gitlab,omitempty"`
+	Failures     []runFailure   `json:"failures,omitempty"`
+}
+
+type reportedFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type gitLabResult struct {
+	ProjectURL string `json:"projectURL,omitempty"`
+	Created    bool   `json:"created"`
+	Pushed     bool   `json:"pushed"`
+}
+
+type runFailure struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// What went wrong, for the report's failures.
+const (
+	failureSettings      = "settings"
+	failureInput         = "input"
+	failureInterrupted   = "interrupted"
+	failurePlugins       = "plugins"
+	failurePrerequisites = "prerequisites"
+	failureGeneration    = "generation"
+	failureGit           = "git"
+	failureGitLab        = "gitlab"
+)
+
+var (
+	// Set by -report.
+	reportPath string
+
+	report           runReport
+	reportLock       sync.Mutex
+	reportWritten    bool
+	reportingEnabled bool
+)
+
+// Starts the report for an engagement command. Other commands don't write one.
+func startRunReport(command string) {
+	reportingEnabled = reportPath != ""
+	report = runReport{Command: command, StartedAt: time.Now().UTC()}
+}
+
+func reportFailure(category string, message ...any) {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	report.Failures = append(report.Failures, runFailure{Category: category, Message: strings.TrimSpace(fmt.Sprint(message...))})
+}
+
+// Prints message in red, records it in the run report under category and exits.
+func fail(category string, message ...any) {
+	redText := color.New(color.FgRed).SprintFunc()
+	fmt.Print(redText(message...))
+	logger.Error(strings.TrimSpace(fmt.Sprint(message...)), "category", category)
+	reportFailure(category, message...)
+	exitRun(1)
+}
+
+// Writes the run report, if there's one to write, and exits.
+func exitRun(code int) {
+	logger.Info("run ended", "exitCode", code)
+	writeRunReport()
+	os.Exit(code)
+}
+
+// Writes the run report once, however many times it's called.
+func writeRunReport() {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	if !reportingEnabled || reportWritten {
+		return
+	}
+	reportWritten = true
+
+	report.FinishedAt = time.Now().UTC()
+	report.Succeeded = len(report.Failures) == 0
+	report.DryRun = dryRun
+	report.Organization = organizationSelected
+	report.Abbreviation = organizationAbbreviation
+	report.Contact = organizationContact
+	report.CaseNumber = caseNumber
+	report.Release = releaseNumber
+	report.Team = team
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(reportPath, append(content, '\n'), 0644)
+	}
+	if err != nil {
+		redText := color.New(color.FgRed).SprintFunc()
+		fmt.Print(redText("\nError writing the run report: ", err))
+		logger.Error("writing the run report failed", "path", reportPath, "error", err)
+		return
+	}
+	logger.Debug("run report written", "path", reportPath)
+}
+
+// Records every file in folder, as it'll be once it's moved to destination.
+func reportFilesIn(folder, destination string) error {
+	if !reportingEnabled {
+		return nil
+	}
+	return filepath.WalkDir(folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		return reportFileAs(path, filepath.Join(destination, relativePath))
+	})
+}
+
+func reportFile(path string) error {
+	if !reportingEnabled {
+		return nil
+	}
+	return reportFileAs(path, path)
+}
+
+func reportFileAs(path, reportedPath string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	fileHash, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	report.Files = append(report.Files, reportedFile{Path: reportedPath, SHA256: fileHash, Size: info.Size()})
+	return nil
+}
+
+// Records the commit the repo at folderPath is on.
+func reportCommit(folderPath string) {
+	if !reportingEnabled {
+		return
+	}
+	repo, err := git.PlainOpen(folderPath)
+	if err != nil {
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return
+	}
+	report.Commit = head.Hash().String()
+}
+
+// The GitLab part of the report, made when it's first needed.
+func reportedGitLab() *gitLabResult {
+	if report.GitLab == nil {
+		report.GitLab = &gitLabResult{}
+	}
+	return report.GitLab
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes the report to a temporary file and puts back the globals it's made from afterwards.
+func useTempReport(t *testing.T) string {
+	t.Helper()
+	savedPath, savedReport, savedWritten, savedEnabled := reportPath, report, reportWritten, reportingEnabled
+	savedDryRun, savedOrganization, savedAbbreviation, savedContact := dryRun, organizationSelected, organizationAbbreviation, organizationContact
+	savedCase, savedRelease, savedTeam := caseNumber, releaseNumber, team
+	t.Cleanup(func() {
+		reportPath, report, reportWritten, reportingEnabled = savedPath, savedReport, savedWritten, savedEnabled
+		dryRun, organizationSelected, organizationAbbreviation, organizationContact = savedDryRun, savedOrganization, savedAbbreviation, savedContact
+		caseNumber, releaseNumber, team = savedCase, savedRelease, savedTeam
+	})
+	reportPath, reportWritten = filepath.Join(t.TempDir(), "report.json"), false
+	dryRun, organizationSelected, organizationAbbreviation, organizationContact = false, "", "", ""
+	caseNumber, releaseNumber, team = 0, "", ""
+	return reportPath
+}
+
+// A repo with one commit in it, and the commit's hash.
+func committedRepo(t *testing.T) (string, string) {
+	t.Helper()
+	repoPath := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com", "commit", "-q", "--allow-empty", "-m", "Initial commit"},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", repoPath}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, output)
+		}
+	}
+	hash, err := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repoPath, strings.TrimSpace(string(hash))
+}
+
+func TestRunReportJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T) map[string]any // What's reported, returning the fields that can't be written down ahead of time.
+		want string
+	}{
+		{
+			"made and pushed",
+			func(t *testing.T) map[string]any {
+				organizationSelected, organizationAbbreviation, organizationContact = "Acme-Labs", "AL", "jane-doe"
+				caseNumber, releaseNumber, team = 1234567, "R2024a", "hpc"
+				report.Clusters = []clusterSpec{{Name: "Hopper", Scheduler: "slurm", CustomMPI: specPointer(false), SubmissionType: "desktop", Workers: 64, MatlabRoot: "/usr/local/MATLAB/R2024a", Hostname: "hopper.example.edu"}}
+				report.Plugins = []pluginLock{{Scheduler: "slurm", Source: "https://github.com/mathworks/matlab-parallel-slurm-plugin", Ref: "main", Revision: strings.Repeat("a", 40), SHA256: strings.Repeat("b", 64)}}
+
+				folder := t.TempDir()
+				os.MkdirAll(filepath.Join(folder, "scripts"), 0755)
+				os.WriteFile(filepath.Join(folder, "scripts", "README.txt"), []byte("hello\n"), 0644)
+				if err := reportFilesIn(folder, filepath.Join("/repo", "Acme-Labs", "jane-doe")); err != nil {
+					t.Fatal(err)
+				}
+
+				repoPath, hash := committedRepo(t)
+				reportCommit(repoPath)
+				*reportedGitLab() = gitLabResult{ProjectURL: "https://gitlab.example.com/customers/Acme-Labs", Created: true}
+				reportedGitLab().Pushed = true
+				return map[string]any{"commit": hash}
+			},
+			`{
+				"command": "create",
+				"succeeded": true,
+				"organization": "Acme-Labs",
+				"abbreviation": "AL",
+				"contact": "jane-doe",
+				"caseNumber": 1234567,
+				"release": "R2024a",
+				"team": "hpc",
+				"clusters": [{"name": "Hopper", "scheduler": "slurm", "customMPI": false, "submissionType": "desktop", "workers": 64, "matlabRoot": "/usr/local/MATLAB/R2024a", "hostname": "hopper.example.edu"}],
+				"plugins": [{"scheduler": "slurm", "source": "https://github.com/mathworks/matlab-parallel-slurm-plugin", "ref": "main", "revision": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "sha256": "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}],
+				"files": [{"path": "/repo/Acme-Labs/jane-doe/scripts/README.txt", "sha256": "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "size": 6}],
+				"gitlab": {"projectURL": "https://gitlab.example.com/customers/Acme-Labs", "created": true, "pushed": true}
+			}`,
+		},
+		{
+			// Nothing that wasn't got to is in it, but whether it was a dry run is.
+			"dry run that failed",
+			func(t *testing.T) map[string]any {
+				dryRun, organizationSelected = true, "Acme-Labs"
+				reportFailure(failurePrerequisites, "Gold/R2024a/slurm/postConstructFcn.m is missing from gitRepoPath (needed by slurm).\n")
+				reportFailure(failureInterrupted, "\nExiting from user input...")
+				return nil
+			},
+			`{
+				"command": "create",
+				"succeeded": false,
+				"dryRun": true,
+				"organization": "Acme-Labs",
+				"failures": [
+					{"category": "prerequisites", "message": "Gold/R2024a/slurm/postConstructFcn.m is missing from gitRepoPath (needed by slurm)."},
+					{"category": "interrupted", "message": "Exiting from user input..."}
+				]
+			}`,
+		},
+		{
+			// GitLab's part is there as soon as anything's tried, even if it didn't get anywhere.
+			"GitLab failed",
+			func(t *testing.T) map[string]any {
+				reportedGitLab()
+				reportFailure(failureGitLab, "GitLab answered 500 Internal Server Error.")
+				return nil
+			},
+			`{
+				"command": "create",
+				"succeeded": false,
+				"gitlab": {"created": false, "pushed": false},
+				"failures": [{"category": "gitlab", "message": "GitLab answered 500 Internal Server Error."}]
+			}`,
+		},
+	}
+	for _, test := range tests {
+		path := useTempReport(t)
+		startRunReport("create")
+		known := test.run(t)
+		writeRunReport()
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(content, &got); err != nil {
+			t.Fatalf("%s: the report isn't JSON: %v\n%s", test.name, err, content)
+		}
+
+		// The times are checked for being RFC 3339 and in order, and then left out.
+		startedAt, startErr := time.Parse(time.RFC3339Nano, got["startedAt"].(string))
+		finishedAt, finishErr := time.Parse(time.RFC3339Nano, got["finishedAt"].(string))
+		if startErr != nil || finishErr != nil || finishedAt.Before(startedAt) || startedAt.Location() != time.UTC {
+			t.Errorf("%s: the report ran from %v to %v (%v, %v)", test.name, got["startedAt"], got["finishedAt"], startErr, finishErr)
+		}
+		delete(got, "startedAt")
+		delete(got, "finishedAt")
+
+		var want map[string]any
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for key, value := range known {
+			want[key] = value
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the report is\n%s\nwant\n%s", test.name, content, test.want)
+		}
+	}
+}
+
+func TestRunReportWrittenOnce(t *testing.T) {
+	path := useTempReport(t)
+	startRunReport("update")
+	writeRunReport()
+
+	// Anything after it's written, such as exitRun after fail, doesn't change it.
+	os.WriteFile(path, []byte("written"), 0644)
+	reportFailure(failureGit, "too late")
+	writeRunReport()
+	if content, _ := os.ReadFile(path); string(content) != "written" {
+		t.Errorf("the report was written twice: %s", content)
+	}
+
+	// Without -report, there's nothing to write.
+	reportPath, reportWritten = "", false
+	startRunReport("create")
+	writeRunReport()
+	if reportFile(path) != nil || len(report.Files) != 0 {
+		t.Errorf("files were reported without -report: %+v", report.Files)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Everything we need to know about a scheduler's integration scripts.
+type schedulerEntry struct {
+	Name  string `yaml:"name" json:"name"`
+	Label string `yaml:"label" json:"label"`
+
+	// Other names it can be selected by, such as sge for Grid Engine.
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+
+	// Where the plugin's zip archive is downloaded from. If this isn't set, it's built from the GitHub repository and ref.
+	URL        string `yaml:"url,omitempty" json:"url,omitempty"`
+	Repository string `yaml:"repository,omitempty" json:"repository,omitempty"` // Such as mathworks/matlab-parallel-slurm-plugin.
+
+	// A Git repository to shallow clone the plugin from instead of downloading a zip, such as an internal mirror or a
+	// GitLab fork. cloneTokenSource is where to get a token for it, in the same form as accessTokenSource.
+	Clone            string `yaml:"clone,omitempty" json:"clone,omitempty"`
+	CloneTokenSource string `yaml:"cloneTokenSource,omitempty" json:"cloneTokenSource,omitempty"`
+
+	// A branch, tag or commit SHA to pin the plugin to. Defaults to main.
+	Ref string `yaml:"ref,omitempty" json:"ref,omitempty"`
+
+	// The folder the plugin is extracted to, such as matlab-parallel-slurm-plugin-main. Archives of a pinned ref extract
+	// to a differently named folder, which is renamed to this.
+	ArchiveFolder string `yaml:"archiveFolder" json:"archiveFolder"`
+
+	// What the scheduler supports. See the capability constants below.
+	Capabilities []string `yaml:"capabilities" json:"capabilities"`
+
+	// Commands -probe expects to find on the cluster, such as sbatch.
+	Commands []string `yaml:"commands,omitempty" json:"commands,omitempty"`
+}
+
+// Capabilities a scheduler can have.
+const (
+	capabilityConfigScripts   = "configScripts"   // Has scripts in Utilities/config-scripts/<name>/bin.
+	capabilityHelperFunctions = "helperFunctions" // Has functions in Utilities/helper-fcn/<name>.
+	capabilityQueueName       = "queueName"       // Uses QueueName in its conf files.
+	capabilityPartition       = "partition"       // Uses Partition in its conf files.
+)
+
+// Scheduler names end up in file names, so they're kept simple.
+var schedulerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+var schedulerCapabilities = []string{capabilityConfigScripts, capabilityHelperFunctions, capabilityQueueName, capabilityPartition}
+
+func (entry schedulerEntry) has(capability string) bool {
+	return slices.Contains(entry.Capabilities, capability)
+}
+
+func mathWorksScheduler(name, label string, aliases, commands []string, capabilities ...string) schedulerEntry {
+	return schedulerEntry{
+		Name:          name,
+		Label:         label,
+		Aliases:       aliases,
+		Repository:    "mathworks/matlab-parallel-" + name + "-plugin",
+		Ref:           "main",
+		ArchiveFolder: "matlab-parallel-" + name + "-plugin-main",
+		Capabilities:  capabilities,
+		Commands:      commands,
+	}
+}
+
+// Where to download the plugin's archive from.
+func (entry schedulerEntry) archiveURL() string {
+	if entry.URL != "" {
+		return entry.URL
+	}
+
+	ref := entry.Ref
+	if ref == "" || ref == "main" {
+		ref = "refs/heads/main"
+	}
+	return "https://codeload.github.com/" + entry.Repository + "/zip/" + ref
+}
+
+// The schedulers offered, in menu order. schedulers.yaml files can change or add to these.
+var schedulerCatalogue = []schedulerEntry{
+	mathWorksScheduler("slurm", "Slurm", nil, []string{"sbatch", "squeue", "scancel"}, capabilityConfigScripts, capabilityHelperFunctions, capabilityPartition),
+	mathWorksScheduler("pbs", "PBS", []string{"openpbs", "pbspro", "pbs-pro", "torque"}, []string{"qsub", "qstat", "qdel"}, capabilityConfigScripts, capabilityHelperFunctions, capabilityQueueName),
+	mathWorksScheduler("lsf", "LSF", []string{"spectrum-lsf", "ibm-lsf"}, []string{"bsub", "bjobs", "bkill"}, capabilityConfigScripts, capabilityHelperFunctions, capabilityQueueName),
+	mathWorksScheduler("gridengine", "Grid Engine", []string{"sge", "uge", "soge", "ogs", "son-of-grid-engine", "univa"}, []string{"qsub", "qstat", "qdel"}, capabilityConfigScripts, capabilityHelperFunctions, capabilityQueueName),
+	mathWorksScheduler("htcondor", "HTCondor", []string{"condor"}, []string{"condor_submit", "condor_q", "condor_rm"}),
+	mathWorksScheduler("awsbatch", "AWS", []string{"aws", "aws-batch", "batch"}, nil),
+	mathWorksScheduler("kubernetes", "Kubernetes", []string{"k8s", "kube"}, []string{"kubectl", "helm"}),
+}
+
+// The file in each config location that can override the built-in scheduler catalogue.
+const schedulerCatalogueFileName = "schedulers.yaml"
+
+// Merges a schedulers.yaml file into the catalogue. Entries whose name matches an existing scheduler replace whichever
+// fields they set; any others are added to the end of the menu. The file holds a list of entries, as YAML or JSON.
+func mergeSchedulerCatalogue(cataloguePath string) error {
+	content, err := os.ReadFile(cataloguePath)
+	if err != nil {
+		return err
+	}
+
+	var entries []schedulerEntry
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&entries); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", cataloguePath, err)
+	}
+
+	for i, entry := range entries {
+		entry.Name = strings.ToLower(strings.TrimSpace(entry.Name))
+		if entry.Name == "" {
+			return fmt.Errorf("%s: entry #%d has no name", cataloguePath, i+1)
+		}
+		if !schedulerNamePattern.MatchString(entry.Name) {
+			return fmt.Errorf("%s: \"%s\" may only use letters, numbers, dots, dashes and underscores", cataloguePath, entry.Name)
+		}
+		for j, alias := range entry.Aliases {
+			entry.Aliases[j] = normalizeSchedulerName(alias)
+			if !schedulerNamePattern.MatchString(entry.Aliases[j]) {
+				return fmt.Errorf("%s: %s: the alias \"%s\" may only use letters, numbers, dots, dashes and underscores", cataloguePath, entry.Name, alias)
+			}
+		}
+		for _, capability := range entry.Capabilities {
+			if !slices.Contains(schedulerCapabilities, capability) {
+				return fmt.Errorf("%s: %s: unknown capability \"%s\"; use one of %s", cataloguePath, entry.Name, capability, strings.Join(schedulerCapabilities, ", "))
+			}
+		}
+
+		index := slices.IndexFunc(schedulerCatalogue, func(existing schedulerEntry) bool { return existing.Name == entry.Name })
+		if index == -1 {
+			if (entry.URL == "" && entry.Repository == "" && entry.Clone == "") || entry.ArchiveFolder == "" {
+				return fmt.Errorf("%s: %s: new schedulers need a url, repository or clone and an archiveFolder", cataloguePath, entry.Name)
+			}
+			if entry.Label == "" {
+				entry.Label = entry.Name
+			}
+			schedulerCatalogue = append(schedulerCatalogue, entry)
+			continue
+		}
+
+		existing := &schedulerCatalogue[index]
+		if entry.Label != "" {
+			existing.Label = entry.Label
+		}
+		if entry.URL != "" {
+			existing.URL = entry.URL
+		}
+		if entry.Repository != "" {
+			existing.Repository = entry.Repository
+		}
+		if entry.Clone != "" {
+			existing.Clone = entry.Clone
+		}
+		if entry.CloneTokenSource != "" {
+			existing.CloneTokenSource = entry.CloneTokenSource
+		}
+		if entry.Ref != "" {
+			existing.Ref = entry.Ref
+		}
+		if entry.ArchiveFolder != "" {
+			existing.ArchiveFolder = entry.ArchiveFolder
+		}
+		if entry.Capabilities != nil {
+			existing.Capabilities = entry.Capabilities
+		}
+		if entry.Commands != nil {
+			existing.Commands = entry.Commands
+		}
+		if entry.Aliases != nil {
+			existing.Aliases = entry.Aliases
+		}
+	}
+
+	// An alias that could mean two schedulers would pick whichever comes first, so it's not allowed.
+	for i, entry := range schedulerCatalogue {
+		for _, alias := range entry.Aliases {
+			for _, other := range schedulerCatalogue[:i] {
+				if other.Name == alias || slices.Contains(other.Aliases, alias) {
+					return fmt.Errorf("%s: %s's alias \"%s\" is already used by %s", cataloguePath, entry.Name, alias, other.Name)
+				}
+			}
+			for _, other := range schedulerCatalogue[i+1:] {
+				if other.Name == alias {
+					return fmt.Errorf("%s: %s's alias \"%s\" is already used by %s", cataloguePath, entry.Name, alias, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Loads any schedulers.yaml from the same places settings.txt is read from, user config first.
+func loadSchedulerCatalogue() error {
+	for _, file := range configFilePaths(schedulerCatalogueFileName) {
+		if _, err := os.Stat(file.path); os.IsNotExist(err) {
+			continue
+		}
+		if err := mergeSchedulerCatalogue(file.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findScheduler(name string) (schedulerEntry, bool) {
+	for _, entry := range schedulerCatalogue {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return schedulerEntry{}, false
+}
+
+// The schedulers the clusters use, each once, in the order they're first used.
+func clusterSchedulers(clusters []clusterSpec) []schedulerEntry {
+	var schedulers []schedulerEntry
+	for _, cluster := range clusters {
+		scheduler, _ := findScheduler(cluster.Scheduler)
+		if !slices.ContainsFunc(schedulers, func(s schedulerEntry) bool { return s.Name == scheduler.Name }) {
+			schedulers = append(schedulers, scheduler)
+		}
+	}
+	return schedulers
+}
+
+// Scheduler names and aliases are compared in lowercase with dashes for spaces, so "Grid Engine" is grid-engine.
+func normalizeSchedulerName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// Finds the scheduler a name refers to, whether it's the scheduler's name, one of its aliases or its label. This is
+// what prompts, flags and specs all go through. An unknown name gets an error suggesting the closest one.
+func resolveScheduler(name string) (schedulerEntry, error) {
+	name = normalizeSchedulerName(name)
+	for _, entry := range schedulerCatalogue {
+		if entry.Name == name || slices.Contains(entry.Aliases, name) || normalizeSchedulerName(entry.Label) == name {
+			return entry, nil
+		}
+	}
+
+	var names, candidates []string
+	for _, entry := range schedulerCatalogue {
+		names = append(names, entry.Name)
+		candidates = append(append(candidates, entry.Name, normalizeSchedulerName(entry.Label)), entry.Aliases...)
+	}
+	if suggestion := suggestName(name, candidates); suggestion != "" {
+		return schedulerEntry{}, fmt.Errorf("There's no scheduler called \"%s\". Did you mean \"%s\"?", name, suggestion)
+	}
+	return schedulerEntry{}, fmt.Errorf("There's no scheduler called \"%s\". Enter a number or one of %s.", name, strings.Join(names, ", "))
+}
+
+// The scheduler menu, such as "[1 Slurm] [2 PBS]".
+func schedulerMenu() string {
+	var options []string
+	for i, entry := range schedulerCatalogue {
+		options = append(options, fmt.Sprintf("[%d %s]", i+1, entry.Label))
+	}
+	return strings.Join(options, " ")
+}
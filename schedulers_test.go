@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveScheduler(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"slurm", "slurm"},
+		{"SLURM", "slurm"},
+		{" Slurm ", "slurm"},
+		{"sge", "gridengine"},
+		{"UGE", "gridengine"},
+		{"Grid Engine", "gridengine"},
+		{"grid  engine", "gridengine"},
+		{"son-of-grid-engine", "gridengine"},
+		{"openpbs", "pbs"},
+		{"torque", "pbs"},
+		{"condor", "htcondor"},
+		{"k8s", "kubernetes"},
+		{"aws-batch", "awsbatch"},
+		{"Spectrum LSF", "lsf"},
+	}
+	for _, test := range tests {
+		entry, err := resolveScheduler(test.name)
+		if err != nil || entry.Name != test.want {
+			t.Errorf("resolveScheduler(%q) = %q, %v; want %q", test.name, entry.Name, err, test.want)
+		}
+	}
+}
+
+func TestResolveSchedulerSuggestions(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"slrum", `There's no scheduler called "slrum". Did you mean "slurm"?`},
+		{"kuber", `There's no scheduler called "kuber". Did you mean "kubernetes"?`},
+		{"gridengin", `There's no scheduler called "gridengin". Did you mean "gridengine"?`},
+		{"HT Condor", `There's no scheduler called "ht-condor". Did you mean "htcondor"?`},
+		{"openpbss", `There's no scheduler called "openpbss". Did you mean "openpbs"?`},
+		{"mesos-cluster", `There's no scheduler called "mesos-cluster". Enter a number or one of slurm, pbs, lsf, gridengine, htcondor, awsbatch, kubernetes.`},
+	}
+	for _, test := range tests {
+		_, err := resolveScheduler(test.name)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("resolveScheduler(%q) = %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestClusterSchedulers(t *testing.T) {
+	clusters := []clusterSpec{{Name: "Hopper", Scheduler: "gridengine"}, {Name: "Lovelace", Scheduler: "slurm"}, {Name: "Turing", Scheduler: "gridengine"}, {Name: "Babbage", Scheduler: "slurm"}}
+	var names []string
+	for _, scheduler := range clusterSchedulers(clusters) {
+		names = append(names, scheduler.Name)
+	}
+	if !slices.Equal(names, []string{"gridengine", "slurm"}) {
+		t.Errorf("clusterSchedulers = %v, want each scheduler once", names)
+	}
+}
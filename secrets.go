@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// A secret never prints as anything but a placeholder, so passing one to fmt or an error can't leak it. Use Reveal()
+// only where the real value has to be handed over, such as an Authorization header.
+type secret string
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s secret) GoString() string {
+	return s.String()
+}
+
+// Covers every verb, since fmt prints the raw value for ones a string doesn't support, such as %d.
+func (s secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, s.String())
+}
+
+// slog's JSON handler would otherwise write the raw value.
+func (s secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s secret) Reveal() string {
+	return string(s)
+}
+
+// Every secret we've resolved, so that they can be scrubbed from text we didn't produce ourselves, such as error
+// messages and API responses.
+var (
+	knownSecrets      []string
+	knownSecretsMutex sync.Mutex
+)
+
+func registerSecret(value secret) {
+	if value == "" {
+		return
+	}
+	knownSecretsMutex.Lock()
+	defer knownSecretsMutex.Unlock()
+	knownSecrets = append(knownSecrets, value.Reveal())
+}
+
+// Replaces any known secret in text with a placeholder.
+func redactSecrets(text string) string {
+	knownSecretsMutex.Lock()
+	defer knownSecretsMutex.Unlock()
+
+	for _, knownSecret := range knownSecrets {
+		text = strings.ReplaceAll(text, knownSecret, secret(knownSecret).String())
+	}
+	return text
+}
+
+// Wraps an error so its message has any known secrets scrubbed from it.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return redactSecrets(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Resolves a secret from one of these sources:
+//   - env:NAME reads the environment variable NAME.
+//   - file:PATH reads the first line of PATH, which must not be readable by anyone but you (chmod 600.)
+//   - git-credential asks Git's credential helpers for the password to gitRepoAPIURL's host.
+//   - exec:COMMAND runs COMMAND (split on spaces, no shell) and uses what it prints.
+func resolveSecret(source, gitRepoAPIURL string) (secret, error) {
+	kind, argument, _ := strings.Cut(source, ":")
+	var value string
+
+	switch kind {
+	case "env":
+		value = os.Getenv(argument)
+		if value == "" {
+			return "", fmt.Errorf("the environment variable %s is empty or not set", argument)
+		}
+
+	case "file":
+		info, err := os.Stat(argument)
+		if err != nil {
+			return "", err
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return "", fmt.Errorf("%s has permissions %#o; it must only be readable by you (chmod 600 %s)", argument, info.Mode().Perm(), argument)
+		}
+
+		content, err := os.ReadFile(argument)
+		if err != nil {
+			return "", err
+		}
+		value, _, _ = strings.Cut(string(content), "\n")
+
+	case "git-credential":
+		password, err := gitCredentialFill(gitRepoAPIURL)
+		if err != nil {
+			return "", err
+		}
+		value = password
+
+	case "exec":
+		commandParts := strings.Fields(argument)
+		if len(commandParts) == 0 {
+			return "", errors.New("no command given after exec:")
+		}
+
+		cmd := exec.Command(commandParts[0], commandParts[1:]...)
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("running %s failed: %w", commandParts[0], err)
+		}
+		value = string(output)
+
+	default:
+		return "", fmt.Errorf("unrecognized secret source \"%s\"; use env:, file:, git-credential or exec:", source)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s gave an empty secret", kind)
+	}
+
+	registerSecret(secret(value))
+	return secret(value), nil
+}
+
+// Speaks Git's credential helper protocol (see git-credential(1)) to look up the password for the API URL's host.
+func gitCredentialFill(gitRepoAPIURL string) (string, error) {
+	if gitRepoAPIURL == "" {
+		return "", errors.New("gitRepoAPIURL must be set to look up credentials with git-credential")
+	}
+
+	parsedURL, err := url.Parse(gitRepoAPIURL)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", parsedURL.Scheme, parsedURL.Host))
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git credential fill failed: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if password, found := strings.CutPrefix(scanner.Text(), "password="); found {
+			return password, nil
+		}
+	}
+	return "", fmt.Errorf("git credential fill returned no password for %s", parsedURL.Host)
+}
@@ -0,0 +1,782 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Everything that can be set in settings.txt.
+type settings struct {
+	DownloadScriptsOnLaunch      bool
+	DownloadWorkers              int
+	Offline                      bool
+	ClonePlugins                 bool
+	ScriptsPath                  string
+	CABundle                     string
+	CachePath                    string
+	LogPath                      string
+	Verbose                      bool
+	Wizard                       bool
+	Probe                        bool
+	SSHCommand                   string
+	AccessToken                  secret
+	AccessTokenSource            string
+	GitEmailAddress              string
+	GitExistingRepoCommitMessage string
+	GitGroupID                   int
+	GitGroupName                 string
+	GitRepoPath                  string
+	GitRepoAPIURL                string
+	GitUsername                  string
+	ReleaseNumber                string
+	Team                         string
+	SubmitToRemoteRepo           bool
+	Remote                       string
+
+	// Named remote profiles, set with "remote.<name>.<setting> = value". Only remoteSettingNames are used in them.
+	Remotes map[string]*settings
+}
+
+// Where settings come from, lowest precedence first.
+var settingLayers = []string{"default", "user config", "project", "environment", "flag"}
+
+// A single setting's value and where it came from. For settings files, source is the file's path and line is set.
+// For the environment and flags, source is the variable or flag's name.
+type settingEntry struct {
+	key    string
+	value  string
+	layer  string
+	source string
+	line   int
+}
+
+func (entry settingEntry) location() string {
+	if entry.line > 0 {
+		return fmt.Sprintf("%s:%d", entry.source, entry.line)
+	}
+	return entry.source
+}
+
+// Points at exactly where a setting went wrong.
+type settingError struct {
+	entry   settingEntry
+	message string
+}
+
+func (e *settingError) Error() string {
+	if e.entry.key == "" {
+		return fmt.Sprintf("%s: %s", e.entry.location(), e.message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.entry.location(), e.entry.key, e.message)
+}
+
+func (entry settingEntry) errorf(format string, a ...any) *settingError {
+	return &settingError{entry: entry, message: fmt.Sprintf(format, a...)}
+}
+
+var (
+	settingKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z0-9_-]+\.[A-Za-z][A-Za-z0-9]*)?$`)
+	remoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	releasePattern    = regexp.MustCompile(`^R\d{4}[ab]$`)
+)
+
+// Each recognized setting and how to apply it. Kept in the same order as the example settings.txt.
+var settingKeys = []struct {
+	name  string
+	apply func(s *settings, value string) error
+}{
+	{"downloadScriptsOnLaunch", func(s *settings, value string) (err error) {
+		s.DownloadScriptsOnLaunch, err = parseSettingBool(value)
+		return err
+	}},
+	{"downloadWorkers", func(s *settings, value string) error {
+		downloadWorkers, err := strconv.Atoi(value)
+		if err != nil || downloadWorkers < 1 || downloadWorkers > 16 {
+			return fmt.Errorf("\"%s\" must be a number of simultaneous downloads from 1 to 16", value)
+		}
+		s.DownloadWorkers = downloadWorkers
+		return nil
+	}},
+	{"offline", func(s *settings, value string) (err error) {
+		s.Offline, err = parseSettingBool(value)
+		return err
+	}},
+	{"clonePlugins", func(s *settings, value string) (err error) {
+		s.ClonePlugins, err = parseSettingBool(value)
+		return err
+	}},
+	{"scriptsPath", func(s *settings, value string) error {
+		if _, err := os.Stat(value); err != nil { // Do you actually exist? Does anything actually exist, man?
+			return fmt.Errorf("the custom scripts path \"%s\" does not exist", value)
+		}
+		s.ScriptsPath = value
+		return nil
+	}},
+	{"caBundle", func(s *settings, value string) error {
+		if _, err := os.Stat(value); err != nil {
+			return fmt.Errorf("the CA bundle \"%s\" does not exist", value)
+		}
+		s.CABundle = value
+		return nil
+	}},
+	{"cachePath", func(s *settings, value string) error {
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("the cache path \"%s\" must be an absolute path", value)
+		}
+		s.CachePath = value
+		return nil
+	}},
+	{"logPath", func(s *settings, value string) error {
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("the log path \"%s\" must be an absolute path", value)
+		}
+		s.LogPath = value
+		return nil
+	}},
+	{"verbose", func(s *settings, value string) (err error) {
+		s.Verbose, err = parseSettingBool(value)
+		return err
+	}},
+	{"wizard", func(s *settings, value string) (err error) {
+		s.Wizard, err = parseSettingBool(value)
+		return err
+	}},
+	{"probe", func(s *settings, value string) (err error) {
+		s.Probe, err = parseSettingBool(value)
+		return err
+	}},
+	{"sshCommand", func(s *settings, value string) error {
+		if len(strings.Fields(value)) == 0 {
+			return errors.New("sshCommand can't be empty")
+		}
+		s.SSHCommand = value
+		return nil
+	}},
+	{"accessToken", func(s *settings, value string) error {
+		s.AccessToken = secret(value)
+		registerSecret(s.AccessToken)
+		return nil
+	}},
+	{"accessTokenSource", func(s *settings, value string) error {
+		kind, argument, _ := strings.Cut(value, ":")
+		switch {
+		case kind == "git-credential" && argument == "":
+		case (kind == "env" || kind == "file" || kind == "exec") && argument != "":
+		default:
+			return fmt.Errorf("\"%s\" is not a secret source; use env:NAME, file:PATH, git-credential or exec:COMMAND", value)
+		}
+		s.AccessTokenSource = value
+		return nil
+	}},
+	{"gitEmailAddress", func(s *settings, value string) error {
+		if !strings.Contains(value, "@") {
+			return fmt.Errorf("\"%s\" is not an email address", value)
+		}
+		s.GitEmailAddress = value
+		return nil
+	}},
+	{"gitExistingRepoCommitMessage", func(s *settings, value string) error {
+		s.GitExistingRepoCommitMessage = value
+		return nil
+	}},
+	{"gitGroupID", func(s *settings, value string) error {
+		gitGroupID, err := strconv.Atoi(value)
+		if err != nil || gitGroupID < 1 {
+			return fmt.Errorf("\"%s\" is not a valid group ID; it must be a positive integer", value)
+		}
+		s.GitGroupID = gitGroupID
+		return nil
+	}},
+	{"gitGroupName", func(s *settings, value string) error {
+		s.GitGroupName = value
+		return nil
+	}},
+	{"gitRepoPath", func(s *settings, value string) error {
+		s.GitRepoPath = value
+		return nil
+	}},
+	{"gitRepoAPIURL", func(s *settings, value string) error {
+		if !strings.HasPrefix(value, "https://") && !strings.HasPrefix(value, "http://") {
+			return fmt.Errorf("\"%s\" must start with https:// or http://", value)
+		}
+		s.GitRepoAPIURL = normalizeGitRepoAPIURL(value)
+		return nil
+	}},
+	{"gitUsername", func(s *settings, value string) error {
+		s.GitUsername = value
+		return nil
+	}},
+	{"releaseNumber", func(s *settings, value string) error {
+		if !releasePattern.MatchString(value) {
+			return fmt.Errorf("\"%s\" is not a release number like R2024a", value)
+		}
+		s.ReleaseNumber = value
+		return nil
+	}},
+	{"team", func(s *settings, value string) error {
+		switch strings.ToLower(value) {
+		case "install", "parallel":
+			s.Team = strings.ToLower(value)
+			return nil
+		}
+		return fmt.Errorf("\"%s\" is not a team; use install or parallel", value)
+	}},
+	{"submitToRemoteRepo", func(s *settings, value string) (err error) {
+		s.SubmitToRemoteRepo, err = parseSettingBool(value)
+		return err
+	}},
+	{"remote", func(s *settings, value string) error {
+		if !remoteNamePattern.MatchString(value) {
+			return fmt.Errorf("\"%s\" is not a valid remote profile name", value)
+		}
+		s.Remote = value
+		return nil
+	}},
+}
+
+// The settings a remote profile can override. Anything a profile leaves out falls back to the top-level setting.
+var remoteSettingNames = []string{
+	"accessToken",
+	"accessTokenSource",
+	"gitEmailAddress",
+	"gitGroupID",
+	"gitGroupName",
+	"gitRepoAPIURL",
+	"gitUsername",
+}
+
+// Splits "remote.<name>.<setting>" into its parts.
+func parseRemoteKey(key string) (remoteName, settingName string, ok bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 || parts[0] != "remote" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func parseSettingBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("\"%s\" must be true or false", value)
+}
+
+// We want the URL to end with "projects/" for later Git repo usage.
+func normalizeGitRepoAPIURL(gitRepoAPIURL string) string {
+	if strings.HasSuffix(gitRepoAPIURL, "projects") {
+		gitRepoAPIURL += "/"
+	} else if strings.HasSuffix(gitRepoAPIURL, "projects/") {
+		// Do nothing.
+	} else if strings.HasSuffix(gitRepoAPIURL, "/") {
+		gitRepoAPIURL = gitRepoAPIURL[:len(gitRepoAPIURL)-1]
+		gitRepoAPIURL += "/projects/"
+	} else {
+		gitRepoAPIURL += "/projects/"
+	}
+	return gitRepoAPIURL
+}
+
+// The rest of GitLab's API is next to projects/, such as https://gitlab.example.com/api/v4/.
+func gitLabAPIBaseURL(gitRepoAPIURL string) string {
+	return strings.TrimSuffix(gitRepoAPIURL, "projects/")
+}
+
+// The URL of a project in your group to clone and push to, such as https://gitlab.example.com/group/project.git. It's
+// wherever the API is, less the API's path, so GitLab can be on any host and under a path of its own.
+func gitLabProjectURL(gitRepoAPIURL, groupName, projectName string) (string, error) {
+	apiURL, err := url.Parse(gitRepoAPIURL)
+	if err != nil {
+		return "", fmt.Errorf("gitRepoAPIURL isn't a valid URL: %w", err)
+	}
+	if apiURL.Scheme == "" || apiURL.Host == "" {
+		return "", fmt.Errorf("gitRepoAPIURL (%s) needs a scheme and host, such as https://gitlab.example.com/api/v4", gitRepoAPIURL)
+	}
+
+	webPath := apiURL.Path
+	if index := strings.Index(webPath, "/api/v"); index != -1 {
+		webPath = webPath[:index]
+	}
+	projectURL := url.URL{Scheme: apiURL.Scheme, Host: apiURL.Host, Path: strings.TrimSuffix(webPath, "/") + "/" + groupName + "/" + projectName + ".git"}
+	return projectURL.String(), nil
+}
+
+// Splits a settings file into its entries. Blank lines and lines starting with # are skipped. Everything else must be
+// "key = value", where the value may be wrapped in double quotes. Grammar errors are collected rather than stopping at
+// the first one.
+func readSettingsFile(settingsPath, layer string) ([]settingEntry, []error) {
+	file, err := os.Open(settingsPath)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer file.Close()
+
+	var entries []settingEntry
+	var errs []error
+	seen := map[string]int{}
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := settingEntry{layer: layer, source: settingsPath, line: lineNumber}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			errs = append(errs, entry.errorf("expected \"key = value\" but found \"%s\"", line))
+			continue
+		}
+
+		entry.key = strings.TrimSpace(key)
+		if !settingKeyPattern.MatchString(entry.key) {
+			errs = append(errs, entry.errorf("invalid setting name"))
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "\"") || strings.HasSuffix(value, "\"") {
+			if len(value) < 2 || !strings.HasPrefix(value, "\"") || !strings.HasSuffix(value, "\"") {
+				errs = append(errs, entry.errorf("unterminated quoted value %s", value))
+				continue
+			}
+			value = value[1 : len(value)-1]
+		}
+		entry.value = value
+
+		if previousLine, ok := seen[entry.key]; ok {
+			errs = append(errs, entry.errorf("already set on line %d", previousLine))
+			continue
+		}
+		seen[entry.key] = lineNumber
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", settingsPath, err))
+	}
+
+	return entries, errs
+}
+
+// Applies entries in order, so later layers override earlier ones. Unknown keys get a "did you mean" hint. Returns the
+// entry each setting's value ended up coming from.
+func (s *settings) applyEntries(entries []settingEntry) (map[string]settingEntry, []error) {
+	var errs []error
+	origins := map[string]settingEntry{}
+
+	for _, entry := range entries {
+		if _, settingName, ok := parseRemoteKey(entry.key); ok {
+			if !slices.Contains(remoteSettingNames, settingName) {
+				message := fmt.Sprintf("\"%s\" can't be set in a remote profile", settingName)
+				if suggestion := suggestName(settingName, remoteSettingNames); suggestion != "" {
+					message += fmt.Sprintf("; did you mean \"%s\"?", suggestion)
+				}
+				errs = append(errs, entry.errorf("%s", message))
+				continue
+			}
+		} else if !isSettingKey(entry.key) {
+			message := "unknown setting"
+
+			// Unknown environment variables are suggested as environment variables.
+			if entry.layer == "environment" {
+				if suggestion := suggestSettingKey(strings.ReplaceAll(strings.TrimPrefix(entry.key, "ISP_"), "_", "")); suggestion != "" {
+					message += fmt.Sprintf("; did you mean \"%s\"?", settingEnvName(suggestion))
+				}
+				entry.key = ""
+			} else if suggestion := suggestSettingKey(entry.key); suggestion != "" {
+				message += fmt.Sprintf("; did you mean \"%s\"?", suggestion)
+			}
+			errs = append(errs, entry.errorf("%s", message))
+			continue
+		}
+		origins[entry.key] = entry
+	}
+
+	for _, settingKey := range settingKeys {
+		entry, ok := origins[settingKey.name]
+		if !ok {
+			continue
+		}
+		if err := settingKey.apply(s, entry.value); err != nil {
+			errs = append(errs, entry.errorf("%s", err))
+		}
+	}
+
+	// Remote profiles are applied onto their own settings, using the same rules as the top-level ones.
+	for _, key := range sortedKeys(origins) {
+		remoteName, settingName, ok := parseRemoteKey(key)
+		if !ok {
+			continue
+		}
+		entry := origins[key]
+
+		if !remoteNamePattern.MatchString(remoteName) {
+			errs = append(errs, entry.errorf("\"%s\" is not a valid remote profile name", remoteName))
+			continue
+		}
+		if s.Remotes == nil {
+			s.Remotes = map[string]*settings{}
+		}
+		if s.Remotes[remoteName] == nil {
+			s.Remotes[remoteName] = &settings{}
+		}
+
+		for _, settingKey := range settingKeys {
+			if settingKey.name == settingName {
+				if err := settingKey.apply(s.Remotes[remoteName], entry.value); err != nil {
+					errs = append(errs, entry.errorf("%s", err))
+				}
+			}
+		}
+	}
+
+	return origins, errs
+}
+
+func isSettingKey(key string) bool {
+	for _, settingKey := range settingKeys {
+		if settingKey.name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that need more than one setting to make sense.
+func (s *settings) validate(origins map[string]settingEntry) []error {
+	var errs []error
+
+	if entry, ok := origins["accessTokenSource"]; ok && s.AccessToken != "" {
+		errs = append(errs, entry.errorf("accessToken is also set; only set one of the two"))
+	}
+
+	for remoteName, remote := range s.Remotes {
+		if entry, ok := origins["remote."+remoteName+".accessTokenSource"]; ok && remote.AccessToken != "" {
+			errs = append(errs, entry.errorf("remote.%s.accessToken is also set; only set one of the two", remoteName))
+		}
+	}
+
+	if entry, ok := origins["remote"]; ok {
+		if _, err := s.withRemote(s.Remote); err != nil {
+			errs = append(errs, entry.errorf("%s", err))
+		}
+	}
+
+	return errs
+}
+
+// Finds the known setting closest to a mistyped one, if any is close enough.
+func suggestSettingKey(key string) string {
+	var names []string
+	for _, settingKey := range settingKeys {
+		names = append(names, settingKey.name)
+	}
+	return suggestName(key, names)
+}
+
+// Finds the candidate closest to name, ignoring case, if any is close enough to be a likely typo.
+func suggestName(name string, candidates []string) string {
+	bestMatch := ""
+	bestDistance := len(name)/3 + 2
+
+	for _, candidate := range candidates {
+		distance := levenshteinDistance(strings.ToLower(name), strings.ToLower(candidate))
+
+		// Starting the same way counts as close, such as "kuber" for kubernetes.
+		if len(name) >= 3 && strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(name)) {
+			distance = min(distance, 1)
+		}
+		if distance < bestDistance {
+			bestMatch = candidate
+			bestDistance = distance
+		}
+	}
+	return bestMatch
+}
+
+// Returns the settings to use with the named remote profile: the profile's settings where it has them and the
+// top-level settings everywhere else. An empty name means the top-level settings alone.
+func (s *settings) withRemote(remoteName string) (settings, error) {
+	effective := *s
+	if remoteName == "" {
+		return effective, nil
+	}
+
+	remote, ok := s.Remotes[remoteName]
+	if !ok {
+		var remoteNames []string
+		for name := range s.Remotes {
+			remoteNames = append(remoteNames, name)
+		}
+		message := fmt.Sprintf("there is no remote profile named \"%s\"", remoteName)
+		if suggestion := suggestName(remoteName, remoteNames); suggestion != "" {
+			message += fmt.Sprintf("; did you mean \"%s\"?", suggestion)
+		}
+		return effective, errors.New(message)
+	}
+
+	effective.Remote = remoteName
+	if remote.AccessToken != "" || remote.AccessTokenSource != "" {
+		effective.AccessToken = remote.AccessToken
+		effective.AccessTokenSource = remote.AccessTokenSource
+	}
+	if remote.GitEmailAddress != "" {
+		effective.GitEmailAddress = remote.GitEmailAddress
+	}
+	if remote.GitGroupID != 0 {
+		effective.GitGroupID = remote.GitGroupID
+	}
+	if remote.GitGroupName != "" {
+		effective.GitGroupName = remote.GitGroupName
+	}
+	if remote.GitRepoAPIURL != "" {
+		effective.GitRepoAPIURL = remote.GitRepoAPIURL
+	}
+	if remote.GitUsername != "" {
+		effective.GitUsername = remote.GitUsername
+	}
+	return effective, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func levenshteinDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// The name of the environment variable for a setting, e.g. gitGroupID becomes ISP_GIT_GROUP_ID.
+func settingEnvName(key string) string {
+	var sb strings.Builder
+	sb.WriteString("ISP_")
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := rune(key[i-1])
+			nextIsLower := i+1 < len(key) && unicode.IsLower(rune(key[i+1]))
+			if unicode.IsLower(previous) || nextIsLower {
+				sb.WriteString("_")
+			}
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// Settings given through ISP_* environment variables. Underscores and case don't matter when matching names, so
+// ISP_GIT_REPO_API_URL and ISP_GITREPOAPIURL both set gitRepoAPIURL.
+func settingsFromEnvironment() []settingEntry {
+	var entries []settingEntry
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, "ISP_") {
+			continue
+		}
+
+		// Unknown variables keep their own name so they're reported as unknown settings.
+		key := name
+		normalizedName := strings.ReplaceAll(strings.TrimPrefix(name, "ISP_"), "_", "")
+		for _, settingKey := range settingKeys {
+			if strings.EqualFold(settingKey.name, normalizedName) {
+				key = settingKey.name
+				break
+			}
+		}
+		entries = append(entries, settingEntry{key: key, value: value, layer: "environment", source: name})
+	}
+	return entries
+}
+
+// Defines a flag for every setting so that any of them can be overridden for a single run. Secrets are left out, since
+// flags end up in ps and your shell history; use accessTokenSource instead.
+func settingFlags(flags *flag.FlagSet) map[string]*string {
+	values := map[string]*string{}
+	fields := reflect.ValueOf(settings{})
+	for _, settingKey := range settingKeys {
+		field := settingField(fields, settingKey.name)
+		if field.Type() == reflect.TypeOf(secret("")) {
+			continue
+		}
+		value := &settingFlag{isBool: field.Kind() == reflect.Bool}
+		flags.Var(value, settingKey.name, "Overrides the "+settingKey.name+" setting.")
+		values[settingKey.name] = &value.value
+	}
+	return values
+}
+
+// A flag for a setting. True/false settings can be given without a value, like -offline.
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// The settings struct field for a setting, such as CABundle for caBundle.
+func settingField(values reflect.Value, name string) reflect.Value {
+	return values.FieldByNameFunc(func(fieldName string) bool { return strings.EqualFold(fieldName, name) })
+}
+
+// Settings given as flags. Only flags that were actually passed count.
+func settingsFromFlags(flags *flag.FlagSet, values map[string]*string) []settingEntry {
+	var entries []settingEntry
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok {
+			entries = append(entries, settingEntry{key: f.Name, value: *value, layer: "flag", source: "-" + f.Name})
+		}
+	})
+	return entries
+}
+
+// A config file and the layer it belongs to.
+type configFile struct {
+	layer string
+	path  string
+}
+
+// Where we look for a config file, lowest precedence first: the user's config directory, then the current directory.
+// Running from your config directory only gives you the one.
+func configFilePaths(fileName string) []configFile {
+	var files []configFile
+	if configDir, err := os.UserConfigDir(); err == nil {
+		files = append(files, configFile{"user config", filepath.Join(configDir, "integration-scripts-profiler", fileName)})
+	}
+	if currentDir, err := os.Getwd(); err == nil {
+		projectPath := filepath.Join(currentDir, fileName)
+		if len(files) == 0 || files[0].path != projectPath {
+			files = append(files, configFile{"project", projectPath})
+		}
+	}
+	return files
+}
+
+// Builds the effective settings from every layer on top of the defaults already in s. Missing settings files are
+// skipped. All problems across all layers are returned together. The returned map says where each setting came from;
+// anything not in it is still the default.
+func loadLayeredSettings(s *settings, flagEntries []settingEntry) (map[string]settingEntry, error) {
+	var entries []settingEntry
+	var errs []error
+
+	for _, file := range configFilePaths("settings.txt") {
+		if _, err := os.Stat(file.path); os.IsNotExist(err) {
+			continue
+		}
+
+		fileEntries, fileErrs := readSettingsFile(file.path, file.layer)
+		entries = append(entries, fileEntries...)
+		errs = append(errs, fileErrs...)
+	}
+
+	entries = append(entries, settingsFromEnvironment()...)
+	entries = append(entries, flagEntries...)
+
+	origins, applyErrs := s.applyEntries(entries)
+	errs = append(errs, applyErrs...)
+	if len(errs) == 0 {
+		errs = append(errs, s.validate(origins)...)
+	}
+
+	sortSettingErrors(errs)
+	return origins, errors.Join(errs...)
+}
+
+// Puts problems in the order they'd be read. There's one file per layer, so that's by layer and then line. Anything
+// that isn't about a setting goes last.
+func sortSettingErrors(errs []error) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		layerI, lineI := settingErrorRank(errs[i])
+		layerJ, lineJ := settingErrorRank(errs[j])
+		if layerI != layerJ {
+			return layerI < layerJ
+		}
+		return lineI < lineJ
+	})
+}
+
+// Where err's setting was read, as the index of its layer and its line.
+func settingErrorRank(err error) (layer, line int) {
+	var settingErr *settingError
+	if !errors.As(err, &settingErr) {
+		return len(settingLayers), 0
+	}
+	return slices.Index(settingLayers, settingErr.entry.layer), settingErr.entry.line
+}
+
+// Prints every setting's effective value and which layer it came from.
+func showSettings(w io.Writer, s *settings, origins map[string]settingEntry) {
+	values := reflect.ValueOf(s).Elem()
+
+	for _, settingKey := range settingKeys {
+		value := settingField(values, settingKey.name)
+
+		origin := "default"
+		if entry, ok := origins[settingKey.name]; ok {
+			origin = entry.layer + ": " + entry.location()
+		}
+		fmt.Fprintf(w, "%-30s = %-40v (%s)\n", settingKey.name, value.Interface(), origin)
+	}
+
+	for _, key := range sortedKeys(origins) {
+		if _, _, ok := parseRemoteKey(key); !ok {
+			continue
+		}
+
+		entry := origins[key]
+		var value any = entry.value
+		if strings.HasSuffix(key, ".accessToken") {
+			value = secret(entry.value)
+		}
+		fmt.Fprintf(w, "%-30s = %-40v (%s)\n", key, value, entry.layer+": "+entry.location())
+	}
+}
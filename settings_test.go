@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitLabProjectURL(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		want   string
+	}{
+		{"https://gitlab.com/api/v4/projects/", "https://gitlab.com/team/Acme-Labs.git"},
+		{"https://git.example.org/api/v4/projects/", "https://git.example.org/team/Acme-Labs.git"},
+		{"https://git.example.co.uk:8443/api/v4/projects/", "https://git.example.co.uk:8443/team/Acme-Labs.git"},
+		{"https://example.edu/gitlab/api/v4/projects/", "https://example.edu/gitlab/team/Acme-Labs.git"},
+		{"http://10.0.0.5/api/v4/projects/", "http://10.0.0.5/team/Acme-Labs.git"},
+	}
+	for _, test := range tests {
+		got, err := gitLabProjectURL(test.apiURL, "team", "Acme-Labs")
+		if err != nil || got != test.want {
+			t.Errorf("gitLabProjectURL(%q) = %q, %v; want %q", test.apiURL, got, err, test.want)
+		}
+	}
+
+	if _, err := gitLabProjectURL("gitlab.example.com/api/v4/projects/", "team", "Acme-Labs"); err == nil {
+		t.Error("gitLabProjectURL accepted a URL without a scheme")
+	}
+}
+
+func TestGitLabAPIBaseURL(t *testing.T) {
+	if got := gitLabAPIBaseURL("https://git.example.org/api/v4/projects/"); got != "https://git.example.org/api/v4/" {
+		t.Errorf("gitLabAPIBaseURL = %q", got)
+	}
+}
+
+// Writes content to a settings file in a new temporary folder and returns its path.
+func writeSettingsFile(t *testing.T, dir, content string) string {
+	t.Helper()
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	settingsPath := filepath.Join(dir, "settings.txt")
+	if err := os.WriteFile(settingsPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return settingsPath
+}
+
+func TestReadSettingsFileErrors(t *testing.T) {
+	settingsPath := writeSettingsFile(t, "", `# A comment
+releaseNumber = R2024a
+
+not a setting
+9lives = true
+gitUsername = "unterminated
+team = parallel
+team = install
+gitEmailAddress = "you@example.com"
+`)
+
+	entries, errs := readSettingsFile(settingsPath, "project")
+	want := []string{
+		settingsPath + `:4: expected "key = value" but found "not a setting"`,
+		settingsPath + ":5: 9lives: invalid setting name",
+		settingsPath + `:6: gitUsername: unterminated quoted value "unterminated`,
+		settingsPath + ":8: team: already set on line 7",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err, want[i])
+		}
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.key+"="+entry.value)
+	}
+	if got := strings.Join(keys, " "); got != "releaseNumber=R2024a team=parallel gitEmailAddress=you@example.com" {
+		t.Errorf("entries = %s", got)
+	}
+}
+
+func TestApplyEntriesSuggestsKeys(t *testing.T) {
+	tests := []struct {
+		entry settingEntry
+		want  string
+	}{
+		{settingEntry{key: "relaseNumber", value: "R2024a", layer: "project", source: "settings.txt", line: 3},
+			`settings.txt:3: relaseNumber: unknown setting; did you mean "releaseNumber"?`},
+		{settingEntry{key: "GITUSERNAME", value: "you", layer: "flag", source: "-GITUSERNAME"},
+			`-GITUSERNAME: GITUSERNAME: unknown setting; did you mean "gitUsername"?`},
+		{settingEntry{key: "ISP_RELASE_NUMBER", value: "R2024a", layer: "environment", source: "ISP_RELASE_NUMBER"},
+			`ISP_RELASE_NUMBER: unknown setting; did you mean "ISP_RELEASE_NUMBER"?`},
+		{settingEntry{key: "somethingElseEntirely", value: "x", layer: "project", source: "settings.txt", line: 1},
+			`settings.txt:1: somethingElseEntirely: unknown setting`},
+		{settingEntry{key: "remote.work.relaseNumber", value: "R2024a", layer: "project", source: "settings.txt", line: 2},
+			`settings.txt:2: remote.work.relaseNumber: "relaseNumber" can't be set in a remote profile`},
+		{settingEntry{key: "downloadWorkers", value: "lots", layer: "project", source: "settings.txt", line: 4},
+			`settings.txt:4: downloadWorkers: `},
+	}
+	for _, test := range tests {
+		_, errs := (&settings{}).applyEntries([]settingEntry{test.entry})
+		if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), test.want) {
+			t.Errorf("applyEntries(%s) = %v, want %q", test.entry.key, errs, test.want)
+		}
+	}
+}
+
+func TestLoadLayeredSettingsPrecedence(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	writeSettingsFile(t, filepath.Join(configDir, "integration-scripts-profiler"), `gitUsername = from-user-config
+gitEmailAddress = user@example.com
+releaseNumber = R2023a
+downloadWorkers = 2
+`)
+
+	projectDir := t.TempDir()
+	writeSettingsFile(t, projectDir, `gitEmailAddress = project@example.com
+releaseNumber = R2023b
+downloadWorkers = 3
+`)
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDir) })
+
+	t.Setenv("ISP_RELEASE_NUMBER", "R2024a")
+	t.Setenv("ISP_DOWNLOAD_WORKERS", "5")
+	flags := []settingEntry{{key: "downloadWorkers", value: "8", layer: "flag", source: "-downloadWorkers"}}
+
+	s := settings{Team: "parallel", DownloadWorkers: 4}
+	origins, err := loadLayeredSettings(&s, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting string
+		got     any
+		want    any
+		layer   string
+	}{
+		{"team", s.Team, "parallel", ""},
+		{"gitUsername", s.GitUsername, "from-user-config", "user config"},
+		{"gitEmailAddress", s.GitEmailAddress, "project@example.com", "project"},
+		{"releaseNumber", s.ReleaseNumber, "R2024a", "environment"},
+		{"downloadWorkers", s.DownloadWorkers, 8, "flag"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.setting, test.got, test.want)
+		}
+		if origins[test.setting].layer != test.layer {
+			t.Errorf("%s came from %q, want %q", test.setting, origins[test.setting].layer, test.layer)
+		}
+	}
+
+	// Errors from every layer are reported together, in the order they're read.
+	writeSettingsFile(t, projectDir, "relaseNumber = R2024a\n")
+	t.Setenv("ISP_DOWNLOAD_WORKERS", "many")
+	_, err = loadLayeredSettings(&settings{}, nil)
+	if err == nil {
+		t.Fatal("loadLayeredSettings accepted bad settings")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "settings.txt:1: relaseNumber") || !strings.HasPrefix(lines[1], "ISP_DOWNLOAD_WORKERS: downloadWorkers") {
+		t.Errorf("errors = %q", err)
+	}
+}
+
+func TestShowSettings(t *testing.T) {
+	s := settings{ReleaseNumber: "R2024a", AccessToken: "glpat-secret", Remotes: map[string]*settings{"work": {AccessToken: "glpat-work"}}}
+	origins := map[string]settingEntry{
+		"releaseNumber":           {key: "releaseNumber", value: "R2024a", layer: "project", source: "/work/settings.txt", line: 7},
+		"accessToken":             {key: "accessToken", value: "glpat-secret", layer: "environment", source: "ISP_ACCESS_TOKEN"},
+		"remote.work.accessToken": {key: "remote.work.accessToken", value: "glpat-work", layer: "user config", source: "/home/you/settings.txt", line: 2},
+	}
+
+	var output bytes.Buffer
+	showSettings(&output, &s, origins)
+
+	lines := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		lines[strings.Fields(line)[0]] = strings.Join(strings.Fields(line), " ")
+	}
+	want := map[string]string{
+		"releaseNumber":           "releaseNumber = R2024a (project: /work/settings.txt:7)",
+		"accessToken":             "accessToken = [redacted] (environment: ISP_ACCESS_TOKEN)",
+		"remote.work.accessToken": "remote.work.accessToken = [redacted] (user config: /home/you/settings.txt:2)",
+		"team":                    "team = (default)",
+	}
+	for key, line := range want {
+		if lines[key] != line {
+			t.Errorf("%s line = %q, want %q", key, lines[key], line)
+		}
+	}
+	if len(lines) != len(settingKeys)+1 {
+		t.Errorf("got %d lines, want one per setting plus the remote's token", len(lines))
+	}
+	if strings.Contains(output.String(), "glpat") {
+		t.Error("showSettings printed a token")
+	}
+}
+
+func TestSettingFlagsLeaveOutSecrets(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	values := settingFlags(flags)
+
+	if flags.Lookup("accessToken") != nil || values["accessToken"] != nil {
+		t.Error("accessToken has a flag")
+	}
+	if err := flags.Parse([]string{"-accessToken", "glpat-secret"}); err == nil {
+		t.Error("-accessToken was accepted")
+	}
+	if err := flags.Parse([]string{"-accessTokenSource", "env:TOKEN", "-offline"}); err != nil {
+		t.Fatal(err)
+	}
+	if *values["accessTokenSource"] != "env:TOKEN" || *values["offline"] != "true" {
+		t.Errorf("accessTokenSource = %q, offline = %q", *values["accessTokenSource"], *values["offline"])
+	}
+}
+
+func TestSuggestName(t *testing.T) {
+	candidates := []string{"releaseNumber", "gitUsername", "gitEmailAddress", "kubernetes"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"relaseNumber", "releaseNumber"},
+		{"RELEASENUMBER", "releaseNumber"},
+		{"gitusrname", "gitUsername"},
+		{"release", "releaseNumber"},
+		{"kuber", "kubernetes"},
+		{"ku", ""},
+		{"somethingElseEntirely", ""},
+	}
+	for _, test := range tests {
+		if got := suggestName(test.name, candidates); got != test.want {
+			t.Errorf("suggestName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSortSettingErrors(t *testing.T) {
+	projectLine9 := settingEntry{key: "team", layer: "project", source: "settings.txt", line: 9}.errorf("bad")
+	projectLine2 := settingEntry{key: "gitGroupID", layer: "project", source: "settings.txt", line: 2}.errorf("bad")
+	userLine5 := settingEntry{key: "releaseNumber", layer: "user config", source: "/home/settings.txt", line: 5}.errorf("bad")
+	environmentB := settingEntry{key: "team", layer: "environment", source: "ISP_TEAM"}.errorf("bad")
+	environmentA := settingEntry{key: "gitGroupID", layer: "environment", source: "ISP_GIT_GROUP_ID"}.errorf("bad")
+	flagError := settingEntry{key: "releaseNumber", layer: "flag", source: "-releaseNumber"}.errorf("bad")
+	other := errors.New("gitGroupName must be set when submitToRemoteRepo is")
+
+	errs := []error{other, flagError, environmentB, projectLine9, userLine5, environmentA, projectLine2}
+	sortSettingErrors(errs)
+
+	// The environment's stay in the order they were read.
+	want := []error{userLine5, projectLine2, projectLine9, environmentB, environmentA, flagError, other}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("errs[%d] = %v, want %v", i, errs[i], want[i])
+		}
+	}
+}
+
+func TestScriptsPathWithoutEveryPlugin(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	workingDir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(workingDir) })
+
+	// Only Slurm's plugin is there. Which ones are needed isn't known until the clusters are, so doctor checks then.
+	scriptsPath := t.TempDir()
+	os.Mkdir(filepath.Join(scriptsPath, "matlab-parallel-slurm-plugin-main"), 0755)
+	flags := []settingEntry{
+		{key: "scriptsPath", value: scriptsPath, layer: "flag", source: "-scriptsPath"},
+		{key: "downloadScriptsOnLaunch", value: "false", layer: "flag", source: "-downloadScriptsOnLaunch"},
+	}
+	if _, err := loadLayeredSettings(&settings{}, flags); err != nil {
+		t.Errorf("loadLayeredSettings = %v", err)
+	}
+}
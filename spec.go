@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// An engagement spec holds the answers to the prompts so a run can be scripted. Anything left out is prompted for.
+type engagementSpec struct {
+	Organization string        `json:"organization,omitempty" yaml:"organization,omitempty"`
+	Abbreviation *string       `json:"abbreviation,omitempty" yaml:"abbreviation,omitempty"`
+	Contact      string        `json:"contact,omitempty" yaml:"contact,omitempty"`
+	Remote       string        `json:"remote,omitempty" yaml:"remote,omitempty"`
+	CaseNumber   *int          `json:"caseNumber,omitempty" yaml:"caseNumber,omitempty"`
+	Clusters     []clusterSpec `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+
+	// Where answers that didn't come from the spec came from, by the field names resolveAnswer is given, such as
+	// "cluster #1's workers". Used so errors point at the right flag.
+	sources map[string]string
+
+	// Applied to every cluster that doesn't have its own answer, including ones prompted for.
+	clusterDefaults clusterSpec
+}
+
+// The answers for a single cluster. Pointers are used where the zero value is also a valid answer.
+type clusterSpec struct {
+	Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+	Scheduler      string `json:"scheduler,omitempty" yaml:"scheduler,omitempty"`
+	CustomMPI      *bool  `json:"customMPI,omitempty" yaml:"customMPI,omitempty"`
+	SubmissionType string `json:"submissionType,omitempty" yaml:"submissionType,omitempty"`
+	RemoteConfigs  *bool  `json:"remoteConfigs,omitempty" yaml:"remoteConfigs,omitempty"`
+	Workers        int    `json:"workers,omitempty" yaml:"workers,omitempty"`
+	MatlabRoot     string `json:"matlabRoot,omitempty" yaml:"matlabRoot,omitempty"`
+	Hostname       string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+
+	// What -probe found, when it was used.
+	Probe *probeResult `json:"probe,omitempty" yaml:"probe,omitempty"`
+}
+
+// Replaces the cluster's answers with any that given has.
+func (cluster *clusterSpec) override(given clusterSpec) {
+	if given.Scheduler != "" {
+		cluster.Scheduler = given.Scheduler
+	}
+	if given.CustomMPI != nil {
+		cluster.CustomMPI = given.CustomMPI
+	}
+	if given.SubmissionType != "" {
+		cluster.SubmissionType = given.SubmissionType
+	}
+	if given.RemoteConfigs != nil {
+		cluster.RemoteConfigs = given.RemoteConfigs
+	}
+	if given.Workers != 0 {
+		cluster.Workers = given.Workers
+	}
+	if given.MatlabRoot != "" {
+		cluster.MatlabRoot = given.MatlabRoot
+	}
+	if given.Hostname != "" {
+		cluster.Hostname = given.Hostname
+	}
+}
+
+// Reads an engagement spec. Files ending in .json are read as JSON, anything else as YAML. Unknown fields are rejected
+// so that a typo doesn't quietly turn into a prompt.
+func loadEngagementSpec(specPath string) (*engagementSpec, error) {
+	content, err := os.ReadFile(specPath)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &engagementSpec{}
+	if strings.EqualFold(filepath.Ext(specPath), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(spec); err != nil {
+			if line := jsonErrorLine(content, err); line > 0 {
+				return nil, fmt.Errorf("%s: line %d: %w", specPath, line, err)
+			}
+			return nil, fmt.Errorf("%s: %w", specPath, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(spec); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", specPath, err)
+		}
+	}
+
+	return spec, nil
+}
+
+// The line a JSON error is on, like YAML's errors give, or 0 if it doesn't say where it is.
+func jsonErrorLine(content []byte, err error) int {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return 0
+	}
+	return bytes.Count(content[:min(offset, int64(len(content)))], []byte("\n")) + 1
+}
+
+// Each contact's folder gets one of these, recording what was generated for it. add-cluster and update read it back,
+// and it can be passed to -spec to build the same engagement somewhere else.
+const engagementRecordName = "engagement.yaml"
+
+// Returns the contact folder's engagement record, or nil if there isn't one, such as for engagements made before
+// records were written.
+func readEngagementRecord(contactPath string) (*engagementSpec, error) {
+	recordPath := filepath.Join(contactPath, engagementRecordName)
+	if _, err := os.Stat(recordPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return loadEngagementSpec(recordPath)
+}
+
+func writeEngagementRecord(contactPath string, record *engagementSpec) error {
+	var content bytes.Buffer
+	content.WriteString("# Written by integration-scripts-profiler. add-cluster and update keep this up to date.\n")
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(record); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(contactPath, engagementRecordName), content.Bytes(), 0644)
+}
+
+// Adds clusters to the record, replacing any with the same name.
+func (record *engagementSpec) mergeClusters(clusters []clusterSpec) {
+	for _, cluster := range clusters {
+		index := slices.IndexFunc(record.Clusters, func(existing clusterSpec) bool { return strings.EqualFold(existing.Name, cluster.Name) })
+		if index == -1 {
+			record.Clusters = append(record.Clusters, cluster)
+		} else {
+			record.Clusters[index] = cluster
+		}
+	}
+}
+
+// The prompts' answers as flags. Any given override the engagement spec's, and they're checked by the same rules.
+type answerFlags struct {
+	organization   *string
+	abbreviation   *string
+	contact        *string
+	caseNumber     *string
+	clusters       []string
+	customMPI      *bool
+	submissionType *string
+	remoteConfigs  *bool
+}
+
+// The keys -cluster accepts, and the clusterSpec field each sets.
+var clusterFlagKeys = map[string]string{
+	"name":           "name",
+	"scheduler":      "scheduler",
+	"workers":        "workers",
+	"host":           "hostname",
+	"hostname":       "hostname",
+	"matlab-root":    "matlabRoot",
+	"mpi":            "customMPI",
+	"submission":     "submissionType",
+	"remote-configs": "remoteConfigs",
+}
+
+func registerAnswerFlags(flags *flag.FlagSet) *answerFlags {
+	answers := &answerFlags{
+		organization:   flags.String("org", "", "The organization's name."),
+		abbreviation:   flags.String("abbreviation", "", "The organization's abbreviation, for a new GitLab project."),
+		contact:        flags.String("contact", "", "The organization's contact name."),
+		caseNumber:     flags.String("case", "", "The Salesforce Case Number. Use 0 to skip it."),
+		customMPI:      flags.Bool("mpi", false, "Include the custom MPI file in every cluster that doesn't say otherwise."),
+		submissionType: flags.String("submission", "", "desktop, cluster or both, for every cluster that doesn't say otherwise."),
+		remoteConfigs:  flags.Bool("remote-configs", false, "Include the remote submission configuration files in every cluster that doesn't say otherwise."),
+	}
+	flags.Func("cluster", "A cluster, as comma-separated key=value pairs: name, scheduler, workers, host, matlab-root, mpi, submission and remote-configs. Repeat it for each cluster. Replaces the spec's clusters.", func(value string) error {
+		answers.clusters = append(answers.clusters, value)
+		return nil
+	})
+	return answers
+}
+
+// Puts the answers given as flags into spec.
+func (answers *answerFlags) apply(flags *flag.FlagSet, spec *engagementSpec) error {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if spec.sources == nil {
+		spec.sources = map[string]string{}
+	}
+
+	if given["org"] {
+		spec.Organization = *answers.organization
+		spec.sources["organization"] = "-org"
+	}
+	if given["abbreviation"] {
+		spec.Abbreviation = answers.abbreviation
+		spec.sources["abbreviation"] = "-abbreviation"
+	}
+	if given["contact"] {
+		spec.Contact = *answers.contact
+		spec.sources["contact"] = "-contact"
+	}
+	if given["case"] {
+		caseNumber := 0
+		if strings.TrimSpace(*answers.caseNumber) != "0" {
+			var err error
+			if caseNumber, err = parseCaseNumber(*answers.caseNumber); err != nil {
+				return fmt.Errorf("-case is invalid: %w", err)
+			}
+		}
+		spec.CaseNumber = &caseNumber
+		spec.sources["caseNumber"] = "-case"
+	}
+
+	if given["mpi"] {
+		spec.clusterDefaults.CustomMPI = answers.customMPI
+	}
+	if given["submission"] {
+		spec.clusterDefaults.SubmissionType = *answers.submissionType
+	}
+	if given["remote-configs"] {
+		spec.clusterDefaults.RemoteConfigs = answers.remoteConfigs
+	}
+
+	if len(answers.clusters) > 0 {
+		spec.Clusters = nil
+		for i, value := range answers.clusters {
+			cluster, err := parseClusterFlag(value, i+1, spec.sources)
+			if err != nil {
+				return fmt.Errorf("-cluster #%d is invalid: %w", i+1, err)
+			}
+			spec.Clusters = append(spec.Clusters, cluster)
+		}
+	}
+	return nil
+}
+
+// Reads a -cluster value such as "name=Hopper,scheduler=slurm,workers=256", recording in sources which of the
+// cluster's answers it gave.
+func parseClusterFlag(value string, clusterNumber int, sources map[string]string) (clusterSpec, error) {
+	var cluster clusterSpec
+	given := map[string]string{} // The key each field was given by.
+	for _, pair := range strings.Split(value, ",") {
+		key, fieldValue, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		field, known := clusterFlagKeys[key]
+		if !found || !known {
+			keys := sortedKeys(clusterFlagKeys)
+			if suggestion := suggestName(key, keys); suggestion != "" {
+				return cluster, fmt.Errorf("\"%s\" isn't a key=value pair it understands. Did you mean %s?", pair, suggestion)
+			}
+			return cluster, fmt.Errorf("\"%s\" isn't a key=value pair it understands. Use %s.", pair, strings.Join(keys, ", "))
+		}
+		if previousKey, ok := given[field]; ok {
+			return cluster, fmt.Errorf("%s is given twice, as %s and %s.", field, previousKey, key)
+		}
+		given[field] = key
+		sources[fmt.Sprintf("cluster #%d's %s", clusterNumber, field)] = fmt.Sprintf("-cluster #%d's %s", clusterNumber, key)
+
+		var err error
+		switch field {
+		case "name":
+			cluster.Name = fieldValue
+		case "scheduler":
+			cluster.Scheduler = fieldValue
+		case "workers":
+			cluster.Workers, err = parseWorkerCount(fieldValue)
+		case "hostname":
+			cluster.Hostname = fieldValue
+		case "matlabRoot":
+			cluster.MatlabRoot = fieldValue
+		case "customMPI":
+			cluster.CustomMPI = new(bool)
+			*cluster.CustomMPI, err = parseYesNo(fieldValue)
+		case "submissionType":
+			cluster.SubmissionType = fieldValue
+		case "remoteConfigs":
+			cluster.RemoteConfigs = new(bool)
+			*cluster.RemoteConfigs, err = parseYesNo(fieldValue)
+		}
+		if err != nil {
+			return cluster, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return cluster, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClusterSpecOverride(t *testing.T) {
+	yes, no := true, false
+	cluster := clusterSpec{Name: "Hopper", Scheduler: "slurm", CustomMPI: &yes, SubmissionType: "both", RemoteConfigs: &no, Workers: 256, MatlabRoot: "/usr/local/MATLAB/R2024a", Hostname: "hopper.example.edu"}
+
+	cluster.override(clusterSpec{Name: "hopper", MatlabRoot: "/usr/local/MATLAB/R2024b", CustomMPI: &no})
+	want := clusterSpec{Name: "Hopper", Scheduler: "slurm", CustomMPI: &no, SubmissionType: "both", RemoteConfigs: &no, Workers: 256, MatlabRoot: "/usr/local/MATLAB/R2024b", Hostname: "hopper.example.edu"}
+	if !reflect.DeepEqual(cluster, want) {
+		t.Errorf("override gave %+v, want %+v", cluster, want)
+	}
+}
+
+func TestParseClusterFlag(t *testing.T) {
+	yes := true
+	tests := []struct {
+		value   string
+		want    clusterSpec
+		sources map[string]string
+		error   string
+	}{
+		{
+			value: "name=Hopper,scheduler=slurm,workers=256,host=hopper.example.edu,matlab-root=/usr/local/MATLAB/R2024a,mpi=y",
+			want:  clusterSpec{Name: "Hopper", Scheduler: "slurm", Workers: 256, Hostname: "hopper.example.edu", MatlabRoot: "/usr/local/MATLAB/R2024a", CustomMPI: &yes},
+			sources: map[string]string{
+				"cluster #2's name":       "-cluster #2's name",
+				"cluster #2's scheduler":  "-cluster #2's scheduler",
+				"cluster #2's workers":    "-cluster #2's workers",
+				"cluster #2's hostname":   "-cluster #2's host",
+				"cluster #2's matlabRoot": "-cluster #2's matlab-root",
+				"cluster #2's customMPI":  "-cluster #2's mpi",
+			},
+		},
+		{value: " name=Hopper, hostname=hopper", want: clusterSpec{Name: "Hopper", Hostname: "hopper"},
+			sources: map[string]string{"cluster #2's name": "-cluster #2's name", "cluster #2's hostname": "-cluster #2's hostname"}},
+		{value: "name=Hopper,sheduler=slurm", error: `"sheduler=slurm" isn't a key=value pair it understands. Did you mean scheduler?`},
+		{value: "name=Hopper,colour=blue", error: `"colour=blue" isn't a key=value pair it understands. Use host, hostname, matlab-root, mpi, name, remote-configs, scheduler, submission, workers.`},
+		{value: "Hopper", error: `"Hopper" isn't a key=value pair it understands.`},
+		{value: "name=Hopper,name=Turing", error: "name is given twice, as name and name."},
+		{value: "host=hopper,hostname=hopper.example.edu", error: "hostname is given twice, as host and hostname."},
+		{value: "workers=lots", error: "workers: "},
+		{value: "mpi=maybe", error: "mpi: "},
+	}
+	for _, test := range tests {
+		sources := map[string]string{}
+		cluster, err := parseClusterFlag(test.value, 2, sources)
+		if test.error != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.error) {
+				t.Errorf("parseClusterFlag(%q) = %v, want an error starting %q", test.value, err, test.error)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(cluster, test.want) {
+			t.Errorf("parseClusterFlag(%q) = %+v, %v; want %+v", test.value, cluster, err, test.want)
+		}
+		if !reflect.DeepEqual(sources, test.sources) {
+			t.Errorf("parseClusterFlag(%q) recorded sources %v, want %v", test.value, sources, test.sources)
+		}
+	}
+}
+
+func TestMergeClusters(t *testing.T) {
+	record := engagementSpec{Clusters: []clusterSpec{{Name: "Hopper", Workers: 256}, {Name: "Turing", Workers: 128}}}
+	record.mergeClusters([]clusterSpec{{Name: "turing", Workers: 512}, {Name: "Lovelace", Workers: 64}, {Name: "Hopper", Workers: 32}})
+
+	want := []clusterSpec{{Name: "Hopper", Workers: 32}, {Name: "turing", Workers: 512}, {Name: "Lovelace", Workers: 64}}
+	if !reflect.DeepEqual(record.Clusters, want) {
+		t.Errorf("mergeClusters gave %+v, want %+v", record.Clusters, want)
+	}
+}
+
+func TestAnswerFlagsApply(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	answers := registerAnswerFlags(flags)
+	if err := flags.Parse([]string{"-org", "Acme Labs", "-case", "01234567", "-submission", "desktop", "-cluster", "name=Hopper,workers=256", "-cluster", "name=Turing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &engagementSpec{Clusters: []clusterSpec{{Name: "From the spec"}}}
+	if err := answers.apply(flags, spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Organization != "Acme Labs" || spec.CaseNumber == nil || *spec.CaseNumber != 1234567 || len(spec.Clusters) != 2 || spec.Clusters[1].Name != "Turing" {
+		t.Errorf("apply gave %+v", spec)
+	}
+	if spec.clusterDefaults.SubmissionType != "desktop" || spec.clusterDefaults.CustomMPI != nil {
+		t.Errorf("cluster defaults = %+v", spec.clusterDefaults)
+	}
+	if spec.sources["organization"] != "-org" || spec.sources["caseNumber"] != "-case" || spec.sources["cluster #1's workers"] != "-cluster #1's workers" || spec.sources["cluster #2's name"] != "-cluster #2's name" {
+		t.Errorf("sources = %v", spec.sources)
+	}
+}
+
+func TestLoadEngagementSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		error   string
+	}{
+		{"YAML", "spec.yaml", "organization: Acme Labs\ncaseNumber: 1234567\nclusters:\n  - name: Hopper\n    scheduler: slurm\n    workers: 256\n    customMPI: false\n", ""},
+		{"JSON", "spec.json", `{"organization": "Acme Labs", "caseNumber": 1234567, "clusters": [{"name": "Hopper", "scheduler": "slurm", "workers": 256, "customMPI": false}]}`, ""},
+		{"JSON with any case of extension", "SPEC.JSON", `{"organization": "Acme Labs", "caseNumber": 1234567, "clusters": [{"name": "Hopper", "scheduler": "slurm", "workers": 256, "customMPI": false}]}`, ""},
+		{"anything else is YAML", "spec.txt", "organization: Acme Labs\ncaseNumber: 1234567\nclusters: [{name: Hopper, scheduler: slurm, workers: 256, customMPI: false}]\n", ""},
+		{"unknown YAML field", "spec.yaml", "organization: Acme Labs\nclusters:\n  - name: Hopper\n    worker: 256\n", "line 4: field worker not found"},
+		{"unknown JSON field", "spec.json", `{"organisation": "Acme Labs"}`, `unknown field "organisation"`},
+		{"YAML type error", "spec.yaml", "organization: Acme Labs\nclusters:\n  - name: Hopper\n    workers: many\n", "line 4: cannot unmarshal !!str `many` into int"},
+		{"JSON type error", "spec.json", "{\n  \"organization\": \"Acme Labs\",\n  \"clusters\": [\n    {\"workers\": \"many\"}\n  ]\n}", "line 4: json: cannot unmarshal string into Go struct field"},
+		{"JSON syntax error", "spec.json", "{\n  \"organization\": \"Acme Labs\"\n  \"contact\": \"jane doe\"\n}", "line 3: invalid character"},
+		{"YAML that's really JSON", "spec.yaml", `{"organization": "Acme Labs", "caseNumber": 1234567, "clusters": [{"name": "Hopper", "scheduler": "slurm", "workers": 256, "customMPI": false}]}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			specPath := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(specPath, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			spec, err := loadEngagementSpec(specPath)
+
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) || !strings.HasPrefix(err.Error(), specPath+": ") {
+					t.Fatalf("loadEngagementSpec = %v, want an error starting with the path and saying %q", err, test.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			no := false
+			caseNumber := 1234567
+			want := &engagementSpec{Organization: "Acme Labs", CaseNumber: &caseNumber, Clusters: []clusterSpec{{Name: "Hopper", Scheduler: "slurm", Workers: 256, CustomMPI: &no}}}
+			if !reflect.DeepEqual(spec, want) {
+				t.Errorf("loadEngagementSpec = %+v, want %+v", spec, want)
+			}
+		})
+	}
+
+	// An empty YAML file answers nothing.
+	emptyPath := filepath.Join(t.TempDir(), "spec.yaml")
+	os.WriteFile(emptyPath, nil, 0644)
+	if spec, err := loadEngagementSpec(emptyPath); err != nil || !reflect.DeepEqual(spec, &engagementSpec{}) {
+		t.Errorf("loadEngagementSpec of an empty file = %+v, %v", spec, err)
+	}
+}
+
+func TestExampleEngagementSpec(t *testing.T) {
+	spec, err := loadEngagementSpec("engagement-spec.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Organization != "Example University" || len(spec.Clusters) != 2 {
+		t.Errorf("the example spec read as %+v", spec)
+	}
+}
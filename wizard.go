@@ -0,0 +1,687 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// The form create and add-cluster use on a terminal. It takes over the screen, with every answer laid out in sections
+// and edited where it's shown, and the arrow keys move between them so a typo can be fixed without starting over. Each
+// answer is checked as it's entered, and nothing is done until they've all been reviewed and confirmed. The answers
+// end up in the engagement spec, so the rest of the run goes just like it does with -spec.
+//
+// readline still reads and edits each answer, so the keys work like they do everywhere else, but what it would draw
+// is thrown away and the form is drawn again after every key instead.
+type wizard struct {
+	rl      *readline.Instance
+	command string
+
+	// Where the form's drawn, and how many lines there are to draw it in. They're the terminal's, except in tests.
+	out          io.Writer
+	screenHeight func() int
+
+	// Answers as they were typed, or as the spec or a flag gave them.
+	answers  map[string]string
+	problems map[string]string
+
+	organizations []string
+
+	// The cluster answers -mpi, -submission and -remote-configs give every cluster.
+	clusterDefaults clusterSpec
+
+	// GitLab projects that could be completed, only fetched once however many times Tab is pressed.
+	remoteOrganizations     []completionCandidate
+	remoteOrganizationsOnce sync.Once
+
+	// What's on screen, so it can be drawn again as keys are pressed. current is the index of the field being
+	// answered, or -1 for the review.
+	screenFields []wizardField
+	current      int
+	message      string
+	listing      string // The names Tab last listed.
+	reviewStart  int    // How far the review's scrolled, when it doesn't fit.
+	completer    *FolderCompleter
+
+	// Set by the arrow keys while reading a line: -1 for up and 1 for down.
+	moved atomic.Int32
+
+	// Whether an answer's being read. reads counts how many have been, so tests know when to type the next one.
+	reading atomic.Bool
+	reads   atomic.Int32
+
+	// Held while readline's goroutine draws the form, so it's never drawn once the answer's been read.
+	drawing sync.Mutex
+}
+
+// One answer in the form.
+type wizardField struct {
+	key     string // Such as "cluster 2 hostname".
+	section string
+	label   string
+	help    string
+
+	// Checks an answer and returns it as it'll be used, such as "first-last" for an empty contact.
+	parse       func(input string) (string, error)
+	completions func() []completionCandidate
+
+	// Returns a warning about an accepted answer, if there's anything worth pointing out.
+	warn func(answer string) string
+
+	// Used when there's no answer, such as -mpi for every cluster's custom MPI.
+	preset *string
+}
+
+// Whether the form should be used rather than one prompt after another.
+func useWizard() bool {
+	return activeSettings.Wizard && readline.DefaultIsTerminal()
+}
+
+// Runs the form for command, starting from what the spec already answers, and puts the confirmed answers into spec.
+// Returns false if the user quit.
+func runWizard(rl *readline.Instance, spec *engagementSpec, command string) bool {
+	w := newWizard(rl, spec, command)
+	w.out, w.screenHeight = os.Stdout, terminalHeight
+	return w.run(spec)
+}
+
+func newWizard(rl *readline.Instance, spec *engagementSpec, command string) *wizard {
+	w := &wizard{rl: rl, command: command, answers: map[string]string{}, problems: map[string]string{}, clusterDefaults: spec.clusterDefaults}
+	w.organizations = visibleFolders(filepath.Join(gitRepoPath, "Customer-Engagements"))
+
+	set := func(key string, value *string) {
+		if value != nil {
+			w.answers[key] = *value
+		}
+	}
+	set("organization", specString(spec.Organization))
+	set("abbreviation", spec.Abbreviation)
+	set("contact", specString(spec.Contact))
+	if spec.CaseNumber != nil {
+		w.answers["case"] = ""
+		if *spec.CaseNumber != 0 {
+			w.answers["case"] = strconv.Itoa(*spec.CaseNumber)
+		}
+	}
+	if len(spec.Clusters) > 0 {
+		w.answers["clusters"] = strconv.Itoa(len(spec.Clusters))
+	}
+	for i, cluster := range spec.Clusters {
+		set(clusterKey(i+1, "name"), specString(cluster.Name))
+		set(clusterKey(i+1, "scheduler"), specString(cluster.Scheduler))
+		set(clusterKey(i+1, "mpi"), specBool(cluster.CustomMPI))
+		set(clusterKey(i+1, "submission"), specString(cluster.SubmissionType))
+		set(clusterKey(i+1, "remoteConfigs"), specBool(cluster.RemoteConfigs))
+		set(clusterKey(i+1, "workers"), specInt(cluster.Workers))
+		set(clusterKey(i+1, "matlabRoot"), specString(cluster.MatlabRoot))
+		set(clusterKey(i+1, "hostname"), specString(cluster.Hostname))
+	}
+	return w
+}
+
+// Shows the form until its answers are confirmed or the user quits. Either way, the screen and rl are put back how
+// they were.
+func (w *wizard) run(spec *engagementSpec) bool {
+	// Swapped in whole, since readline reads its config from its own goroutines.
+	previousConfig := w.rl.Config
+	config := *previousConfig
+	config.FuncFilterInputRune, config.Listener, config.AutoComplete, config.Stdout = w.filterKeys, w, w, io.Discard
+	w.rl.SetConfig(&config)
+	enterWizardScreen(w.out)
+	defer func() {
+		w.rl.SetConfig(previousConfig)
+		leaveWizardScreen(w.out)
+	}()
+
+	w.current = w.nextToAnswer(w.fields(), 0)
+	for {
+		fields := w.fields()
+		if w.current >= len(fields) {
+			choice, ok := w.review(fields)
+			if !ok {
+				w.quit()
+				return false
+			}
+			if choice < 0 {
+				w.apply(spec, fields)
+				return true
+			}
+			w.current = choice
+			continue
+		}
+
+		field := fields[w.current]
+		w.completer = newFolderCompleter(w.rl, field.completions)
+		w.completer.list = func(list string) { w.listing = list }
+		answer, _ := w.answer(field)
+		w.screenFields, w.message, w.listing = fields, "", ""
+		w.draw([]rune(answer), len([]rune(answer)))
+
+		input, err := w.readAnswer(answer)
+		if err != nil {
+			if err == readline.ErrInterrupt || err == io.EOF {
+				w.quit()
+				return false
+			}
+			continue
+		}
+
+		// Moving away keeps whatever's been typed, checked like it would be on Enter, rather than losing it.
+		moved := w.moved.Swap(0)
+		if moved == 0 || input != answer {
+			w.record(field, input)
+		}
+		switch moved {
+		case -1:
+			w.current = max(w.current-1, 0)
+			continue
+		case 1:
+			w.current++
+			continue
+		}
+		if _, hasProblem := w.problems[field.key]; hasProblem {
+			continue
+		}
+
+		// Skip ahead past anything already answered. Once everything is, that's the review.
+		w.current = w.nextToAnswer(w.fields(), w.current+1)
+	}
+}
+
+// Reads a line, starting with answer to be edited.
+func (w *wizard) readAnswer(answer string) (string, error) {
+	w.rl.Operation.SetBuffer(answer)
+	w.reading.Store(true)
+	w.reads.Add(1)
+	line, err := w.rl.Readline()
+
+	// Ctrl+D ends the line before readline's done with the key, so it could still be drawing.
+	w.drawing.Lock()
+	w.reading.Store(false)
+	w.drawing.Unlock()
+	return line, err
+}
+
+func clusterKey(clusterNumber int, field string) string {
+	return fmt.Sprintf("cluster %d %s", clusterNumber, field)
+}
+
+// Only create can be for an engagement that's on GitLab but not in gitRepoPath.
+func (w *wizard) organizationCandidates() []completionCandidate {
+	if w.command != "create" {
+		return organizationCandidates()
+	}
+	w.remoteOrganizationsOnce.Do(func() { w.remoteOrganizations = remoteOrganizationCandidates() })
+	return append(organizationCandidates(), w.remoteOrganizations...)
+}
+
+// Every answer the form has, which depends on the answers so far, such as how many clusters there are.
+func (w *wizard) fields() []wizardField {
+	organization, _ := normalizeOrganization(w.answers["organization"])
+	organizationFolder := filepath.Join(gitRepoPath, "Customer-Engagements", organization)
+	contacts := visibleFolders(organizationFolder)
+
+	fields := []wizardField{{key: "organization", section: "Organization", label: "Name", help: "Enter the organization's name.", completions: w.organizationCandidates,
+		parse: func(input string) (string, error) {
+			organization, err := normalizeOrganization(input)
+			if err == nil && w.command != "create" && !slices.Contains(w.organizations, organization) {
+				return "", fmt.Errorf("There's no existing engagement named \"%s\".", organization)
+			}
+			return organization, err
+		}}}
+
+	if submitToRemoteRepo {
+		fields = append(fields, wizardField{key: "abbreviation", section: "Organization", label: "Abbreviation", help: "Enter the organization's abbreviation, used if its GitLab project is new. If it's unknown, leave it empty.",
+			parse: validateAbbreviation})
+	}
+
+	if gitRepoPath != "" {
+		fields = append(fields, wizardField{key: "contact", section: "Contact", label: "Name", help: "Enter the organization's contact name. If it's unknown, leave it empty and it will populate as \"first-last\".", completions: func() []completionCandidate { return contactCandidates(organizationFolder) },
+			parse: func(input string) (string, error) {
+				contact, err := normalizeContact(input)
+				if err == nil && w.command != "create" && !slices.Contains(contacts, contact) {
+					return "", fmt.Errorf("%s has no contact named \"%s\".", organization, contact)
+				}
+				return contact, err
+			}})
+	}
+
+	if team == "install" && w.command == "create" {
+		fields = append(fields, wizardField{key: "case", section: "Case", label: "Number", help: "Enter the Salesforce Case Number associated with these scripts. Leave it empty to skip.",
+			parse: func(input string) (string, error) {
+				caseNumber, err := parseCaseNumber(input)
+				if err != nil || caseNumber == 0 {
+					return "", err
+				}
+				return strconv.Itoa(caseNumber), nil
+			}})
+	}
+
+	fields = append(fields, wizardField{key: "clusters", section: "Clusters", label: "How many", help: "Enter the number of clusters you'd like to make scripts for. Entering nothing will select 1.",
+		parse: func(input string) (string, error) {
+			clusterCount, err := parseClusterCount(input)
+			return strconv.Itoa(clusterCount), err
+		}})
+
+	// add-cluster can't reuse a name the engagement already has.
+	var takenNames []string
+	if w.command == "add-cluster" {
+		contact, _ := normalizeContact(w.answers["contact"])
+		if record, err := readEngagementRecord(filepath.Join(organizationFolder, contact)); err == nil && record != nil {
+			for _, cluster := range record.Clusters {
+				takenNames = append(takenNames, cluster.Name)
+			}
+		}
+	}
+
+	clusterCount, err := parseClusterCount(w.answers["clusters"])
+	if err != nil {
+		clusterCount = 1
+	}
+	for i := 1; i <= clusterCount; i++ {
+		section := fmt.Sprint("Cluster ", i)
+		if w.command == "add-cluster" {
+			section = fmt.Sprint("New cluster ", i)
+		}
+
+		// Names have to be unique across the clusters in the form, too.
+		otherNames := slices.Clone(takenNames)
+		for j := 1; j <= clusterCount; j++ {
+			if _, profileName, err := normalizeClusterName(w.answers[clusterKey(j, "name")]); j != i && err == nil {
+				otherNames = append(otherNames, profileName)
+			}
+		}
+
+		submission := wizardField{key: clusterKey(i, "submission"), section: section, label: "Submission type", help: "Select the submission types to include. Entering nothing will select both.\n[1 Desktop] [2 Cluster] [3 Both]",
+			parse: parseSubmissionType, preset: specString(w.clusterDefaults.SubmissionType)}
+
+		fields = append(fields,
+			wizardField{key: clusterKey(i, "name"), section: section, label: "Name", help: "Enter the cluster's name. Entering nothing will use \"HPC\".",
+				parse: func(input string) (string, error) {
+					_, profileName, err := normalizeClusterName(input)
+					if err == nil && slices.ContainsFunc(otherNames, func(other string) bool { return strings.EqualFold(other, profileName) }) {
+						return "", fmt.Errorf("There's already a cluster named \"%s\".", profileName)
+					}
+					return profileName, err
+				}},
+			wizardField{key: clusterKey(i, "scheduler"), section: section, label: "Scheduler", help: "Select the scheduler by its number or name, such as sge or k8s. Entering nothing will select Slurm.\n" + schedulerMenu(),
+				parse: parseScheduler},
+			wizardField{key: clusterKey(i, "mpi"), section: section, label: "Custom MPI", help: "Would you like to include the custom MPI file? (y/n) Entering nothing will not include it.",
+				parse: parseYesNoAnswer, preset: specBool(w.clusterDefaults.CustomMPI)},
+			submission,
+			wizardField{key: clusterKey(i, "remoteConfigs"), section: section, label: "Remote configs", help: "Would you like to include the remote submission configuration files? (y/n) Entering nothing will exclude them.",
+				parse: parseYesNoAnswer, preset: specBool(w.clusterDefaults.RemoteConfigs)},
+			wizardField{key: clusterKey(i, "workers"), section: section, label: "Workers", help: "Enter the number of workers available on the cluster's license. Entering nothing will select 100,000.",
+				parse: func(input string) (string, error) {
+					numberOfWorkers, err := parseWorkerCount(input)
+					return strconv.Itoa(numberOfWorkers), err
+				}},
+		)
+
+		// Only desktop submission needs to know how to reach the cluster.
+		submissionAnswer, _ := w.answer(submission)
+		if submissionType, err := parseSubmissionType(submissionAnswer); err != nil || submissionType != "cluster" {
+			fields = append(fields,
+				wizardField{key: clusterKey(i, "matlabRoot"), section: section, label: "MATLAB root", help: "What is the full filepath of MATLAB on the cluster? (ex: /usr/local/MATLAB/R2024a)",
+					parse: validateMatlabRoot, warn: matlabRootWarning},
+				wizardField{key: clusterKey(i, "hostname"), section: section, label: "Hostname", help: "What is the hostname, FQDN, or IP address used to SSH to the cluster?",
+					parse: validateHostname},
+			)
+		}
+	}
+	return fields
+}
+
+func parseYesNoAnswer(input string) (string, error) {
+	yes, err := parseYesNo(input)
+	if yes {
+		return "yes", err
+	}
+	return "no", err
+}
+
+// Sets the field's answer, noting a problem if it isn't valid.
+func (w *wizard) record(field wizardField, input string) {
+	w.answers[field.key] = input
+	if _, err := field.parse(input); err != nil {
+		w.problems[field.key] = err.Error()
+		return
+	}
+	delete(w.problems, field.key)
+	journalAnswers(func(answers *engagementSpec) { *answers = w.answered(w.fields()) })
+}
+
+// The field's answer, or its preset if it doesn't have one.
+func (w *wizard) answer(field wizardField) (string, bool) {
+	if answer, ok := w.answers[field.key]; ok {
+		return answer, true
+	}
+	if field.preset != nil {
+		return *field.preset, true
+	}
+	return "", false
+}
+
+// The first field from start on that still needs an answer, or len(fields) if none do.
+func (w *wizard) nextToAnswer(fields []wizardField, start int) int {
+	for i := start; i < len(fields); i++ {
+		answer, ok := w.answer(fields[i])
+		if !ok {
+			return i
+		}
+		if _, err := fields[i].parse(answer); err != nil {
+			w.problems[fields[i].key] = err.Error()
+			return i
+		}
+	}
+	return len(fields)
+}
+
+// Up and down move between answers rather than through history. The line is submitted so Readline returns, and the
+// move is picked up from w.moved. Keys that come in after a line's been submitted, before the next one's being read,
+// are dropped, so that a held arrow key can't submit a line meant for another answer.
+func (w *wizard) filterKeys(r rune) (rune, bool) {
+	if r == 0 {
+		return r, true // The end of the input.
+	}
+	if !w.reading.Load() {
+		return r, false
+	}
+
+	switch r {
+	case readline.CharPrev:
+		w.moved.Store(-1)
+		r = readline.CharEnter
+	case readline.CharNext:
+		w.moved.Store(1)
+		r = readline.CharEnter
+	case readline.CharBckSearch, readline.CharFwdSearch:
+		return r, false // History search would draw over the form.
+	}
+	if r == readline.CharEnter || r == readline.CharCtrlJ || r == readline.CharInterrupt {
+		w.reading.Store(false)
+	}
+	return r, true
+}
+
+// Draws the form again after each key, with the answer as it's being typed. Called by readline.
+func (w *wizard) OnChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+	w.drawing.Lock()
+	defer w.drawing.Unlock()
+
+	// Once the line's been submitted, the form's drawn for whatever's next instead.
+	if key == 0 || !w.reading.Load() {
+		return nil, 0, false
+	}
+
+	w.listing = ""
+	newLine, newPos, ok := w.completer.OnChange(line, pos, key)
+	if ok {
+		line, pos = newLine, newPos
+	}
+	w.draw(line, pos)
+	return newLine, newPos, ok
+}
+
+// Completes names in the current answer on Tab. Called by readline.
+func (w *wizard) Do(line []rune, pos int) ([][]rune, int) {
+	return w.completer.Do(line, pos)
+}
+
+// Escape sequences for the terminal's alternate screen, which the form is drawn on so that leaving it puts back
+// whatever was on screen before.
+const (
+	enterAlternateScreen = "\033[?1049h"
+	leaveAlternateScreen = "\033[?1049l"
+)
+
+// Set while the form's on screen, so exiting from the signal handler can leave it too.
+var wizardScreen atomic.Bool
+
+func enterWizardScreen(out io.Writer) {
+	wizardScreen.Store(true)
+	fmt.Fprint(out, enterAlternateScreen)
+}
+
+func leaveWizardScreen(out io.Writer) {
+	if wizardScreen.Swap(false) {
+		fmt.Fprint(out, leaveAlternateScreen)
+	}
+}
+
+func terminalHeight() int {
+	if _, height, err := readline.GetSize(int(os.Stdout.Fd())); err == nil && height > 0 {
+		return height
+	}
+	return 24
+}
+
+// Draws the whole form over the screen, with line typed in as the current field's answer and the cursor at pos. For
+// the review, every field is numbered instead, and line is typed at the bottom. If it doesn't all fit, the fields
+// scroll to keep the current one in sight.
+func (w *wizard) draw(line []rune, pos int) {
+	redText := color.New(color.FgRed).SprintFunc()
+	currentText := color.New(color.FgCyan, color.Bold).SprintFunc()
+	faintText := color.New(color.Faint).SprintFunc()
+
+	title := "New engagement"
+	if w.command == "add-cluster" {
+		title = "Add clusters"
+	}
+	body := []string{title, faintText("Up and down move between answers. Enter saves one. Tab completes names. Ctrl+C quits without making anything.")}
+	cursorRow, cursorColumn := -1, 0
+
+	section := ""
+	for i, field := range w.screenFields {
+		if field.section != section {
+			section = field.section
+			body = append(body, "", section)
+		}
+
+		marker := "   "
+		if w.current < 0 {
+			marker = fmt.Sprintf("%2d.", i+1)
+		} else if i == w.current {
+			marker = " > "
+		}
+		label := fmt.Sprintf("%s %-16s ", marker, field.label)
+
+		if i == w.current {
+			cursorRow, cursorColumn = len(body), len([]rune(label))+len(line[:pos])
+			body = append(body, currentText(label)+string(line))
+		} else {
+			value := faintText("(not answered)")
+			if answer, ok := w.answer(field); ok {
+				if parsed, err := field.parse(answer); err == nil {
+					value = parsed
+					if parsed == "" {
+						value = faintText("(none)")
+					}
+				} else {
+					value = redText(answer)
+				}
+			}
+			body = append(body, label+value)
+		}
+
+		if problem, ok := w.problems[field.key]; ok {
+			body = append(body, redText("      ", problem))
+		} else if answer, ok := w.answer(field); ok && field.warn != nil {
+			if parsed, err := field.parse(answer); err == nil && field.warn(parsed) != "" {
+				body = append(body, redText("      ", field.warn(parsed)))
+			}
+		}
+	}
+
+	var footer []string
+	if w.current >= 0 {
+		footer = append(footer, strings.Split(w.screenFields[w.current].help, "\n")...)
+	}
+	if w.listing != "" {
+		footer = append(footer, strings.Split(strings.TrimRight(w.listing, "\n"), "\n")...)
+	}
+	if w.message != "" {
+		footer = append(footer, redText(w.message))
+	}
+	if w.current < 0 {
+		footer = append(footer, "Press Enter to make the engagement with these answers, or enter a number to change that answer.", "> "+string(line))
+	}
+
+	// A blank line goes between the fields and the footer.
+	room := max(w.screenHeight()-len(footer)-1, 1)
+	start := 0
+	if len(body) > room {
+		if cursorRow >= 0 {
+			start = min(max(cursorRow-room/2, 0), len(body)-room)
+		} else {
+			w.reviewStart = min(max(w.reviewStart, 0), len(body)-room)
+			start = w.reviewStart
+		}
+	}
+	visible := body[start:min(start+room, len(body))]
+
+	if cursorRow >= 0 {
+		cursorRow -= start
+	} else {
+		cursorRow, cursorColumn = len(visible)+len(footer), 2+len(line[:pos])
+	}
+
+	// Each line's cleared after it's written rather than clearing the screen first, which would flicker as keys are
+	// pressed. It's written in one go for the same reason.
+	var screen strings.Builder
+	screen.WriteString("\033[H")
+	screen.WriteString(strings.Join(append(append(visible, ""), footer...), "\033[K\r\n"))
+	fmt.Fprintf(&screen, "\033[J\033[%d;%dH", cursorRow+1, cursorColumn+1)
+	io.WriteString(w.out, screen.String())
+}
+
+// Shows every answer for them to be confirmed. Returns the index of the answer to change, or -1 once they're
+// confirmed. Returns false if the user quit.
+func (w *wizard) review(fields []wizardField) (int, bool) {
+	w.screenFields, w.current, w.message, w.listing, w.reviewStart = fields, -1, "", "", 0
+	w.completer = newFolderCompleter(w.rl, nil)
+
+	for {
+		unanswered := w.nextToAnswer(fields, 0)
+		if unanswered < len(fields) && w.message == "" {
+			w.message = "Some answers still need fixing."
+		}
+		w.draw(nil, 0)
+
+		input, err := w.readAnswer("")
+		if err != nil {
+			if err == readline.ErrInterrupt || err == io.EOF {
+				return 0, false
+			}
+			continue
+		}
+
+		// When it doesn't all fit, up and down scroll it. Otherwise, up goes back to the last answer.
+		switch w.moved.Swap(0) {
+		case -1:
+			if w.reviewStart == 0 {
+				return len(fields) - 1, true
+			}
+			w.reviewStart -= w.screenHeight() / 2
+			continue
+		case 1:
+			w.reviewStart += w.screenHeight() / 2
+			continue
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			if unanswered < len(fields) {
+				return unanswered, true
+			}
+			return -1, true
+		}
+		number, err := strconv.Atoi(input)
+		if err != nil || number < 1 || number > len(fields) {
+			w.message = fmt.Sprintf("Enter a number between 1-%d, or nothing to go ahead.", len(fields))
+			continue
+		}
+		return number - 1, true
+	}
+}
+
+// Leaves the form, saying nothing's been made. The answers given so far stay in the journal, so they can be resumed.
+func (w *wizard) quit() {
+	redText := color.New(color.FgRed).SprintFunc()
+	leaveWizardScreen(w.out)
+	fmt.Fprint(w.out, redText("\nExiting from user input. Nothing has been made."))
+	logger.Warn("quit the wizard", "command", w.command)
+	reportFailure(failureInterrupted, "Exiting from user input.")
+}
+
+// Puts the confirmed answers into spec, as they'll be used.
+func (w *wizard) apply(spec *engagementSpec, fields []wizardField) {
+	answers := w.answered(fields)
+	spec.Organization = answers.Organization
+	spec.Abbreviation = answers.Abbreviation
+	spec.Contact = answers.Contact
+	spec.CaseNumber = answers.CaseNumber
+	spec.Clusters = answers.Clusters
+	logger.Info("wizard confirmed", "command", w.command, "org", spec.Organization, "contact", spec.Contact, "clusters", len(spec.Clusters))
+}
+
+// The answers given so far, as they'll be used. Anything unanswered or invalid is left out.
+func (w *wizard) answered(fields []wizardField) engagementSpec {
+	values := map[string]string{}
+	for _, field := range fields {
+		if answer, ok := w.answer(field); ok {
+			if value, err := field.parse(answer); err == nil {
+				values[field.key] = value
+			}
+		}
+	}
+	yes := func(value string) *bool {
+		answer := value == "yes"
+		return &answer
+	}
+
+	var answers engagementSpec
+	answers.Organization = values["organization"]
+	if abbreviation, ok := values["abbreviation"]; ok {
+		answers.Abbreviation = &abbreviation
+	}
+	answers.Contact = values["contact"]
+	if caseValue, ok := values["case"]; ok {
+		caseNumber, _ := strconv.Atoi(caseValue)
+		answers.CaseNumber = &caseNumber
+	}
+
+	clusterCount, _ := strconv.Atoi(values["clusters"])
+	answers.Clusters = make([]clusterSpec, clusterCount)
+	for i := range answers.Clusters {
+		value := func(field string) (string, bool) {
+			value, ok := values[clusterKey(i+1, field)]
+			return value, ok
+		}
+		cluster := &answers.Clusters[i]
+		cluster.Name, _ = value("name")
+		cluster.Scheduler, _ = value("scheduler")
+		if customMPI, ok := value("mpi"); ok {
+			cluster.CustomMPI = yes(customMPI)
+		}
+		cluster.SubmissionType, _ = value("submission")
+		if remoteConfigs, ok := value("remoteConfigs"); ok {
+			cluster.RemoteConfigs = yes(remoteConfigs)
+		}
+		if workers, ok := value("workers"); ok {
+			cluster.Workers, _ = strconv.Atoi(workers)
+		}
+		cluster.MatlabRoot, _ = value("matlabRoot")
+		cluster.Hostname, _ = value("hostname")
+	}
+	return answers
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// Runs the form with keys typed into it, each string once the answer before has been submitted, and returns what it
+// drew. Nothing's asked of GitLab or gitRepoPath, so it's just the organization and the clusters.
+func runTestWizard(t *testing.T, spec *engagementSpec, keys ...string) (*wizard, bool, string) {
+	t.Helper()
+	savedRepoPath, savedSubmit, savedTeam, savedFailures := gitRepoPath, submitToRemoteRepo, team, report.Failures
+	t.Cleanup(func() {
+		gitRepoPath, submitToRemoteRepo, team, report.Failures = savedRepoPath, savedSubmit, savedTeam, savedFailures
+	})
+	gitRepoPath, submitToRemoteRepo, team = "", false, ""
+	useTempJournal(t)
+	journal = &sessionJournal{Command: "create"}
+
+	stdin, typing := io.Pipe()
+	rl, err := readline.NewEx(&readline.Config{Stdin: stdin, Stdout: io.Discard, Stderr: io.Discard, FuncIsTerminal: func() bool { return false }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		typing.Close()
+		rl.Close()
+	})
+
+	w := newWizard(rl, spec, "create")
+	var screen bytes.Buffer
+	w.out, w.screenHeight = &screen, func() int { return 100 }
+
+	go func() {
+		for i, key := range keys {
+			for deadline := time.Now().Add(5 * time.Second); int(w.reads.Load()) <= i && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			typing.Write([]byte(key))
+		}
+	}()
+	confirmed := w.run(spec)
+	return w, confirmed, screen.String()
+}
+
+// The last time the form was drawn.
+func lastFrame(screen string) string {
+	frames := strings.Split(screen, "\033[H")
+	return frames[len(frames)-1]
+}
+
+func TestWizardKeepsAnswersWhenMoving(t *testing.T) {
+	const up, down = "\033[A", "\033[B"
+	w, confirmed, screen := runTestWizard(t, &engagementSpec{},
+		"Acme Labs"+down, // Typed, then moved away from without Enter.
+		"2"+up,
+		down, // Back to the organization, and on again without changing it.
+		down,
+		"Hopper"+up,
+		"\x03",
+	)
+
+	if confirmed {
+		t.Fatal("the form was confirmed")
+	}
+	for key, want := range map[string]string{"organization": "Acme Labs", "clusters": "2", clusterKey(1, "name"): "Hopper"} {
+		if w.answers[key] != want {
+			t.Errorf("the answer to %s is %q, want %q", key, w.answers[key], want)
+		}
+	}
+	if journal.Answers.Organization != "Acme-Labs" || len(journal.Answers.Clusters) != 2 || journal.Answers.Clusters[0].Name != "Hopper" {
+		t.Errorf("the journal has %+v", journal.Answers)
+	}
+
+	// The answers moved away from are still on the form, with the one it was on being edited.
+	frame := lastFrame(screen)
+	for _, want := range []string{"    Name             Acme-Labs", " >  How many         2", "    Name             Hopper", "Cluster 2"} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("the form doesn't show %q:\n%s", want, frame)
+		}
+	}
+}
+
+func TestWizardQuitCleansUp(t *testing.T) {
+	for _, quitKey := range []string{"\x03", "\x04"} {
+		t.Run(strings.NewReplacer("\x03", "Ctrl+C", "\x04", "Ctrl+D").Replace(quitKey), func(t *testing.T) {
+			w, confirmed, screen := runTestWizard(t, &engagementSpec{}, "Acme Labs\r", quitKey)
+			if confirmed {
+				t.Fatal("the form was confirmed")
+			}
+
+			if !strings.HasPrefix(screen, enterAlternateScreen) || !strings.HasSuffix(screen, leaveAlternateScreen+"\nExiting from user input. Nothing has been made.") || wizardScreen.Load() {
+				t.Errorf("the form didn't leave the alternate screen before saying it quit: %q", screen[max(len(screen)-80, 0):])
+			}
+			config := w.rl.Config
+			if _, completing := config.AutoComplete.(*wizard); completing || config.Stdout != io.Discard || config.FuncFilterInputRune != nil || config.Listener != nil {
+				t.Errorf("readline wasn't put back: %+v", config)
+			}
+			if len(report.Failures) == 0 || report.Failures[len(report.Failures)-1].Category != failureInterrupted {
+				t.Errorf("the report's failures are %+v", report.Failures)
+			}
+
+			// What had been answered is kept, so it can be resumed.
+			saved, err := readSessionJournal()
+			if err != nil || saved == nil || saved.Answers.Organization != "Acme-Labs" {
+				t.Errorf("readSessionJournal = %+v, %v", saved, err)
+			}
+		})
+	}
+}
+
+func TestWizardReviewAndConfirm(t *testing.T) {
+	spec := &engagementSpec{}
+	_, confirmed, screen := runTestWizard(t, spec,
+		"Acme Labs\r", "\r", "Hopper\r", "slurm\r", "y\r", "desktop\r", "n\r", "64\r", "/usr/local/MATLAB/R2024a\r", "hopper.example.edu@\r",
+		"\033[D\033[3~\r", // The bad hostname is asked for again, and the @ deleted.
+		"12\r",            // There's no 12th answer.
+		"2\r", "\r",       // Change how many clusters there are, but leave it.
+		"\r",
+	)
+	if !confirmed {
+		t.Fatal("the form wasn't confirmed")
+	}
+
+	if spec.Organization != "Acme-Labs" || len(spec.Clusters) != 1 {
+		t.Fatalf("spec = %+v", spec)
+	}
+	cluster := spec.Clusters[0]
+	if cluster.Name != "Hopper" || cluster.Scheduler != "slurm" || !*cluster.CustomMPI || cluster.SubmissionType != "desktop" || *cluster.RemoteConfigs || cluster.Workers != 64 || cluster.MatlabRoot != "/usr/local/MATLAB/R2024a" || cluster.Hostname != "hopper.example.edu" {
+		t.Errorf("the cluster is %+v", cluster)
+	}
+
+	for _, want := range []string{"Invalid input. Enter just the hostname, without a username.", "Enter a number between 1-10, or nothing to go ahead.", "10. Hostname         hopper.example.edu"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("the form never showed %q", want)
+		}
+	}
+}
+
+func TestWizardScrolls(t *testing.T) {
+	w := newWizard(nil, &engagementSpec{}, "create")
+	var screen bytes.Buffer
+	w.out, w.screenHeight = &screen, func() int { return 12 }
+	w.answers["clusters"] = "3"
+	w.screenFields = w.fields()
+	w.current = len(w.screenFields) - 1
+	w.draw([]rune("hopper"), 3)
+
+	frame := lastFrame(screen.String())
+	if lines := strings.Count(frame, "\r\n") + 1; lines > 12 {
+		t.Errorf("the form is %d lines on a 12 line screen", lines)
+	}
+	if !strings.Contains(frame, " >  Hostname         hopper") || strings.Contains(frame, "New engagement") {
+		t.Errorf("the form didn't scroll to the last answer:\n%s", frame)
+	}
+}